@@ -2,6 +2,9 @@ package adapter
 
 import (
 	"context"
+	"net/http"
+	"sync"
+	"time"
 
 	"github.com/JiscSD/rdss-archivematica-channel-adapter/broker"
 	"github.com/JiscSD/rdss-archivematica-channel-adapter/broker/message"
@@ -10,7 +13,8 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-// Archivematica processing configuration preferred by this adapter.
+// Archivematica processing configuration preferred by this adapter, used when
+// the registry record of the tenant does not name one.
 const archivematicaProcessingConfig = "automated"
 
 // Adapter is the core of the adapter.
@@ -27,6 +31,27 @@ type Adapter struct {
 	ctx      context.Context
 	cancel   context.CancelFunc
 	stop     chan chan struct{}
+
+	// Frequency of the fixity audits, disabled when zero.
+	fixityInterval time.Duration
+
+	// Completion watchers of the pipelines.
+	watchers *completionWatchers
+
+	// Handlers of the datasets in flight and the ones that failed.
+	handlers *handlers
+
+	// Handlers retried from the admin API, waited for when the adapter stops.
+	retries   sync.WaitGroup
+	retriesMu sync.Mutex // No retries are added once the context is canceled.
+
+	// Remove the completed transfers, see cleanupTransfer.
+	cleanup bool
+
+	// Frequency of the sweeps of the stale transfer sessions, disabled when
+	// zero, and their minimum age.
+	janitorInterval time.Duration
+	janitorMaxAge   time.Duration
 }
 
 func New(
@@ -44,6 +69,8 @@ func New(
 		storage:  storage,
 		registry: registry,
 		stop:     make(chan chan struct{}),
+		watchers: newCompletionWatchers(),
+		handlers: newHandlers(),
 	}
 
 	c.ctx, c.cancel = context.WithCancel(context.Background())
@@ -54,14 +81,66 @@ func New(
 	return c
 }
 
+// WithFixityAudit enables the periodic fixity audit of the AIPs stored.
+func (c *Adapter) WithFixityAudit(interval time.Duration) *Adapter {
+	c.fixityInterval = interval
+	return c
+}
+
+// WithCompletionInterval sets the interval between the checks of the transfers
+// in progress. The default of amclient.Watcher is used when zero.
+func (c *Adapter) WithCompletionInterval(interval time.Duration) *Adapter {
+	c.watchers.interval = interval
+	return c
+}
+
+// WithCleanup enables the removal of the transfers and the SIPs from the
+// Dashboard, and of the transfer source directories, once the AIPs are stored.
+func (c *Adapter) WithCleanup(enabled bool) *Adapter {
+	c.cleanup = enabled
+	return c
+}
+
+// WithJanitor enables the periodic removal of the transfer sessions that have
+// not been modified for longer than maxAge.
+func (c *Adapter) WithJanitor(interval, maxAge time.Duration) *Adapter {
+	c.janitorInterval = interval
+	c.janitorMaxAge = maxAge
+	return c
+}
+
+// CompletionWebhook returns the handler of the post-store callbacks of the
+// Archivematica Storage Service, which speed up the detection of the AIPs
+// stored.
+func (c *Adapter) CompletionWebhook() http.Handler {
+	return c.watchers
+}
+
 func (c *Adapter) Run() {
 	go c.broker.Run()
+	if c.fixityInterval > 0 {
+		logger := c.logger.WithField("component", "fixity")
+		go newFixityAuditor(logger, c.storage, c.broker.Preservation, c.registry.Pipelines, c.fixityInterval).run(c.ctx)
+	}
+	if c.janitorInterval > 0 {
+		logger := c.logger.WithField("component", "janitor")
+		j := &janitor{
+			logger:    logger,
+			pipelines: c.registry.Pipelines,
+			interval:  c.janitorInterval,
+			maxAge:    c.janitorMaxAge,
+		}
+		go j.run(c.ctx)
+	}
 	c.loop()
 }
 
 func (c *Adapter) loop() {
 	ch := <-c.stop
+	c.retriesMu.Lock()
 	c.cancel()
+	c.retriesMu.Unlock()
+	c.retries.Wait()
 	c.registry.Stop()
 	c.broker.Stop()
 	close(ch)
@@ -0,0 +1,221 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/amclient"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// AdminAPI returns the handler of the administrative API, which expects the
+// paths relative to where it is mounted:
+//
+//	GET  /tenants                     tenants and pipelines of the registry
+//	POST /registry/reload             reload the registry
+//	GET  /handlers                    handlers of the datasets in flight
+//	GET  /objects/<objectUUID>        processing state of a dataset
+//	POST /objects/<objectUUID>/cancel cancel the handlers of a dataset
+//	POST /objects/<objectUUID>/retry  retry the last failed handler of a dataset
+//
+// Canceling a handler stops the adapter from preparing or waiting for the
+// transfer, which is recorded as a failure that can be retried. A transfer
+// already started keeps running in the pipeline. Retrying a handler that
+// started a transfer waits for it again when the pipeline still processes it
+// or has stored it, and only starts a new transfer when it failed.
+//
+// The API is not authenticated, that is left to the server.
+func (c *Adapter) AdminAPI() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tenants", allowMethod(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, c.registry.Tenants())
+	}))
+	mux.HandleFunc("/registry/reload", allowMethod(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		c.registry.Reload()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	mux.HandleFunc("/handlers", allowMethod(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, c.handlers.list())
+	}))
+	mux.HandleFunc("/objects/", c.serveObject)
+	return mux
+}
+
+// ObjectState is the processing state of a dataset reported by AdminAPI.
+type ObjectState struct {
+	ObjectUUID  string         `json:"objectUUID"`
+	Stored      *StoredObject  `json:"stored,omitempty"` // Nil until a transfer is started.
+	InFlight    []HandlerInfo  `json:"inFlight"`
+	LastFailure *FailedHandler `json:"lastFailure,omitempty"`
+}
+
+// serveObject serves the requests about a dataset, the path is
+// "/objects/<objectUUID>[/<action>]".
+func (c *Adapter) serveObject(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/objects/"), "/")
+	if len(parts) > 2 {
+		http.NotFound(w, r)
+		return
+	}
+	objectUUID := parts[0]
+	if _, err := uuid.Parse(objectUUID); err != nil {
+		http.Error(w, "invalid object identifier", http.StatusBadRequest)
+		return
+	}
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+	switch action {
+	case "":
+		allowMethod(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			c.serveObjectState(w, r, objectUUID)
+		})(w, r)
+	case "cancel":
+		allowMethod(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+			n := c.handlers.cancel(objectUUID)
+			if n == 0 {
+				http.Error(w, "object not in flight", http.StatusNotFound)
+				return
+			}
+			c.logger.WithField("objectUUID", objectUUID).Warn("Handlers canceled from the admin API")
+			writeJSON(w, http.StatusAccepted, map[string]int{"canceled": n})
+		})(w, r)
+	case "retry":
+		allowMethod(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+			c.serveObjectRetry(w, r, objectUUID)
+		})(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (c *Adapter) serveObjectState(w http.ResponseWriter, r *http.Request, objectUUID string) {
+	state := ObjectState{ObjectUUID: objectUUID}
+	state.InFlight, state.LastFailure = c.handlers.find(objectUUID)
+	stored, err := c.storage.GetObject(r.Context(), objectUUID)
+	switch {
+	case errors.Is(err, ErrObjectNotFound):
+		if len(state.InFlight) == 0 && state.LastFailure == nil {
+			http.Error(w, "object not found", http.StatusNotFound)
+			return
+		}
+	case err != nil:
+		http.Error(w, fmt.Sprintf("object cannot be retrieved: %v", err), http.StatusInternalServerError)
+		return
+	default:
+		state.Stored = stored
+	}
+	if state.InFlight == nil {
+		state.InFlight = []HandlerInfo{}
+	}
+	writeJSON(w, http.StatusOK, state)
+}
+
+// serveObjectRetry runs again the last failed handler of a dataset in the
+// background, with the message it received, see startedTransfer. The retries
+// are waited for when the adapter stops.
+func (c *Adapter) serveObjectRetry(w http.ResponseWriter, r *http.Request, objectUUID string) {
+	running, failed := c.handlers.find(objectUUID)
+	switch {
+	case len(running) > 0:
+		http.Error(w, errHandlerInFlight.Error(), http.StatusConflict)
+		return
+	case failed == nil:
+		http.Error(w, errNoFailedHandler.Error(), http.StatusNotFound)
+		return
+	}
+	started, err := c.startedTransfer(r.Context(), failed.HandlerInfo)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("handler cannot be retried: %v", err), http.StatusConflict)
+		return
+	}
+	c.retriesMu.Lock()
+	defer c.retriesMu.Unlock()
+	if c.ctx.Err() != nil {
+		http.Error(w, "adapter stopped", http.StatusServiceUnavailable)
+		return
+	}
+	msg, err := c.handlers.takeFailed(objectUUID)
+	switch {
+	case errors.Is(err, errHandlerInFlight):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	logger := c.logger.WithFields(logrus.Fields{"objectUUID": objectUUID, "message": msg.ID()})
+	if started != nil {
+		logger = logger.WithFields(logrus.Fields{"pipeline": started.pipeline.ID, "transfer": started.ID})
+	}
+	logger.Warn("Handler retried from the admin API")
+	c.retries.Add(1)
+	go func() {
+		defer c.retries.Done()
+		if err := c.ingestDataset(msg, true, started); err != nil {
+			logger.WithError(err).Error("Retried handler failed")
+		}
+	}()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// startedTransfer returns the transfer started by a failed handler when the
+// pipeline still processes it or has stored it, so the retry waits for it
+// instead of starting it again. It returns nil when the handler did not start
+// a transfer or when the transfer failed, and an error when the status of the
+// transfer cannot be confirmed.
+func (c *Adapter) startedTransfer(ctx context.Context, info HandlerInfo) (*startedTransfer, error) {
+	if info.TransferID == "" {
+		return nil, nil
+	}
+	amClient := c.registry.Pipeline(info.TenantJiscID, info.PipelineID)
+	if amClient == nil {
+		return nil, errors.Errorf("pipeline %s of transfer %s not found in the registry", info.PipelineID, info.TransferID)
+	}
+	transfer, _, err := amClient.Transfer.Status(ctx, info.TransferID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "status of transfer %s cannot be retrieved", info.TransferID)
+	}
+	status := transfer.Status
+	if SIPID, ok := transfer.SIP(); ok {
+		sip, _, err := amClient.Ingest.Status(ctx, SIPID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "status of SIP %s cannot be retrieved", SIPID)
+		}
+		status = sip.Status
+	}
+	if status == amclient.UnitStatusFailed || status == amclient.UnitStatusRejected {
+		return nil, nil
+	}
+	return &startedTransfer{
+		pipeline: Pipeline{ID: info.PipelineID, Client: amClient},
+		ID:       info.TransferID,
+	}, nil
+}
+
+// allowMethod rejects the requests that do not use the given method.
+func allowMethod(method string, fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		fn(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
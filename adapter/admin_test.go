@@ -0,0 +1,216 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/broker/message"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type adminStorageMock struct {
+	Storage
+	objects map[string]*StoredObject
+}
+
+func (s *adminStorageMock) GetObject(ctx context.Context, objectUUID string) (*StoredObject, error) {
+	if o, ok := s.objects[objectUUID]; ok {
+		return o, nil
+	}
+	return nil, ErrObjectNotFound
+}
+
+func createMessage(tenantID uint64, objectUUID string) *message.Message {
+	msg := message.New(message.MessageTypeEnum_MetadataCreate, message.MessageClassEnum_Command)
+	msg.MessageHeader.TenantJiscID = tenantID
+	body, _ := msg.MetadataCreateRequest()
+	body.Dataset = &message.Dataset{ObjectUUID: message.MustUUID(objectUUID)}
+	return msg
+}
+
+func adminRequest(t *testing.T, h http.Handler, method, path string, v interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	if v != nil && rec.Code < 300 {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), v), rec.Body.String())
+	}
+	return rec
+}
+
+func TestAdapter_AdminAPI(t *testing.T) {
+	const (
+		storedUUID   = "c2a8b2d2-2e8d-4a3c-9d9a-6f3f7a5a9a11"
+		inFlightUUID = "8a8c2b71-0d2f-4b7e-8ed1-4f8e3ac0d1e2"
+		failedUUID   = "0f1b8f7e-5c3a-4d8f-b1a2-9e6d5c4b3a21"
+	)
+	// Pipeline "b" reports the status of the transfers named after it.
+	pipeline := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/transfer/status/failed":
+			fmt.Fprint(w, `{"status": "FAILED"}`)
+		case "/api/transfer/status/processing":
+			fmt.Fprint(w, `{"status": "PROCESSING"}`)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer pipeline.Close()
+	source := &testRegistrySource{}
+	source.set([]RegistryRecord{
+		{TenantJiscID: "1", ArchivematicaURL: "http://a.example.com", ArchivematicaKey: "env:AM_KEY",
+			StorageServiceURL: "http://ss.example.com", StorageServiceKey: "ss-key",
+			Pipelines: []RegistryPipeline{{ID: "b", ArchivematicaURL: pipeline.URL, Capacity: 2}}},
+	}, nil)
+	os.Setenv("AM_KEY", "am-key")
+	defer os.Unsetenv("AM_KEY")
+	r, err := NewRegistryFromSource(logrus.StandardLogger(), source)
+	require.NoError(t, err)
+	defer r.Stop()
+
+	c := &Adapter{
+		logger:   logrus.StandardLogger(),
+		registry: r,
+		storage: &adminStorageMock{objects: map[string]*StoredObject{
+			storedUUID: {StoredAIP: StoredAIP{ObjectUUID: storedUUID, AIPID: "aip", PipelineID: "b"}, TransferID: "transfer", TenantJiscID: 1},
+		}},
+		ctx:      context.Background(),
+		watchers: newCompletionWatchers(),
+		handlers: newHandlers(),
+	}
+	h := c.AdminAPI()
+
+	// Tenants.
+	var tenants []TenantInfo
+	rec := adminRequest(t, h, "GET", "/tenants", &tenants)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Len(t, tenants, 1)
+	assert.Equal(t, uint64(1), tenants[0].TenantJiscID)
+	require.Len(t, tenants[0].Pipelines, 2)
+	assert.Equal(t, PipelineInfo{
+		ID: "default", URL: "http://a.example.com", Key: "env:AM_KEY", Breaker: "closed", Capacity: 1,
+		StorageServiceURL: "http://ss.example.com", StorageServiceKey: "plain text", StorageServiceBreaker: "closed",
+	}, tenants[0].Pipelines[0])
+	assert.Equal(t, "b", tenants[0].Pipelines[1].ID)
+	assert.Equal(t, 2, tenants[0].Pipelines[1].Capacity)
+	assert.NotContains(t, rec.Body.String(), "am-key")
+	assert.NotContains(t, rec.Body.String(), "ss-key")
+
+	assert.Equal(t, http.StatusAccepted, adminRequest(t, h, "POST", "/registry/reload", nil).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, adminRequest(t, h, "GET", "/registry/reload", nil).Code)
+
+	// Handlers in flight.
+	msg := createMessage(1, inFlightUUID)
+	hd, ctx := c.handlers.start(c.ctx, msg, inFlightUUID, false)
+	hd.update(func(info *HandlerInfo) {
+		info.Stage = StageWaitingIngest
+		info.PipelineID = "b"
+		info.TransferID = "failed"
+	})
+	var handlers []HandlerInfo
+	require.Equal(t, http.StatusOK, adminRequest(t, h, "GET", "/handlers", &handlers).Code)
+	require.Len(t, handlers, 1)
+	assert.Equal(t, msg.ID(), handlers[0].MessageID)
+	assert.Equal(t, StageWaitingIngest, handlers[0].Stage)
+
+	// Processing state.
+	var state ObjectState
+	require.Equal(t, http.StatusOK, adminRequest(t, h, "GET", "/objects/"+storedUUID, &state).Code)
+	assert.Equal(t, "aip", state.Stored.AIPID)
+	assert.Empty(t, state.InFlight)
+	state = ObjectState{}
+	require.Equal(t, http.StatusOK, adminRequest(t, h, "GET", "/objects/"+inFlightUUID, &state).Code)
+	assert.Nil(t, state.Stored)
+	assert.Len(t, state.InFlight, 1)
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, h, "GET", "/objects/"+failedUUID, nil).Code)
+	assert.Equal(t, http.StatusBadRequest, adminRequest(t, h, "GET", "/objects/invalid", nil).Code)
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, h, "POST", "/objects/"+storedUUID+"/unknown", nil).Code)
+
+	// Handlers in flight are canceled but not retried.
+	assert.Equal(t, http.StatusConflict, adminRequest(t, h, "POST", "/objects/"+inFlightUUID+"/retry", nil).Code)
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, h, "POST", "/objects/"+storedUUID+"/cancel", nil).Code)
+	assert.Equal(t, http.StatusAccepted, adminRequest(t, h, "POST", "/objects/"+inFlightUUID+"/cancel", nil).Code)
+	assert.Error(t, ctx.Err())
+	c.handlers.finish(hd, msg, ctx.Err())
+
+	// Failed handlers are retried with the same message. The transfer failed
+	// so a new one is started.
+	require.Equal(t, http.StatusOK, adminRequest(t, h, "GET", "/objects/"+inFlightUUID, &state).Code)
+	require.NotNil(t, state.LastFailure)
+	assert.Equal(t, context.Canceled.Error(), state.LastFailure.Error)
+	msg.MessageHeader.TenantJiscID = 2 // The retry fails since the tenant is unknown.
+	assert.Equal(t, http.StatusAccepted, adminRequest(t, h, "POST", "/objects/"+inFlightUUID+"/retry", nil).Code)
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, h, "POST", "/objects/"+inFlightUUID+"/retry", nil).Code, "retried once")
+	assert.Eventually(t, func() bool {
+		_, failed := c.handlers.find(inFlightUUID)
+		return failed != nil && failed.Retry
+	}, time.Second, 10*time.Millisecond)
+	_, failed := c.handlers.find(inFlightUUID)
+	assert.Equal(t, msg.ID(), failed.MessageID)
+	assert.Contains(t, failed.Error, UnknownTenantErr.Error())
+
+	// Transfers still processed are waited for again, and retries are
+	// refused when their status is unknown.
+	for transferID, code := range map[string]int{"processing": http.StatusAccepted, "unknown": http.StatusConflict} {
+		objectUUID := message.NewUUID().String()
+		msg := createMessage(1, objectUUID)
+		hd, _ := c.handlers.start(c.ctx, msg, objectUUID, false)
+		hd.update(func(info *HandlerInfo) {
+			info.PipelineID = "b"
+			info.TransferID = transferID
+		})
+		c.handlers.finish(hd, msg, errors.New("transfer not stored"))
+		require.Equal(t, code, adminRequest(t, h, "POST", "/objects/"+objectUUID+"/retry", nil).Code, transferID)
+		if code != http.StatusAccepted {
+			continue
+		}
+		var running []HandlerInfo
+		require.Eventually(t, func() bool {
+			running, _ = c.handlers.find(objectUUID)
+			return len(running) == 1
+		}, time.Second, 10*time.Millisecond)
+		assert.Equal(t, StageWaitingIngest, running[0].Stage)
+		assert.Equal(t, "processing", running[0].TransferID)
+		assert.True(t, running[0].Retry)
+		assert.Equal(t, int64(1), r.Tenants()[0].Pipelines[1].InFlight, "the transfer is counted in its pipeline")
+
+		// The retry is waited for once canceled.
+		assert.Equal(t, http.StatusAccepted, adminRequest(t, h, "POST", "/objects/"+objectUUID+"/cancel", nil).Code)
+		c.retries.Wait()
+		assert.Equal(t, int64(0), r.Tenants()[0].Pipelines[1].InFlight)
+		_, failed := c.handlers.find(objectUUID)
+		require.NotNil(t, failed)
+		assert.Contains(t, failed.Error, context.Canceled.Error())
+	}
+}
+
+func TestHandlers_finish(t *testing.T) {
+	hs := newHandlers()
+	for i := 0; i < maxFailedHandlers+1; i++ {
+		objectUUID := message.NewUUID().String()
+		msg := createMessage(1, objectUUID)
+		h, _ := hs.start(context.Background(), msg, objectUUID, false)
+		hs.finish(h, msg, errors.New("failed"))
+	}
+	assert.Len(t, hs.failed, maxFailedHandlers, "oldest failures are forgotten")
+	assert.Empty(t, hs.list())
+
+	objectUUID := message.NewUUID().String()
+	msg := createMessage(1, objectUUID)
+	h, _ := hs.start(context.Background(), msg, objectUUID, false)
+	hs.finish(h, msg, errors.New("failed"))
+	h, _ = hs.start(context.Background(), msg, objectUUID, true)
+	hs.finish(h, msg, nil)
+	_, failed := hs.find(objectUUID)
+	assert.Nil(t, failed, "failures are cleared once the dataset is preserved")
+}
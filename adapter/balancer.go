@@ -0,0 +1,251 @@
+package adapter
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/amclient"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Strategies used to choose the pipeline of a new transfer when a tenant has
+// more than one pipeline.
+const (
+	// StrategyRoundRobin takes the pipelines in turns.
+	StrategyRoundRobin = "round robin"
+
+	// StrategyLeastInFlight prefers the pipeline with the fewest transfers
+	// started by the adapter that are not completed yet.
+	StrategyLeastInFlight = "least in-flight"
+
+	// StrategyCapacity prefers the pipeline with the most spare capacity,
+	// i.e. the fewest active jobs relative to the capacity of the pipeline.
+	StrategyCapacity = "capacity"
+)
+
+// defaultPipelineID identifies the pipeline described by the top-level
+// attributes of a registry record.
+const defaultPipelineID = "default"
+
+// Pipeline is one of the Archivematica pipelines of a tenant.
+type Pipeline struct {
+	ID     string
+	Client *amclient.Client
+
+	// Directory where the processing configurations of the pipeline are
+	// installed, empty when it is not known.
+	ProcessingConfigDir string
+}
+
+// pipeline holds the resources of a pipeline loaded from the registry.
+type pipeline struct {
+	id          string
+	client      *amclient.Client
+	guard       *pipelineGuard
+	ssGuard     *pipelineGuard // Nil when the Storage Service is not known.
+	ssURL       string         // Empty when the Storage Service is not known.
+	capacity    int            // Active jobs the pipeline can take, at least one.
+	transferDir string         // Where the transfers are built.
+	configDir   string         // Where the processing configurations are installed.
+
+	// The keys as they are described in the logs, see describeSecret.
+	keyRef, ssKeyRef string
+}
+
+// available reports whether the circuit breaker of the pipeline lets the
+// requests through.
+func (p *pipeline) available() bool {
+	return breakerState(p.guard) != amclient.BreakerOpen
+}
+
+// findPipeline returns the pipeline of a tenant by its identifier. The
+// first pipeline is returned when the identifier is empty, e.g. for research
+// objects recorded before tenants had more than one pipeline.
+func findPipeline(pipelines []Pipeline, ID string) *amclient.Client {
+	if len(pipelines) == 0 {
+		return nil
+	}
+	if ID == "" {
+		return pipelines[0].Client
+	}
+	for _, p := range pipelines {
+		if p.ID == ID {
+			return p.Client
+		}
+	}
+	return nil
+}
+
+// activeJobs returns the number of jobs being processed by a pipeline for the
+// transfers of the adapter, as last counted.
+type activeJobs func(c *amclient.Client) (int, error)
+
+// balancer decides the order in which the pipelines of a tenant are tried.
+type balancer struct {
+	strategy string
+	cursor   *uint32 // Shared by the tenant across reloads.
+}
+
+// order returns the pipelines sorted by preference. Pipelines whose circuit
+// breaker is open are moved to the end so they are only tried when all the
+// others have failed. The active jobs are only needed by the capacity
+// strategy.
+func (b *balancer) order(pipelines []*pipeline, active activeJobs) []*pipeline {
+	ordered := make([]*pipeline, len(pipelines))
+	copy(ordered, pipelines)
+	if len(ordered) < 2 {
+		return ordered
+	}
+	// The counters change while the pipelines are sorted, they are read once
+	// so the comparisons are consistent.
+	switch b.strategy {
+	case StrategyLeastInFlight:
+		inFlight := make(map[*pipeline]int64, len(ordered))
+		for _, p := range ordered {
+			inFlight[p] = p.guard.inFlightCount()
+		}
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return inFlight[ordered[i]] < inFlight[ordered[j]]
+		})
+	case StrategyCapacity:
+		load := make(map[*pipeline]float64, len(ordered))
+		for _, p := range ordered {
+			load[p] = 1 // Pipelines whose jobs cannot be counted are tried last.
+			if active == nil || !p.available() {
+				continue
+			}
+			if n, err := active(p.client); err == nil {
+				load[p] = float64(n) / float64(p.capacity)
+			}
+		}
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return load[ordered[i]] < load[ordered[j]]
+		})
+	default:
+		n := int(atomic.AddUint32(b.cursor, 1)-1) % len(ordered)
+		for i := range ordered {
+			ordered[i] = pipelines[(n+i)%len(pipelines)]
+		}
+	}
+	available := make(map[*pipeline]bool, len(ordered))
+	for _, p := range ordered {
+		available[p] = p.available()
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return available[ordered[i]] && !available[ordered[j]]
+	})
+	return ordered
+}
+
+// pipelineStrategy returns the strategy requested by the record. Unknown
+// strategies are reported and round robin is used instead.
+func (r *Registry) pipelineStrategy(rec RegistryRecord) string {
+	switch rec.PipelineStrategy {
+	case "":
+		return StrategyRoundRobin
+	case StrategyRoundRobin, StrategyLeastInFlight, StrategyCapacity:
+		return rec.PipelineStrategy
+	}
+	r.logger.WithFields(logrus.Fields{
+		"tenantJiscID":     rec.TenantJiscID,
+		"pipelineStrategy": rec.PipelineStrategy,
+	}).Error("Unknown pipeline strategy ignored")
+	return StrategyRoundRobin
+}
+
+// errNoPipeline is returned when none of the pipelines of a tenant could take
+// a transfer.
+var errNoPipeline = errors.New("no pipeline available")
+
+// selectPipeline tries the pipelines of a tenant in the order given by its
+// strategy until start succeeds. The following pipeline is tried when start
+// fails because the pipeline is not available, see failover. The pipeline is
+// counted as in-flight until done is called, which must happen once the
+// transfer is completed.
+func (r *Registry) selectPipeline(ctx context.Context, tenantID uint64, active activeJobs, start func(Pipeline) error) (p Pipeline, done func(), err error) {
+	r.RLock()
+	t, ok := r.r[tenantID]
+	r.RUnlock()
+	if !ok {
+		return Pipeline{}, nil, UnknownTenantErr
+	}
+	err = errNoPipeline
+	for _, pl := range t.balancer.order(t.pipelines, active) {
+		p = Pipeline{ID: pl.id, Client: pl.client}
+		pl.guard.add(1)
+		if err = start(p); err == nil {
+			guard := pl.guard
+			return p, func() { guard.add(-1) }, nil
+		}
+		pl.guard.add(-1)
+		if !failover(ctx, err) {
+			break
+		}
+		r.logger.WithError(err).WithFields(logrus.Fields{
+			"tenantJiscID": tenantID,
+			"pipeline":     pl.id,
+		}).Warn("Pipeline not available, trying the next one")
+	}
+	return Pipeline{}, nil, err
+}
+
+// trackPipeline counts a transfer started before, e.g. by a handler that is
+// retried, as in-flight in a pipeline of a tenant until done is called, like
+// selectPipeline does with the transfers it starts. Nothing is counted when
+// the pipeline is no longer in the registry.
+func (r *Registry) trackPipeline(tenantID uint64, pipelineID string) (done func()) {
+	r.RLock()
+	t, ok := r.r[tenantID]
+	r.RUnlock()
+	if !ok {
+		return func() {}
+	}
+	for i, pl := range t.pipelines {
+		if pl.id == pipelineID || (pipelineID == "" && i == 0) {
+			guard := pl.guard
+			guard.add(1)
+			return func() { guard.add(-1) }
+		}
+	}
+	return func() {}
+}
+
+// failover reports whether the error returned starting a transfer means that
+// the pipeline is not available, in which case the next one can be tried. It
+// is only the case when the transfer cannot have been started: the circuit
+// breaker is open, the pipeline refused the connection or its transfer
+// directory could not be used. Other errors, e.g. timeouts or server errors
+// returned once the transfer was requested, are returned as starting a
+// transfer is not idempotent.
+func failover(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if errors.Is(err, amclient.ErrCircuitOpen) {
+		return true
+	}
+	var startErr *amclient.TransferStartError
+	if errors.As(err, &startErr) {
+		return errors.Is(err, syscall.ECONNREFUSED)
+	}
+	var unavailable *pipelineUnavailableError
+	return errors.As(err, &unavailable)
+}
+
+// pipelineUnavailableError is returned when the transfer cannot be prepared
+// in the pipeline, e.g. because its transfer directory cannot be written.
+type pipelineUnavailableError struct {
+	err error
+}
+
+func (e *pipelineUnavailableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *pipelineUnavailableError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,234 @@
+package adapter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/amclient"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_pipelines(t *testing.T) {
+	pipelineAttr := func(ID, URL string) *dynamodb.AttributeValue {
+		return &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{
+			"id":       {S: aws.String(ID)},
+			"url":      {S: aws.String(URL)},
+			"user":     {S: aws.String("user-" + ID)},
+			"capacity": {N: aws.String("4")},
+		}}
+	}
+	m := &dynamock{}
+	m.On(
+		"ScanWithContext",
+		mock.AnythingOfType("*context.cancelCtx"),
+		mock.Anything,
+	).Return(&dynamodb.ScanOutput{
+		Items: []map[string]*dynamodb.AttributeValue{
+			{
+				"tenantJiscID":     {S: aws.String("1")},
+				"url":              {S: aws.String("http://a.example.com")},
+				"pipelineStrategy": {S: aws.String("least in-flight")},
+				"pipelines": {L: []*dynamodb.AttributeValue{
+					pipelineAttr("b", "http://b.example.com"),
+					pipelineAttr("", "http://unnamed.example.com"),
+					pipelineAttr("default", "http://duplicated.example.com"),
+				}},
+			},
+			{
+				"tenantJiscID":     {S: aws.String("2")},
+				"pipelineStrategy": {S: aws.String("random")},
+				"pipelines": {L: []*dynamodb.AttributeValue{
+					pipelineAttr("c", "http://c.example.com"),
+				}},
+			},
+		},
+	}, nil)
+
+	r, err := NewRegistry(logrus.StandardLogger(), m, "mockTable")
+	require.NoError(t, err)
+	defer r.Stop()
+
+	pipelines := r.Pipelines()
+	require.Len(t, pipelines[1], 2)
+	assert.Equal(t, "default", pipelines[1][0].ID)
+	assert.Equal(t, "http://a.example.com", pipelines[1][0].Client.BaseURL.String())
+	assert.Equal(t, "b", pipelines[1][1].ID)
+	assert.Equal(t, "user-b", pipelines[1][1].Client.User)
+	require.Len(t, pipelines[2], 1)
+	assert.Equal(t, "c", pipelines[2][0].ID)
+
+	assert.Equal(t, pipelines[1][0].Client, r.Get(1))
+	assert.Equal(t, pipelines[1][0].Client, r.Pipeline(1, ""))
+	assert.Equal(t, pipelines[1][1].Client, r.Pipeline(1, "b"))
+	assert.Nil(t, r.Pipeline(1, "c"))
+	assert.Nil(t, r.Pipeline(3, ""))
+
+	assert.Equal(t, StrategyLeastInFlight, r.r[1].balancer.strategy)
+	assert.Equal(t, 4, r.r[1].pipelines[1].capacity)
+	assert.Equal(t, StrategyRoundRobin, r.r[2].balancer.strategy)
+}
+
+func testPipelines(IDs ...string) []*pipeline {
+	pipelines := make([]*pipeline, 0, len(IDs))
+	for _, ID := range IDs {
+		c, _ := amclient.New(nil, "http://"+ID+".example.com", "", "")
+		pipelines = append(pipelines, &pipeline{id: ID, client: c, guard: &pipelineGuard{}, capacity: 1})
+	}
+	return pipelines
+}
+
+func pipelineIDs(pipelines []*pipeline) []string {
+	IDs := make([]string, 0, len(pipelines))
+	for _, p := range pipelines {
+		IDs = append(IDs, p.id)
+	}
+	return IDs
+}
+
+func TestBalancer_order(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("round robin", func(t *testing.T) {
+		pipelines := testPipelines("a", "b", "c")
+		b := &balancer{strategy: StrategyRoundRobin, cursor: new(uint32)}
+		assert.Equal(t, []string{"a", "b", "c"}, pipelineIDs(b.order(pipelines, nil)))
+		assert.Equal(t, []string{"b", "c", "a"}, pipelineIDs(b.order(pipelines, nil)))
+		assert.Equal(t, []string{"c", "a", "b"}, pipelineIDs(b.order(pipelines, nil)))
+		assert.Equal(t, []string{"a", "b", "c"}, pipelineIDs(b.order(pipelines, nil)))
+	})
+
+	t.Run("least in-flight", func(t *testing.T) {
+		pipelines := testPipelines("a", "b", "c")
+		pipelines[0].guard.add(2)
+		pipelines[2].guard.add(1)
+		b := &balancer{strategy: StrategyLeastInFlight, cursor: new(uint32)}
+		assert.Equal(t, []string{"b", "c", "a"}, pipelineIDs(b.order(pipelines, nil)))
+	})
+
+	t.Run("capacity", func(t *testing.T) {
+		pipelines := testPipelines("a", "b", "c")
+		pipelines[0].capacity = 10
+		active := func(c *amclient.Client) (int, error) {
+			switch c.BaseURL.Host {
+			case "a.example.com":
+				return 5, nil
+			case "b.example.com":
+				return 0, errors.New("unreachable")
+			default:
+				return 0, nil
+			}
+		}
+		b := &balancer{strategy: StrategyCapacity, cursor: new(uint32)}
+		assert.Equal(t, []string{"c", "a", "b"}, pipelineIDs(b.order(pipelines, active)))
+	})
+
+	t.Run("open breaker", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+		pipelines := testPipelines("a", "b")
+		pipelines[0].guard.breaker = amclient.NewCircuitBreaker(1, time.Hour)
+		pipelines[0].client, _ = amclient.New(nil, server.URL, "", "", amclient.SetCircuitBreaker(pipelines[0].guard.breaker))
+		_, _, _ = pipelines[0].client.Jobs.List(ctx, "unit", &amclient.JobsListRequest{})
+		require.Equal(t, amclient.BreakerOpen, pipelines[0].guard.breaker.State())
+
+		b := &balancer{strategy: StrategyRoundRobin, cursor: new(uint32)}
+		assert.Equal(t, []string{"b", "a"}, pipelineIDs(b.order(pipelines, nil)))
+	})
+}
+
+func TestRegistry_selectPipeline(t *testing.T) {
+	ctx := context.Background()
+	r := &Registry{
+		logger: logrus.StandardLogger(),
+		r: map[uint64]*tenant{
+			1: {
+				pipelines: testPipelines("a", "b", "c"),
+				balancer:  &balancer{strategy: StrategyRoundRobin, cursor: new(uint32)},
+			},
+		},
+	}
+
+	// "a" is not available, "b" takes the transfer.
+	var tried []string
+	p, done, err := r.selectPipeline(ctx, 1, nil, func(p Pipeline) error {
+		tried = append(tried, p.ID)
+		if p.ID == "a" {
+			return errors.Wrap(amclient.ErrCircuitOpen, "transfer cannot be started")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "b", p.ID)
+	assert.Equal(t, []string{"a", "b"}, tried)
+	assert.Equal(t, int64(1), r.r[1].pipelines[1].guard.inFlightCount())
+	done()
+	assert.Equal(t, int64(0), r.r[1].pipelines[1].guard.inFlightCount())
+	assert.Equal(t, int64(0), r.r[1].pipelines[0].guard.inFlightCount())
+
+	// Errors caused by the transfer are not retried elsewhere.
+	tried = nil
+	_, _, err = r.selectPipeline(ctx, 1, nil, func(p Pipeline) error {
+		tried = append(tried, p.ID)
+		return errors.New("file cannot be downloaded")
+	})
+	assert.EqualError(t, err, "file cannot be downloaded")
+	assert.Equal(t, []string{"b"}, tried)
+
+	_, _, err = r.selectPipeline(ctx, 2, nil, func(p Pipeline) error { return nil })
+	assert.Equal(t, UnknownTenantErr, err)
+}
+
+func TestRegistry_selectPipeline_started(t *testing.T) {
+	ctx := context.Background()
+	requests := map[string]int{}
+	newPipeline := func(ID string, status int) *pipeline {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests[ID]++
+			w.WriteHeader(status)
+			w.Write([]byte(`{"id": "53e80f90-0d34-4103-8583-8d86cbf70069"}`))
+		}))
+		t.Cleanup(server.Close)
+		c, _ := amclient.New(nil, server.URL, "", "", amclient.SetFsPath(t.TempDir()))
+		return &pipeline{id: ID, client: c, guard: &pipelineGuard{}, capacity: 1}
+	}
+	refused := newPipeline("refused", http.StatusAccepted)
+	refused.client.BaseURL.Host = "127.0.0.1:1"
+	r := &Registry{
+		logger: logrus.StandardLogger(),
+		r: map[uint64]*tenant{
+			1: {
+				pipelines: []*pipeline{refused, newPipeline("a", http.StatusBadGateway), newPipeline("b", http.StatusAccepted)},
+				balancer:  &balancer{strategy: StrategyRoundRobin, cursor: new(uint32)},
+			},
+		},
+	}
+	start := func(p Pipeline) error {
+		ts, err := p.Client.TransferSession("Test")
+		if err != nil {
+			return err
+		}
+		defer ts.Destroy()
+		_, err = ts.Start(ctx)
+		return err
+	}
+
+	// The connection refused by the first pipeline is tried in the next one,
+	// the server error returned by "a" may come from a transfer started.
+	_, _, err := r.selectPipeline(ctx, 1, nil, start)
+	var errResp *amclient.ErrorResponse
+	require.True(t, errors.As(err, &errResp), "unexpected error: %v", err)
+	assert.Equal(t, http.StatusBadGateway, errResp.Response.StatusCode)
+	assert.Equal(t, map[string]int{"a": 1}, requests)
+}
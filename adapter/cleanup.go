@@ -0,0 +1,70 @@
+package adapter
+
+import (
+	"context"
+	"time"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/amclient"
+
+	"github.com/sirupsen/logrus"
+)
+
+// cleanupTransfer removes the transfer and the SIP from the Dashboard once the
+// AIP is stored and deletes the transfer source directory. Failures are only
+// logged since the package has been preserved already.
+func (c *Adapter) cleanupTransfer(amClient *amclient.Client, t *amclient.TransferSession, transferID, SIPID string) {
+	logger := c.logger.WithFields(logrus.Fields{"transfer": transferID, "sip": SIPID})
+	if _, _, err := amClient.Transfer.Hide(c.ctx, transferID); err != nil {
+		logger.WithError(err).Warn("Completed transfer cannot be removed from the Dashboard")
+	}
+	if _, _, err := amClient.Ingest.Hide(c.ctx, SIPID); err != nil {
+		logger.WithError(err).Warn("Completed SIP cannot be removed from the Dashboard")
+	}
+	if t == nil {
+		return
+	}
+	if err := t.Destroy(); err != nil {
+		logger.WithError(err).Warn("Transfer source directory cannot be deleted")
+	}
+}
+
+// janitor periodically removes the directories of the transfer sessions left
+// behind in the transfer directories of the tenants, e.g. by sessions that
+// crashed or by transfers that were not cleaned up.
+type janitor struct {
+	logger    logrus.FieldLogger
+	pipelines func() map[uint64][]Pipeline
+	interval  time.Duration
+	maxAge    time.Duration
+}
+
+// run sweeps the transfer directories every interval until the context is
+// canceled.
+func (j *janitor) run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			j.sweep()
+		}
+	}
+}
+
+// sweep removes the directories of the transfer sessions older than maxAge.
+func (j *janitor) sweep() {
+	for tenantID, pipelines := range j.pipelines() {
+		for _, p := range pipelines {
+			logger := j.logger.WithFields(logrus.Fields{"tenantJiscID": tenantID, "pipeline": p.ID})
+			removed, err := p.Client.SweepTransferSessions(j.maxAge)
+			if err != nil {
+				logger.WithError(err).Error("Transfer directory cannot be swept")
+			}
+			for _, name := range removed {
+				logger.WithField("name", name).Info("Stale transfer session removed")
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/amclient"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCleanupTransfer(t *testing.T) {
+	const (
+		transferID = "e99afef7-90c5-4fd9-bf8f-bed13b3bd4ba"
+		SIPID      = "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0"
+	)
+	hidden := []string{}
+	mux := http.NewServeMux()
+	for _, path := range []string{"/api/transfer/" + transferID + "/delete/", "/api/ingest/" + SIPID + "/delete/"} {
+		path := path
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "DELETE", r.Method)
+			hidden = append(hidden, path)
+			fmt.Fprint(w, `{"removed": true}`)
+		})
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	dir := t.TempDir()
+	c, _ := amclient.New(nil, server.URL, "", "", amclient.SetFsPath(dir))
+	ts, err := c.TransferSession("Test")
+	require.NoError(t, err)
+	f, _ := ts.Create("bird.mp3")
+	f.Close()
+
+	a := &Adapter{logger: logrus.StandardLogger(), ctx: context.Background()}
+	a.cleanupTransfer(c, ts, transferID, SIPID)
+
+	assert.Equal(t, []string{"/api/transfer/" + transferID + "/delete/", "/api/ingest/" + SIPID + "/delete/"}, hidden)
+	entries, _ := afero.ReadDir(afero.NewOsFs(), dir)
+	assert.Empty(t, entries, "transfer source directory not deleted")
+}
+
+func TestJanitor(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	c, _ := amclient.New(nil, "http://localhost", "", "", amclient.SetFs(fs))
+	old := time.Now().Add(-time.Hour * 2)
+	afero.WriteFile(fs, "/amclientTransfer1/bird.mp3", []byte("bird"), 0o644)
+	fs.Chtimes("/amclientTransfer1/bird.mp3", old, old)
+	fs.Chtimes("/amclientTransfer1", old, old)
+	afero.WriteFile(fs, "/amclientTransfer2/bird.mp3", []byte("bird"), 0o644)
+
+	j := &janitor{
+		logger:    logrus.StandardLogger(),
+		pipelines: func() map[uint64][]Pipeline { return map[uint64][]Pipeline{1: {{ID: "default", Client: c}}} },
+		interval:  time.Millisecond,
+		maxAge:    time.Hour,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go j.run(ctx)
+
+	assert.Eventually(t, func() bool {
+		exists, _ := afero.Exists(fs, "/amclientTransfer1")
+		return !exists
+	}, time.Second, time.Millisecond*10)
+	exists, _ := afero.Exists(fs, "/amclientTransfer2")
+	assert.True(t, exists)
+}
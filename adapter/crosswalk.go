@@ -0,0 +1,491 @@
+package adapter
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/amclient"
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/broker/message"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// crosswalk is a declarative mapping of research objects into the transfer
+// metadata that tenants can use to extend or replace the built-in mapping
+// implemented by describeDataset, describeSubtype and describeFile.
+//
+// It is loaded from the file referenced by the registry record of the tenant.
+// The format is determined by the file extension, e.g. TOML:
+//
+//	# Do not use the built-in mapping, defaults to false.
+//	replace = false
+//
+//	[[dataset]]
+//	field = "dc.contributor"
+//	path = "objectOrganisationRole[role=funder].organisation.organisationName"
+//
+//	[[dataset]]
+//	field = "dc.creatorName"
+//	path = "objectPersonRole[role=dataCreator].person"
+//	template = "{personFamilyNames}, {personGivenNames} {personIdentifier[personIdentifierType=ORCID].personIdentifierValue}"
+//
+//	[[file]]
+//	field = "dc.format"
+//	path = "filePuid"
+//
+// A path is a list of properties of the RDSS data model separated by dots.
+// Lists are traversed and can be filtered by the value of a property of their
+// items. Every value found produces a metadata entry. The root of the dataset
+// paths is the research object (or the article, dataset, thesis...) and the
+// root of the file paths is each file.
+//
+// Paths must point to a single value, e.g. a string, an enumeration or a date,
+// unless a template is given. The placeholders in the template are paths
+// relative to the values found, where only the first value is used.
+type crosswalk struct {
+	Replace bool               `mapstructure:"replace"`
+	Dataset []crosswalkMapping `mapstructure:"dataset"`
+	File    []crosswalkMapping `mapstructure:"file"`
+
+	// path is the location of the crosswalk file.
+	path string
+}
+
+type crosswalkMapping struct {
+	Field    string `mapstructure:"field"`
+	Path     string `mapstructure:"path"`
+	Template string `mapstructure:"template"`
+
+	path     crosswalkPath
+	template []crosswalkTemplatePart
+}
+
+type crosswalkTemplatePart struct {
+	text string
+	path crosswalkPath // Non-nil when the part is a placeholder.
+}
+
+// crosswalkPath is a compiled path expression.
+type crosswalkPath []crosswalkStep
+
+type crosswalkStep struct {
+	property    string
+	filterName  string
+	filterValue string
+}
+
+var (
+	// crosswalkDatasetRoots are the types accepted in the root of the dataset
+	// paths. A path is valid when it can be resolved in any of them.
+	crosswalkDatasetRoots = []reflect.Type{
+		reflect.TypeOf(message.ResearchObject{}),
+		reflect.TypeOf(message.Article{}),
+		reflect.TypeOf(message.Dataset{}),
+		reflect.TypeOf(message.ThesisDissertation{}),
+	}
+
+	// crosswalkFileRoots are the types accepted in the root of the file paths.
+	crosswalkFileRoots = []reflect.Type{
+		reflect.TypeOf(message.File{}),
+	}
+
+	timestampType = reflect.TypeOf(message.Timestamp{})
+	stringerType  = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+)
+
+// loadCrosswalk reads and validates a crosswalk file.
+func loadCrosswalk(path string) (*crosswalk, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, errors.Wrap(err, "cannot read crosswalk")
+	}
+	cw := &crosswalk{path: path}
+	if err := v.Unmarshal(cw); err != nil {
+		return nil, errors.Wrap(err, "cannot decode crosswalk")
+	}
+	if err := cw.compile(); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+// compile parses and validates the path expressions of the mappings.
+func (cw *crosswalk) compile() error {
+	for i := range cw.Dataset {
+		if err := cw.Dataset[i].compile(crosswalkDatasetRoots); err != nil {
+			return errors.Wrapf(err, "invalid dataset mapping #%d", i+1)
+		}
+	}
+	for i := range cw.File {
+		if err := cw.File[i].compile(crosswalkFileRoots); err != nil {
+			return errors.Wrapf(err, "invalid file mapping #%d", i+1)
+		}
+	}
+	return nil
+}
+
+// describeDataset maps the properties of a research object. The built-in
+// mapping is also applied unless the crosswalk replaces it. It is safe to use
+// with a nil crosswalk.
+func (cw *crosswalk) describeDataset(t *amclient.TransferSession, f *message.ResearchObject, b *message.ResearchObjectBase) {
+	if cw == nil || !cw.Replace {
+		describeDataset(t, f)
+		describeSubtype(t, b)
+	}
+	if cw == nil {
+		return
+	}
+	root := reflect.ValueOf(researchObjectInstance(b, f))
+	for _, m := range cw.Dataset {
+		for _, value := range m.values(root) {
+			t.Describe(m.Field, value)
+		}
+	}
+}
+
+// describeFile maps the properties of a file. The built-in mapping is also
+// applied unless the crosswalk replaces it. It is safe to use with a nil
+// crosswalk.
+func (cw *crosswalk) describeFile(t *amclient.TransferSession, name string, f *message.File) {
+	if cw == nil || !cw.Replace {
+		describeFile(t, name, f)
+	}
+	if cw == nil {
+		return
+	}
+	n := fmt.Sprintf("objects/%s", name)
+	root := reflect.ValueOf(f)
+	for _, m := range cw.File {
+		for _, value := range m.values(root) {
+			t.DescribeFile(n, m.Field, value)
+		}
+	}
+}
+
+// researchObjectInstance returns the subtype held by the base so its specific
+// properties can be reached, e.g. the journal of an article.
+func researchObjectInstance(b *message.ResearchObjectBase, f *message.ResearchObject) interface{} {
+	switch {
+	case b.Article != nil:
+		return b.Article
+	case b.Dataset != nil:
+		return b.Dataset
+	case b.ThesisDissertation != nil:
+		return b.ThesisDissertation
+	}
+	return f
+}
+
+func (m *crosswalkMapping) compile(roots []reflect.Type) error {
+	if m.Field == "" {
+		return errors.New("field is empty")
+	}
+	var err error
+	if m.path, err = parseCrosswalkPath(m.Path); err != nil {
+		return err
+	}
+	if m.Template != "" {
+		if m.template, err = parseCrosswalkTemplate(m.Template); err != nil {
+			return err
+		}
+	}
+	// The first error is reported when the mapping does not fit any root.
+	var first error
+	for _, root := range roots {
+		err := m.check(root)
+		if err == nil {
+			return nil
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// check determines whether the mapping can be applied to the given root.
+func (m *crosswalkMapping) check(root reflect.Type) error {
+	t, err := m.path.resolve(root)
+	if err != nil {
+		return err
+	}
+	if m.template == nil {
+		if !isScalar(t) {
+			return errors.Errorf("path %q does not point to a single value, use a template", m.Path)
+		}
+		return nil
+	}
+	for _, part := range m.template {
+		if part.path == nil {
+			continue
+		}
+		pt, err := part.path.resolve(t)
+		if err != nil {
+			return errors.Wrap(err, "invalid template")
+		}
+		if !isScalar(pt) {
+			return errors.Errorf("template placeholder %q does not point to a single value", part.text)
+		}
+	}
+	return nil
+}
+
+// values returns the non-empty values produced by the mapping.
+func (m *crosswalkMapping) values(root reflect.Value) []string {
+	ret := []string{}
+	for _, v := range m.path.eval(root) {
+		var value string
+		if m.template == nil {
+			value = formatValue(v)
+		} else {
+			value = m.render(v)
+		}
+		if value != "" {
+			ret = append(ret, value)
+		}
+	}
+	return ret
+}
+
+func (m *crosswalkMapping) render(v reflect.Value) string {
+	var sb strings.Builder
+	for _, part := range m.template {
+		if part.path == nil {
+			sb.WriteString(part.text)
+			continue
+		}
+		if values := part.path.eval(v); len(values) > 0 {
+			sb.WriteString(formatValue(values[0]))
+		}
+	}
+	// Collapse the spaces left behind by the placeholders with no values.
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
+// parseCrosswalkPath parses path expressions such as
+// "objectPersonRole[role=dataCreator].person.personGivenNames".
+func parseCrosswalkPath(expr string) (crosswalkPath, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, errors.New("path is empty")
+	}
+	path := crosswalkPath{}
+	for _, elem := range strings.Split(expr, ".") {
+		step := crosswalkStep{property: strings.TrimSpace(elem)}
+		if i := strings.Index(elem, "["); i >= 0 {
+			if !strings.HasSuffix(elem, "]") {
+				return nil, errors.Errorf("path %q has an unterminated filter", expr)
+			}
+			filter := strings.SplitN(elem[i+1:len(elem)-1], "=", 2)
+			if len(filter) != 2 {
+				return nil, errors.Errorf("path %q has a filter without value, e.g. [role=author]", expr)
+			}
+			step.property = strings.TrimSpace(elem[:i])
+			step.filterName = strings.TrimSpace(filter[0])
+			step.filterValue = strings.TrimSpace(filter[1])
+			if step.filterName == "" {
+				return nil, errors.Errorf("path %q has a filter without property", expr)
+			}
+		}
+		if step.property == "" {
+			return nil, errors.Errorf("path %q has an empty property", expr)
+		}
+		path = append(path, step)
+	}
+	return path, nil
+}
+
+// parseCrosswalkTemplate parses templates such as "{personFamilyNames},
+// {personGivenNames}".
+func parseCrosswalkTemplate(tmpl string) ([]crosswalkTemplatePart, error) {
+	parts := []crosswalkTemplatePart{}
+	rest := tmpl
+	for rest != "" {
+		i := strings.IndexAny(rest, "{}")
+		if i < 0 {
+			parts = append(parts, crosswalkTemplatePart{text: rest})
+			break
+		}
+		if rest[i] == '}' {
+			return nil, errors.Errorf("template %q has an unexpected \"}\"", tmpl)
+		}
+		if i > 0 {
+			parts = append(parts, crosswalkTemplatePart{text: rest[:i]})
+		}
+		j := strings.Index(rest[i:], "}")
+		if j < 0 {
+			return nil, errors.Errorf("template %q has an unterminated placeholder", tmpl)
+		}
+		expr := rest[i+1 : i+j]
+		path, err := parseCrosswalkPath(expr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "template %q", tmpl)
+		}
+		parts = append(parts, crosswalkTemplatePart{text: expr, path: path})
+		rest = rest[i+j+1:]
+	}
+	return parts, nil
+}
+
+// resolve returns the type of the values found by the path starting from the
+// given type, or an error if the path cannot be followed.
+func (p crosswalkPath) resolve(t reflect.Type) (reflect.Type, error) {
+	for _, step := range p {
+		t = elemType(t)
+		if t.Kind() != reflect.Struct || isScalar(t) {
+			return nil, errors.Errorf("property %q cannot be found in a single value", step.property)
+		}
+		field, ok := lookupProperty(t, step.property)
+		if !ok {
+			return nil, errors.Errorf("property %q cannot be found in %s", step.property, t.Name())
+		}
+		t = elemType(field.Type)
+		if step.filterName == "" {
+			continue
+		}
+		if t.Kind() != reflect.Struct || isScalar(t) {
+			return nil, errors.Errorf("property %q cannot be filtered", step.property)
+		}
+		filter, ok := lookupProperty(t, step.filterName)
+		if !ok {
+			return nil, errors.Errorf("property %q cannot be found in %s", step.filterName, t.Name())
+		}
+		if !isScalar(elemType(filter.Type)) {
+			return nil, errors.Errorf("property %q cannot be used in a filter", step.filterName)
+		}
+	}
+	return elemType(t), nil
+}
+
+// eval returns the values found by the path starting from the given value.
+func (p crosswalkPath) eval(v reflect.Value) []reflect.Value {
+	values := expandValue(v)
+	for _, step := range p {
+		next := []reflect.Value{}
+		for _, v := range values {
+			if v.Kind() != reflect.Struct {
+				continue
+			}
+			field, ok := lookupProperty(v.Type(), step.property)
+			if !ok {
+				continue // E.g. a property of a different subtype.
+			}
+			for _, item := range expandValue(v.FieldByIndex(field.Index)) {
+				if step.matches(item) {
+					next = append(next, item)
+				}
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+func (s crosswalkStep) matches(v reflect.Value) bool {
+	if s.filterName == "" {
+		return true
+	}
+	if v.Kind() != reflect.Struct {
+		return false
+	}
+	field, ok := lookupProperty(v.Type(), s.filterName)
+	if !ok {
+		return false
+	}
+	for _, item := range expandValue(v.FieldByIndex(field.Index)) {
+		if formatValue(item) == s.filterValue {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupProperty finds the field of a struct by the name of the property in
+// the RDSS data model, i.e. the name used in the JSON encoding.
+func lookupProperty(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue // Unexported.
+		}
+		prop := strings.Split(field.Tag.Get("json"), ",")[0]
+		if prop == "" {
+			prop = field.Name
+		}
+		if strings.EqualFold(prop, name) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// elemType dereferences pointers and lists.
+func elemType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t
+}
+
+// expandValue dereferences pointers and lists, e.g. it returns the items of a
+// list of pointers.
+func expandValue(v reflect.Value) []reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return expandValue(v.Elem())
+	case reflect.Slice:
+		ret := []reflect.Value{}
+		for i := 0; i < v.Len(); i++ {
+			ret = append(ret, expandValue(v.Index(i))...)
+		}
+		return ret
+	case reflect.Invalid:
+		return nil
+	}
+	return []reflect.Value{v}
+}
+
+// isScalar reports whether values of the given type can be written in the
+// metadata, e.g. strings, numbers, enumerations, dates or identifiers.
+func isScalar(t reflect.Type) bool {
+	if t == timestampType || t.Implements(stringerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func formatValue(v reflect.Value) string {
+	if v.Type() == timestampType {
+		value, _ := formatDate(v.Interface().(message.Timestamp))
+		return value
+	}
+	if v.Type().Implements(stringerType) {
+		return v.Interface().(fmt.Stringer).String()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	}
+	return ""
+}
@@ -0,0 +1,265 @@
+package adapter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/broker/message"
+)
+
+const testCrosswalkTOML = `
+[[dataset]]
+field = "dc.contributor"
+path = "objectOrganisationRole[role=funder].organisation.organisationName"
+
+[[dataset]]
+field = "dc.creatorName"
+path = "objectPersonRole[role=dataCreator].person"
+template = "{personFamilyNames}, {personGivenNames} {personIdentifier[personIdentifierType=ORCID].personIdentifierValue}"
+
+[[dataset]]
+field = "dcterms.isPartOf"
+path = "journal.fullTitle"
+
+[[file]]
+field = "dc.format"
+path = "filePuid"
+`
+
+const testCrosswalkYAML = `
+replace: true
+dataset:
+  - field: dc.title
+    path: objectTitle
+  - field: dc.date
+    path: objectDate[dateType=published].dateValue
+file:
+  - field: dc.title
+    path: fileName
+`
+
+func writeCrosswalk(t *testing.T, name, contents string) string {
+	dir, err := ioutil.TempDir("", "crosswalk")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(contents), 0644))
+	return path
+}
+
+func TestLoadCrosswalk(t *testing.T) {
+	t.Parallel()
+
+	cw, err := loadCrosswalk(writeCrosswalk(t, "crosswalk.toml", testCrosswalkTOML))
+	assert.NoError(t, err)
+	assert.False(t, cw.Replace)
+	assert.Len(t, cw.Dataset, 3)
+	assert.Len(t, cw.File, 1)
+
+	cw, err = loadCrosswalk(writeCrosswalk(t, "crosswalk.yaml", testCrosswalkYAML))
+	assert.NoError(t, err)
+	assert.True(t, cw.Replace)
+	assert.Len(t, cw.Dataset, 2)
+	assert.Len(t, cw.File, 1)
+
+	_, err = loadCrosswalk("/does/not/exist.toml")
+	assert.Error(t, err)
+}
+
+func TestLoadCrosswalk_invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		contents string
+		err      string
+	}{
+		"Missing field": {
+			`[[dataset]]
+path = "objectTitle"`,
+			"invalid dataset mapping #1: field is empty",
+		},
+		"Missing path": {
+			`[[dataset]]
+field = "dc.title"`,
+			"invalid dataset mapping #1: path is empty",
+		},
+		"Unknown property": {
+			`[[dataset]]
+field = "dc.title"
+path = "objectTitle"
+
+[[dataset]]
+field = "dc.title"
+path = "objectName"`,
+			`invalid dataset mapping #2: property "objectName" cannot be found in ResearchObject`,
+		},
+		"Unknown file property": {
+			`[[file]]
+field = "dc.title"
+path = "objectTitle"`,
+			`invalid file mapping #1: property "objectTitle" cannot be found in File`,
+		},
+		"Unknown filter property": {
+			`[[dataset]]
+field = "dc.contributor"
+path = "objectPersonRole[kind=author].person.personGivenNames"`,
+			`invalid dataset mapping #1: property "kind" cannot be found in PersonRole`,
+		},
+		"Object without template": {
+			`[[dataset]]
+field = "dc.contributor"
+path = "objectPersonRole.person"`,
+			`invalid dataset mapping #1: path "objectPersonRole.person" does not point to a single value, use a template`,
+		},
+		"Invalid template": {
+			`[[dataset]]
+field = "dc.contributor"
+path = "objectPersonRole.person"
+template = "{personFamilyNames"`,
+			`invalid dataset mapping #1: template "{personFamilyNames" has an unterminated placeholder`,
+		},
+		"Unknown template property": {
+			`[[dataset]]
+field = "dc.contributor"
+path = "objectPersonRole.person"
+template = "{personName}"`,
+			`invalid dataset mapping #1: invalid template: property "personName" cannot be found in Person`,
+		},
+		"Invalid filter": {
+			`[[dataset]]
+field = "dc.contributor"
+path = "objectPersonRole[role].person.personGivenNames"`,
+			`invalid dataset mapping #1: path "objectPersonRole[role].person.personGivenNames" has a filter without value, e.g. [role=author]`,
+		},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			_, err := loadCrosswalk(writeCrosswalk(t, "crosswalk.toml", tc.contents))
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+func TestCrosswalk_describeDataset(t *testing.T) {
+	t.Parallel()
+
+	article := &message.Article{
+		ObjectTitle: "Title",
+		ObjectPersonRole: []message.PersonRole{
+			{
+				Role: message.PersonRoleEnum_dataCreator,
+				Person: message.Person{
+					PersonGivenNames:  "Kat",
+					PersonFamilyNames: "Winter",
+					PersonIdentifier: []message.PersonIdentifier{
+						{PersonIdentifierType: message.PersonIdentifierTypeEnum_researcherID, PersonIdentifierValue: "A-1234-2010"},
+						{PersonIdentifierType: message.PersonIdentifierTypeEnum_ORCID, PersonIdentifierValue: "0000-0002-1825-0097"},
+					},
+				},
+			},
+			{
+				Role:   message.PersonRoleEnum_dataCreator,
+				Person: message.Person{PersonGivenNames: "Joan", PersonFamilyNames: "Watson"},
+			},
+			{
+				Role:   message.PersonRoleEnum_editor,
+				Person: message.Person{PersonGivenNames: "Ann", PersonFamilyNames: "Smith"},
+			},
+		},
+		ObjectOrganisationRole: []message.OrganisationRole{
+			{Role: message.OrganisationRoleEnum_publisher, Organisation: message.Organisation{OrganisationName: "Jisc"}},
+			{Role: message.OrganisationRoleEnum_funder, Organisation: message.Organisation{OrganisationName: "UKRI"}},
+		},
+		ObjectDate: []message.Date{
+			{DateType: message.DateTypeEnum_published, DateValue: date(2017, time.March, 17)},
+		},
+		Journal: message.Journal{FullTitle: "Nature"},
+	}
+	base := &message.ResearchObjectBase{Article: article}
+
+	t.Run("Extends the built-in mapping", func(t *testing.T) {
+		t.Parallel()
+		cw, err := loadCrosswalk(writeCrosswalk(t, "crosswalk.toml", testCrosswalkTOML))
+		require.NoError(t, err)
+
+		ts := newMetadataTransferSession()
+		cw.describeDataset(ts, base.InferResearchObject(), base)
+
+		entries := ts.Metadata.Entries()["objects/"]
+		assert.Subset(t, entries, [][2]string{
+			{"dc.title", "Title"},
+			{"dc.creatorName", "Winter, Kat"},
+		})
+		assert.Equal(t, [][2]string{
+			{"dc.contributor", "UKRI"},
+			{"dc.creatorName", "Winter, Kat 0000-0002-1825-0097"},
+			{"dc.creatorName", "Watson, Joan"},
+			{"dcterms.isPartOf", "Nature"},
+		}, entries[len(entries)-4:])
+	})
+
+	t.Run("Replaces the built-in mapping", func(t *testing.T) {
+		t.Parallel()
+		cw, err := loadCrosswalk(writeCrosswalk(t, "crosswalk.yaml", testCrosswalkYAML))
+		require.NoError(t, err)
+
+		ts := newMetadataTransferSession()
+		cw.describeDataset(ts, base.InferResearchObject(), base)
+
+		assert.Equal(t, [][2]string{
+			{"dc.title", "Title"},
+			{"dc.date", "2017-03-17"},
+		}, ts.Metadata.Entries()["objects/"])
+	})
+
+	t.Run("Uses the built-in mapping when undefined", func(t *testing.T) {
+		t.Parallel()
+		var cw *crosswalk
+
+		want := newMetadataTransferSession()
+		describeDataset(want, base.InferResearchObject())
+		describeSubtype(want, base)
+
+		ts := newMetadataTransferSession()
+		cw.describeDataset(ts, base.InferResearchObject(), base)
+
+		assert.Equal(t, want.Metadata.Entries(), ts.Metadata.Entries())
+	})
+}
+
+func TestCrosswalk_describeFile(t *testing.T) {
+	t.Parallel()
+
+	file := &message.File{
+		FileIdentifier: "1",
+		FileName:       "woodpigeon.jpg",
+		FilePUID:       []string{"fmt/43", "fmt/44"},
+	}
+
+	cw, err := loadCrosswalk(writeCrosswalk(t, "crosswalk.toml", testCrosswalkTOML))
+	require.NoError(t, err)
+	ts := newMetadataTransferSession()
+	cw.describeFile(ts, "woodpigeon_1.jpg", file)
+	assert.Equal(t, [][2]string{
+		{"dc.identifier", "1"},
+		{"dc.title", "woodpigeon.jpg"},
+		{"dc.format", "fmt/43"},
+		{"dc.format", "fmt/44"},
+	}, ts.Metadata.Entries()["objects/woodpigeon_1.jpg"])
+
+	cw, err = loadCrosswalk(writeCrosswalk(t, "crosswalk.yaml", testCrosswalkYAML))
+	require.NoError(t, err)
+	ts = newMetadataTransferSession()
+	cw.describeFile(ts, "woodpigeon_1.jpg", file)
+	assert.Equal(t, [][2]string{
+		{"dc.title", "woodpigeon.jpg"},
+	}, ts.Metadata.Entries()["objects/woodpigeon_1.jpg"])
+}
@@ -0,0 +1,535 @@
+package adapter
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/broker/message"
+)
+
+// DataCite Metadata Schema 4.3, see https://schema.datacite.org/meta/kernel-4.3/
+// for more details.
+const (
+	dataciteNamespace      = "http://datacite.org/schema/kernel-4"
+	dataciteSchemaLocation = "http://datacite.org/schema/kernel-4 http://schema.datacite.org/meta/kernel-4.3/metadata.xsd"
+
+	// dataciteUnavailable is the standard value used when mandatory
+	// properties are not available.
+	dataciteUnavailable = "(:unav)"
+)
+
+type dataciteResource struct {
+	XMLName              xml.Name                   `xml:"resource"`
+	Namespace            string                     `xml:"xmlns,attr"`
+	NamespaceXSI         string                     `xml:"xmlns:xsi,attr"`
+	SchemaLocation       string                     `xml:"xsi:schemaLocation,attr"`
+	Identifier           dataciteIdentifier         `xml:"identifier"`
+	Creators             []dataciteCreator          `xml:"creators>creator"`
+	Titles               []string                   `xml:"titles>title"`
+	Publisher            string                     `xml:"publisher"`
+	PublicationYear      string                     `xml:"publicationYear"`
+	ResourceType         dataciteResourceType       `xml:"resourceType"`
+	Subjects             []string                   `xml:"subjects>subject,omitempty"`
+	Contributors         []dataciteContributor      `xml:"contributors>contributor,omitempty"`
+	Dates                []dataciteDate             `xml:"dates>date,omitempty"`
+	Language             string                     `xml:"language,omitempty"`
+	AlternateIdentifiers []dataciteAltIdentifier    `xml:"alternateIdentifiers>alternateIdentifier,omitempty"`
+	RelatedIdentifiers   []dataciteRelIdentifier    `xml:"relatedIdentifiers>relatedIdentifier,omitempty"`
+	Formats              []string                   `xml:"formats>format,omitempty"`
+	Version              string                     `xml:"version,omitempty"`
+	RightsList           []dataciteRights           `xml:"rightsList>rights,omitempty"`
+	Descriptions         []dataciteDescription      `xml:"descriptions>description,omitempty"`
+	GeoLocations         []dataciteGeoLocation      `xml:"geoLocations>geoLocation,omitempty"`
+	FundingReferences    []dataciteFundingReference `xml:"fundingReferences>fundingReference,omitempty"`
+}
+
+type dataciteIdentifier struct {
+	Type  string `xml:"identifierType,attr"`
+	Value string `xml:",chardata"`
+}
+
+type dataciteName struct {
+	Value string `xml:",chardata"`
+	Type  string `xml:"nameType,attr,omitempty"`
+}
+
+type dataciteNameIdentifier struct {
+	Scheme    string `xml:"nameIdentifierScheme,attr"`
+	SchemeURI string `xml:"schemeURI,attr,omitempty"`
+	Value     string `xml:",chardata"`
+}
+
+type dataciteCreator struct {
+	Name            dataciteName             `xml:"creatorName"`
+	GivenName       string                   `xml:"givenName,omitempty"`
+	FamilyName      string                   `xml:"familyName,omitempty"`
+	NameIdentifiers []dataciteNameIdentifier `xml:"nameIdentifier,omitempty"`
+	Affiliations    []string                 `xml:"affiliation,omitempty"`
+}
+
+type dataciteContributor struct {
+	Type            string                   `xml:"contributorType,attr"`
+	Name            dataciteName             `xml:"contributorName"`
+	GivenName       string                   `xml:"givenName,omitempty"`
+	FamilyName      string                   `xml:"familyName,omitempty"`
+	NameIdentifiers []dataciteNameIdentifier `xml:"nameIdentifier,omitempty"`
+	Affiliations    []string                 `xml:"affiliation,omitempty"`
+}
+
+type dataciteResourceType struct {
+	General string `xml:"resourceTypeGeneral,attr"`
+	Value   string `xml:",chardata"`
+}
+
+type dataciteDate struct {
+	Type  string `xml:"dateType,attr"`
+	Value string `xml:",chardata"`
+}
+
+type dataciteAltIdentifier struct {
+	Type  string `xml:"alternateIdentifierType,attr"`
+	Value string `xml:",chardata"`
+}
+
+type dataciteRelIdentifier struct {
+	Type         string `xml:"relatedIdentifierType,attr"`
+	RelationType string `xml:"relationType,attr"`
+	Value        string `xml:",chardata"`
+}
+
+type dataciteRights struct {
+	URI   string `xml:"rightsURI,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+type dataciteDescription struct {
+	Type  string `xml:"descriptionType,attr"`
+	Value string `xml:",chardata"`
+}
+
+type dataciteGeoLocation struct {
+	Place   string              `xml:"geoLocationPlace,omitempty"`
+	Point   *dataciteGeoPoint   `xml:"geoLocationPoint,omitempty"`
+	Polygon *dataciteGeoPolygon `xml:"geoLocationPolygon,omitempty"`
+}
+
+type dataciteGeoPoint struct {
+	Longitude float64 `xml:"pointLongitude"`
+	Latitude  float64 `xml:"pointLatitude"`
+}
+
+type dataciteGeoPolygon struct {
+	Points []dataciteGeoPoint `xml:"polygonPoint"`
+}
+
+type dataciteFundingReference struct {
+	FunderName string `xml:"funderName"`
+}
+
+// dataciteResourceTypes maps resource types to DataCite's resourceTypeGeneral.
+// Resource types not listed are mapped to "Other".
+var dataciteResourceTypes = map[message.ResourceTypeEnum]string{
+	message.ResourceTypeEnum_article:                "Text",
+	message.ResourceTypeEnum_audio:                  "Sound",
+	message.ResourceTypeEnum_book:                   "Text",
+	message.ResourceTypeEnum_bookSection:            "Text",
+	message.ResourceTypeEnum_conferenceWorkshopItem: "Event",
+	message.ResourceTypeEnum_dataset:                "Dataset",
+	message.ResourceTypeEnum_examPaper:              "Text",
+	message.ResourceTypeEnum_image:                  "Image",
+	message.ResourceTypeEnum_informationPackage:     "Collection",
+	message.ResourceTypeEnum_learningObject:         "InteractiveResource",
+	message.ResourceTypeEnum_movingImage:            "Audiovisual",
+	message.ResourceTypeEnum_musicComposition:       "Sound",
+	message.ResourceTypeEnum_patent:                 "Text",
+	message.ResourceTypeEnum_performance:            "Event",
+	message.ResourceTypeEnum_preprint:               "Text",
+	message.ResourceTypeEnum_report:                 "Text",
+	message.ResourceTypeEnum_review:                 "Text",
+	message.ResourceTypeEnum_showExhibition:         "Event",
+	message.ResourceTypeEnum_software:               "Software",
+	message.ResourceTypeEnum_text:                   "Text",
+	message.ResourceTypeEnum_thesisDissertation:     "Text",
+	message.ResourceTypeEnum_website:                "InteractiveResource",
+	message.ResourceTypeEnum_workflow:               "Workflow",
+}
+
+// dataciteDateTypes maps date types to DataCite's dateType.
+var dataciteDateTypes = map[message.DateTypeEnum]string{
+	message.DateTypeEnum_accepted:    "Accepted",
+	message.DateTypeEnum_approved:    "Other",
+	message.DateTypeEnum_available:   "Available",
+	message.DateTypeEnum_awarded:     "Other",
+	message.DateTypeEnum_collected:   "Collected",
+	message.DateTypeEnum_copyrighted: "Copyrighted",
+	message.DateTypeEnum_created:     "Created",
+	message.DateTypeEnum_issued:      "Issued",
+	message.DateTypeEnum_modified:    "Updated",
+	message.DateTypeEnum_posted:      "Submitted",
+	message.DateTypeEnum_published:   "Issued",
+}
+
+// dataciteDescriptionTypes maps description types to DataCite's
+// descriptionType. Description types not listed are mapped to "Other".
+var dataciteDescriptionTypes = map[message.DescriptionTypeEnum]string{
+	message.DescriptionTypeEnum_abstract:          "Abstract",
+	message.DescriptionTypeEnum_methods:           "Methods",
+	message.DescriptionTypeEnum_seriesInformation: "SeriesInformation",
+	message.DescriptionTypeEnum_tableOfContents:   "TableOfContents",
+	message.DescriptionTypeEnum_technicalInfo:     "TechnicalInfo",
+}
+
+// dataciteRelationTypes maps relation types to DataCite's relationType.
+// Relation types not listed have no equivalent and are not included.
+var dataciteRelationTypes = map[message.RelationTypeEnum]string{
+	message.RelationTypeEnum_basedOnData:         "IsDerivedFrom",
+	message.RelationTypeEnum_cites:               "Cites",
+	message.RelationTypeEnum_compiles:            "Compiles",
+	message.RelationTypeEnum_continues:           "Continues",
+	message.RelationTypeEnum_documents:           "Documents",
+	message.RelationTypeEnum_hasMetadata:         "HasMetadata",
+	message.RelationTypeEnum_hasParent:           "IsPartOf",
+	message.RelationTypeEnum_hasPart:             "HasPart",
+	message.RelationTypeEnum_isBasedOn:           "IsDerivedFrom",
+	message.RelationTypeEnum_isBasisFor:          "IsSourceOf",
+	message.RelationTypeEnum_isCitedBy:           "IsCitedBy",
+	message.RelationTypeEnum_isCompiledBy:        "IsCompiledBy",
+	message.RelationTypeEnum_isContinuedBy:       "IsContinuedBy",
+	message.RelationTypeEnum_isDerivedFrom:       "IsDerivedFrom",
+	message.RelationTypeEnum_isDocumentedBy:      "IsDocumentedBy",
+	message.RelationTypeEnum_isIdenticalTo:       "IsIdenticalTo",
+	message.RelationTypeEnum_isMetadataFor:       "IsMetadataFor",
+	message.RelationTypeEnum_isNewVersionOf:      "IsNewVersionOf",
+	message.RelationTypeEnum_isOriginalFormOf:    "IsOriginalFormOf",
+	message.RelationTypeEnum_isParentOf:          "HasPart",
+	message.RelationTypeEnum_isPartOf:            "IsPartOf",
+	message.RelationTypeEnum_isPreviousVersionOf: "IsPreviousVersionOf",
+	message.RelationTypeEnum_isReferencedBy:      "IsReferencedBy",
+	message.RelationTypeEnum_isRequiredBy:        "IsRequiredBy",
+	message.RelationTypeEnum_isReviewedBy:        "IsReviewedBy",
+	message.RelationTypeEnum_isSourceOf:          "IsSourceOf",
+	message.RelationTypeEnum_isSupplementedBy:    "IsSupplementedBy",
+	message.RelationTypeEnum_isSupplementTo:      "IsSupplementTo",
+	message.RelationTypeEnum_isVariantFormOf:     "IsVariantFormOf",
+	message.RelationTypeEnum_references:          "References",
+	message.RelationTypeEnum_requires:            "Requires",
+	message.RelationTypeEnum_reviews:             "Reviews",
+}
+
+// dataciteRelatedIdentifierTypes lists the identifier types that DataCite
+// accepts as relatedIdentifierType.
+var dataciteRelatedIdentifierTypes = map[message.IdentifierTypeEnum]bool{
+	message.IdentifierTypeEnum_ARK:     true,
+	message.IdentifierTypeEnum_arXiv:   true,
+	message.IdentifierTypeEnum_bibcode: true,
+	message.IdentifierTypeEnum_DOI:     true,
+	message.IdentifierTypeEnum_EAN13:   true,
+	message.IdentifierTypeEnum_EISSN:   true,
+	message.IdentifierTypeEnum_Handle:  true,
+	message.IdentifierTypeEnum_ISBN:    true,
+	message.IdentifierTypeEnum_ISSN:    true,
+	message.IdentifierTypeEnum_ISTC:    true,
+	message.IdentifierTypeEnum_LISSN:   true,
+	message.IdentifierTypeEnum_LSID:    true,
+	message.IdentifierTypeEnum_PMID:    true,
+	message.IdentifierTypeEnum_PURL:    true,
+	message.IdentifierTypeEnum_UPC:     true,
+	message.IdentifierTypeEnum_URL:     true,
+	message.IdentifierTypeEnum_URN:     true,
+}
+
+// dataciteContributorTypes maps person roles to DataCite's contributorType.
+// Roles not listed are mapped to "Other". Creators and publishers are not
+// contributors.
+var dataciteContributorTypes = map[message.PersonRoleEnum]string{
+	message.PersonRoleEnum_contactPerson:   "ContactPerson",
+	message.PersonRoleEnum_dataCollector:   "DataCollector",
+	message.PersonRoleEnum_dataManager:     "DataManager",
+	message.PersonRoleEnum_editor:          "Editor",
+	message.PersonRoleEnum_producer:        "Producer",
+	message.PersonRoleEnum_projectLeader:   "ProjectLeader",
+	message.PersonRoleEnum_projectMember:   "ProjectMember",
+	message.PersonRoleEnum_relatedPerson:   "RelatedPerson",
+	message.PersonRoleEnum_researcher:      "Researcher",
+	message.PersonRoleEnum_researcherGroup: "ResearchGroup",
+	message.PersonRoleEnum_rightsHolder:    "RightsHolder",
+	message.PersonRoleEnum_sponsor:         "Sponsor",
+	message.PersonRoleEnum_supervisor:      "Supervisor",
+}
+
+// dataciteOrganisationContributorTypes maps organisation roles to DataCite's
+// contributorType. Roles not listed are mapped to "Other". Authors, publishers
+// and funders are handled separately.
+var dataciteOrganisationContributorTypes = map[message.OrganisationRoleEnum]string{
+	message.OrganisationRoleEnum_distributor:           "Distributor",
+	message.OrganisationRoleEnum_hostingInstitution:    "HostingInstitution",
+	message.OrganisationRoleEnum_registrationAgency:    "RegistrationAgency",
+	message.OrganisationRoleEnum_registrationAuthority: "RegistrationAuthority",
+	message.OrganisationRoleEnum_rightsHolder:          "RightsHolder",
+	message.OrganisationRoleEnum_sponsor:               "Sponsor",
+}
+
+// dataciteAccessRights maps access types to the COAR/OpenAIRE access rights
+// vocabulary recommended by DataCite.
+var dataciteAccessRights = map[message.AccessTypeEnum]string{
+	message.AccessTypeEnum_open:        "info:eu-repo/semantics/openAccess",
+	message.AccessTypeEnum_safeguarded: "info:eu-repo/semantics/restrictedAccess",
+	message.AccessTypeEnum_controlled:  "info:eu-repo/semantics/restrictedAccess",
+	message.AccessTypeEnum_restricted:  "info:eu-repo/semantics/restrictedAccess",
+	message.AccessTypeEnum_closed:      "info:eu-repo/semantics/closedAccess",
+}
+
+// newDataCite builds a DataCite resource from a research object. The subtype
+// is used to populate properties that are not available in the research
+// object, e.g. language or coverage.
+func newDataCite(f *message.ResearchObject, b *message.ResearchObjectBase) *dataciteResource {
+	r := &dataciteResource{
+		Namespace:      dataciteNamespace,
+		NamespaceXSI:   "http://www.w3.org/2001/XMLSchema-instance",
+		SchemaLocation: dataciteSchemaLocation,
+		Identifier:     dataciteIdentifier{Type: "DOI"},
+		Titles:         []string{f.ObjectTitle},
+		ResourceType: dataciteResourceType{
+			General: "Other",
+			Value:   f.ObjectResourceType.String(),
+		},
+	}
+	if general, ok := dataciteResourceTypes[f.ObjectResourceType]; ok {
+		r.ResourceType.General = general
+	}
+
+	// The first DOI is the identifier, the rest are alternate identifiers.
+	for _, item := range f.ObjectIdentifier {
+		if item.IdentifierType == message.IdentifierTypeEnum_DOI && r.Identifier.Value == "" {
+			r.Identifier.Value = item.IdentifierValue
+			continue
+		}
+		r.AlternateIdentifiers = append(r.AlternateIdentifiers, dataciteAltIdentifier{
+			Type:  item.IdentifierType.String(),
+			Value: item.IdentifierValue,
+		})
+	}
+
+	for _, item := range f.ObjectPersonRole {
+		p := item.Person
+		name := dataciteName{
+			Value: normalizeNames(p.PersonGivenNames, p.PersonFamilyNames),
+			Type:  "Personal",
+		}
+		ids := dataciteNameIdentifiers(p.PersonIdentifier)
+		var affiliations []string
+		if p.PersonOrganisationUnit != nil && p.PersonOrganisationUnit.Organisation.OrganisationName != "" {
+			affiliations = []string{p.PersonOrganisationUnit.Organisation.OrganisationName}
+		}
+		switch item.Role {
+		case message.PersonRoleEnum_dataCreator, message.PersonRoleEnum_author:
+			r.Creators = append(r.Creators, dataciteCreator{
+				Name:            name,
+				GivenName:       p.PersonGivenNames,
+				FamilyName:      p.PersonFamilyNames,
+				NameIdentifiers: ids,
+				Affiliations:    affiliations,
+			})
+		case message.PersonRoleEnum_publisher:
+			if r.Publisher == "" {
+				r.Publisher = name.Value
+			}
+		default:
+			contributorType, ok := dataciteContributorTypes[item.Role]
+			if !ok {
+				contributorType = "Other"
+			}
+			r.Contributors = append(r.Contributors, dataciteContributor{
+				Type:            contributorType,
+				Name:            name,
+				GivenName:       p.PersonGivenNames,
+				FamilyName:      p.PersonFamilyNames,
+				NameIdentifiers: ids,
+				Affiliations:    affiliations,
+			})
+		}
+	}
+
+	for _, item := range f.ObjectOrganisationRole {
+		name := dataciteName{Value: item.Organisation.OrganisationName, Type: "Organizational"}
+		switch item.Role {
+		case message.OrganisationRoleEnum_author:
+			r.Creators = append(r.Creators, dataciteCreator{Name: name})
+		case message.OrganisationRoleEnum_publisher:
+			// Organisations take precedence over people.
+			r.Publisher = name.Value
+		case message.OrganisationRoleEnum_funder:
+			r.FundingReferences = append(r.FundingReferences, dataciteFundingReference{
+				FunderName: name.Value,
+			})
+		default:
+			contributorType, ok := dataciteOrganisationContributorTypes[item.Role]
+			if !ok {
+				contributorType = "Other"
+			}
+			r.Contributors = append(r.Contributors, dataciteContributor{
+				Type: contributorType,
+				Name: name,
+			})
+		}
+	}
+
+	// Creators and publisher are mandatory.
+	if len(r.Creators) == 0 {
+		r.Creators = []dataciteCreator{{Name: dataciteName{Value: dataciteUnavailable}}}
+	}
+	if r.Publisher == "" {
+		r.Publisher = dataciteUnavailable
+	}
+
+	for _, item := range f.ObjectDate {
+		value, ok := formatDate(item.DateValue)
+		if !ok {
+			continue
+		}
+		if item.DateType == message.DateTypeEnum_published || r.PublicationYear == "" {
+			r.PublicationYear = value[:4]
+		}
+		r.Dates = append(r.Dates, dataciteDate{Type: dataciteDateTypes[item.DateType], Value: value})
+	}
+	if r.PublicationYear == "" {
+		r.PublicationYear = dataciteUnavailable
+	}
+
+	r.Subjects = append(r.Subjects, f.ObjectKeyword...)
+	r.Subjects = append(r.Subjects, f.ObjectCategory...)
+
+	for _, item := range f.ObjectRelatedIdentifier {
+		relationType, ok := dataciteRelationTypes[item.RelationType]
+		if !ok || !dataciteRelatedIdentifierTypes[item.Identifier.IdentifierType] {
+			continue
+		}
+		r.RelatedIdentifiers = append(r.RelatedIdentifiers, dataciteRelIdentifier{
+			Type:         item.Identifier.IdentifierType.String(),
+			RelationType: relationType,
+			Value:        item.Identifier.IdentifierValue,
+		})
+	}
+
+	formats := map[string]bool{}
+	for _, item := range f.ObjectFile {
+		if item.FileFormatType == "" || formats[item.FileFormatType] {
+			continue
+		}
+		formats[item.FileFormatType] = true
+		r.Formats = append(r.Formats, item.FileFormatType)
+	}
+
+	for _, item := range f.ObjectRights.Licence {
+		rights := dataciteRights{Value: item.LicenceName}
+		if strings.HasPrefix(item.LicenceIdentifier, "http") {
+			rights.URI = item.LicenceIdentifier
+		} else if rights.Value == "" {
+			rights.Value = item.LicenceIdentifier
+		}
+		r.RightsList = append(r.RightsList, rights)
+	}
+	for _, item := range f.ObjectRights.Access {
+		r.RightsList = append(r.RightsList, dataciteRights{
+			URI:   dataciteAccessRights[item.AccessType],
+			Value: joinNonEmpty(": ", item.AccessType.String(), item.AccessStatement),
+		})
+	}
+	for _, item := range f.ObjectRights.RightsStatement {
+		r.RightsList = append(r.RightsList, dataciteRights{Value: item})
+	}
+
+	for _, item := range f.ObjectDescription {
+		descriptionType, ok := dataciteDescriptionTypes[item.DescriptionType]
+		if !ok {
+			descriptionType = "Other"
+		}
+		r.Descriptions = append(r.Descriptions, dataciteDescription{
+			Type:  descriptionType,
+			Value: item.DescriptionValue,
+		})
+	}
+
+	var (
+		languages []string
+		coverage  *message.Coverage
+	)
+	switch {
+	case b == nil:
+	case b.Article != nil:
+		languages, coverage = b.Article.Language, &b.Article.Coverage
+	case b.Dataset != nil:
+		languages, coverage = b.Dataset.Language, &b.Dataset.Coverage
+		r.Version = b.Dataset.Version
+	case b.ThesisDissertation != nil:
+		languages, coverage = b.ThesisDissertation.Language, &b.ThesisDissertation.Coverage
+	}
+	if len(languages) > 0 {
+		r.Language = languages[0]
+	}
+	if coverage != nil {
+		r.GeoLocations = dataciteGeoLocations(coverage)
+		start, hasStart := formatDate(coverage.TemporalCoverageStart)
+		end, hasEnd := formatDate(coverage.TemporalCoverageEnd)
+		if hasStart || hasEnd {
+			r.Dates = append(r.Dates, dataciteDate{Type: "Collected", Value: fmt.Sprintf("%s/%s", start, end)})
+		}
+	}
+
+	return r
+}
+
+func dataciteNameIdentifiers(ids []message.PersonIdentifier) []dataciteNameIdentifier {
+	var ret []dataciteNameIdentifier
+	for _, item := range ids {
+		id := dataciteNameIdentifier{
+			Scheme: item.PersonIdentifierType.String(),
+			Value:  item.PersonIdentifierValue,
+		}
+		if item.PersonIdentifierType == message.PersonIdentifierTypeEnum_ORCID {
+			id.SchemeURI = "https://orcid.org"
+		}
+		ret = append(ret, id)
+	}
+	return ret
+}
+
+func dataciteGeoLocations(c *message.Coverage) []dataciteGeoLocation {
+	var ret []dataciteGeoLocation
+	for _, item := range c.GeospatialCoverage {
+		loc := dataciteGeoLocation{Place: item.GeolocationPlace}
+		if item.GeolocationPoint != nil {
+			loc.Point = &dataciteGeoPoint{
+				Longitude: item.GeolocationPoint.Longitude,
+				Latitude:  item.GeolocationPoint.Latitude,
+			}
+		}
+		if len(item.GeolocationPolygon) > 0 {
+			loc.Polygon = &dataciteGeoPolygon{}
+			for _, point := range item.GeolocationPolygon {
+				loc.Polygon.Points = append(loc.Polygon.Points, dataciteGeoPoint{
+					Longitude: point.Longitude,
+					Latitude:  point.Latitude,
+				})
+			}
+		}
+		ret = append(ret, loc)
+	}
+	return ret
+}
+
+// Write encodes the resource as an indented XML document.
+func (r *dataciteResource) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,164 @@
+package adapter
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/broker/message"
+)
+
+func TestDataCite(t *testing.T) {
+	dataset := &message.Dataset{
+		ObjectTitle:        "Non-uniform Mesh for Embroidered Microstrip Antennas",
+		ObjectResourceType: message.ResourceTypeEnum_dataset,
+		ObjectIdentifier: []message.Identifier{
+			{IdentifierType: message.IdentifierTypeEnum_DOI, IdentifierValue: "10.17028/rd.lboro.4665448.v1"},
+			{IdentifierType: message.IdentifierTypeEnum_Handle, IdentifierValue: "2134/4665448"},
+		},
+		ObjectPersonRole: []message.PersonRole{
+			{
+				Role: message.PersonRoleEnum_dataCreator,
+				Person: message.Person{
+					PersonGivenNames:  "Shiyu",
+					PersonFamilyNames: "Zhang",
+					PersonIdentifier: []message.PersonIdentifier{
+						{PersonIdentifierType: message.PersonIdentifierTypeEnum_ORCID, PersonIdentifierValue: "0000-0001-2345-6789"},
+					},
+					PersonOrganisationUnit: &message.OrganisationUnit{
+						Organisation: message.Organisation{OrganisationName: "Loughborough University"},
+					},
+				},
+			},
+			{
+				Role:   message.PersonRoleEnum_editor,
+				Person: message.Person{PersonGivenNames: "William", PersonFamilyNames: "Whittow"},
+			},
+		},
+		ObjectOrganisationRole: []message.OrganisationRole{
+			{Role: message.OrganisationRoleEnum_publisher, Organisation: message.Organisation{OrganisationName: "Loughborough University"}},
+			{Role: message.OrganisationRoleEnum_funder, Organisation: message.Organisation{OrganisationName: "EPSRC"}},
+			{Role: message.OrganisationRoleEnum_hostingInstitution, Organisation: message.Organisation{OrganisationName: "Jisc"}},
+		},
+		ObjectDate: []message.Date{
+			{DateType: message.DateTypeEnum_created, DateValue: date(2016, time.January, 2)},
+			{DateType: message.DateTypeEnum_published, DateValue: date(2017, time.March, 17)},
+		},
+		ObjectDescription: []message.ObjectDescription{
+			{DescriptionType: message.DescriptionTypeEnum_abstract, DescriptionValue: "Simulation files."},
+		},
+		ObjectKeyword:  []string{"antennas"},
+		ObjectCategory: []string{"engineering"},
+		ObjectRelatedIdentifier: []message.IdentifierRelationship{
+			{RelationType: message.RelationTypeEnum_isSupplementTo, Identifier: message.Identifier{IdentifierType: message.IdentifierTypeEnum_DOI, IdentifierValue: "10.1049/el.2016.3389"}},
+			{RelationType: message.RelationTypeEnum_isAIPOf, Identifier: message.Identifier{IdentifierType: message.IdentifierTypeEnum_DOI, IdentifierValue: "10.1049/ignored"}},
+			{RelationType: message.RelationTypeEnum_cites, Identifier: message.Identifier{IdentifierType: message.IdentifierTypeEnum_UUID, IdentifierValue: "ignored"}},
+		},
+		ObjectRights: message.Rights{
+			Licence: []message.Licence{
+				{LicenceName: "CC BY 4.0", LicenceIdentifier: "https://creativecommons.org/licenses/by/4.0/"},
+			},
+			Access: []message.Access{{AccessType: message.AccessTypeEnum_open}},
+		},
+		ObjectFile: []message.File{
+			{FileFormatType: "application/zip"},
+			{FileFormatType: "application/zip"},
+		},
+		Language: []string{"en"},
+		Coverage: message.Coverage{
+			GeospatialCoverage: []message.GeospatialCoverage{
+				{GeolocationPlace: "Loughborough", GeolocationPoint: &message.GeolocationPoint{Latitude: 52.77, Longitude: -1.2}},
+			},
+		},
+		Version: "1",
+	}
+	base := &message.ResearchObjectBase{Dataset: dataset}
+
+	var buf bytes.Buffer
+	if err := newDataCite(base.InferResearchObject(), base).Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<resource xmlns="http://datacite.org/schema/kernel-4" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://datacite.org/schema/kernel-4 http://schema.datacite.org/meta/kernel-4.3/metadata.xsd">
+  <identifier identifierType="DOI">10.17028/rd.lboro.4665448.v1</identifier>
+  <creators>
+    <creator>
+      <creatorName nameType="Personal">Zhang, Shiyu</creatorName>
+      <givenName>Shiyu</givenName>
+      <familyName>Zhang</familyName>
+      <nameIdentifier nameIdentifierScheme="ORCID" schemeURI="https://orcid.org">0000-0001-2345-6789</nameIdentifier>
+      <affiliation>Loughborough University</affiliation>
+    </creator>
+  </creators>
+  <titles>
+    <title>Non-uniform Mesh for Embroidered Microstrip Antennas</title>
+  </titles>
+  <publisher>Loughborough University</publisher>
+  <publicationYear>2017</publicationYear>
+  <resourceType resourceTypeGeneral="Dataset">dataset</resourceType>
+  <subjects>
+    <subject>antennas</subject>
+    <subject>engineering</subject>
+  </subjects>
+  <contributors>
+    <contributor contributorType="Editor">
+      <contributorName nameType="Personal">Whittow, William</contributorName>
+      <givenName>William</givenName>
+      <familyName>Whittow</familyName>
+    </contributor>
+    <contributor contributorType="HostingInstitution">
+      <contributorName nameType="Organizational">Jisc</contributorName>
+    </contributor>
+  </contributors>
+  <dates>
+    <date dateType="Created">2016-01-02</date>
+    <date dateType="Issued">2017-03-17</date>
+  </dates>
+  <language>en</language>
+  <alternateIdentifiers>
+    <alternateIdentifier alternateIdentifierType="Handle">2134/4665448</alternateIdentifier>
+  </alternateIdentifiers>
+  <relatedIdentifiers>
+    <relatedIdentifier relatedIdentifierType="DOI" relationType="IsSupplementTo">10.1049/el.2016.3389</relatedIdentifier>
+  </relatedIdentifiers>
+  <formats>
+    <format>application/zip</format>
+  </formats>
+  <version>1</version>
+  <rightsList>
+    <rights rightsURI="https://creativecommons.org/licenses/by/4.0/">CC BY 4.0</rights>
+    <rights rightsURI="info:eu-repo/semantics/openAccess">open</rights>
+  </rightsList>
+  <descriptions>
+    <description descriptionType="Abstract">Simulation files.</description>
+  </descriptions>
+  <geoLocations>
+    <geoLocation>
+      <geoLocationPlace>Loughborough</geoLocationPlace>
+      <geoLocationPoint>
+        <pointLongitude>-1.2</pointLongitude>
+        <pointLatitude>52.77</pointLatitude>
+      </geoLocationPoint>
+    </geoLocation>
+  </geoLocations>
+  <fundingReferences>
+    <fundingReference>
+      <funderName>EPSRC</funderName>
+    </fundingReference>
+  </fundingReferences>
+</resource>
+`, buf.String())
+}
+
+func TestDataCite_mandatoryProperties(t *testing.T) {
+	r := newDataCite(&message.ResearchObject{ObjectTitle: "Title"}, nil)
+
+	assert.Equal(t, "", r.Identifier.Value)
+	assert.Equal(t, dataciteUnavailable, r.Creators[0].Name.Value)
+	assert.Equal(t, dataciteUnavailable, r.Publisher)
+	assert.Equal(t, dataciteUnavailable, r.PublicationYear)
+	assert.Equal(t, "Other", r.ResourceType.General)
+}
@@ -0,0 +1,105 @@
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/amclient"
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/broker/message"
+
+	"github.com/pkg/errors"
+)
+
+// jobEventTypes maps the Archivematica microservices to the preservation
+// event types. Jobs of other microservices are not reported.
+var jobEventTypes = map[string]message.PreservationEventTypeEnum{
+	"Scan for viruses":                  message.PreservationEventTypeEnum_virusCheck,
+	"Identify file format":              message.PreservationEventTypeEnum_formatIdentification,
+	"Characterize and extract metadata": message.PreservationEventTypeEnum_metadataExtraction,
+	"Normalize":                         message.PreservationEventTypeEnum_normalization,
+	"Validation":                        message.PreservationEventTypeEnum_validation,
+	"Verify transfer checksums":         message.PreservationEventTypeEnum_fixityCheck,
+	"Extract packages":                  message.PreservationEventTypeEnum_unpacking,
+	"Clean up names":                    message.PreservationEventTypeEnum_filenameChange,
+	"Prepare AIP":                       message.PreservationEventTypeEnum_packing,
+}
+
+// maxFailedTaskDetails is the maximum number of failed tasks of a job that are
+// looked up to describe its outcome.
+const maxFailedTaskDetails = 5
+
+// ingestEvents returns the preservation events found in the job log of the
+// transfer and the SIP, in that order. They are enclosed by the ingestionStart
+// and the ingestionEnd events, identified by the transfer and the SIP
+// identifiers. Every other event is identified by the job identifier.
+//
+// Only completed or failed jobs of the microservices listed in jobEventTypes
+// that run at least one task are reported.
+func ingestEvents(ctx context.Context, c *amclient.Client, transferID, SIPID string) ([]message.PreservationEvent, error) {
+	events := []message.PreservationEvent{
+		newPreservationEvent(transferID, message.PreservationEventTypeEnum_ingestionStart,
+			fmt.Sprintf("Archivematica transfer %s started", transferID)),
+	}
+	for _, unitID := range []string{transferID, SIPID} {
+		jobs, _, err := c.Jobs.List(ctx, unitID, &amclient.JobsListRequest{})
+		if err != nil {
+			return nil, errors.Wrapf(err, "jobs of unit %s cannot be listed", unitID)
+		}
+		for _, job := range jobs {
+			eventType, ok := jobEventTypes[job.Microservice]
+			if !ok || len(job.Tasks) == 0 {
+				continue
+			}
+			if job.Status != amclient.JobStatusComplete && job.Status != amclient.JobStatusFailed {
+				continue
+			}
+			events = append(events, newPreservationEvent(job.ID, eventType, jobDetail(ctx, c, job)))
+		}
+	}
+	events = append(events, newPreservationEvent(SIPID, message.PreservationEventTypeEnum_ingestionEnd,
+		fmt.Sprintf("Archivematica AIP %s stored", SIPID)))
+	return events, nil
+}
+
+func newPreservationEvent(value string, eventType message.PreservationEventTypeEnum, detail string) message.PreservationEvent {
+	return message.PreservationEvent{
+		PreservationEventValue:  value,
+		PreservationEventType:   &eventType,
+		PreservationEventDetail: detail,
+	}
+}
+
+// jobDetail describes the outcome of a job, e.g. "Scan for viruses: Scan for
+// viruses (outcome: failure, 1 of 2 tasks failed: virus.exe (exit code 1))".
+// The details of the failed tasks are retrieved with TaskService.Read.
+func jobDetail(ctx context.Context, c *amclient.Client, job amclient.Job) string {
+	failed := []amclient.Task{}
+	for _, task := range job.Tasks {
+		if task.ExitCode != 0 {
+			failed = append(failed, task)
+		}
+	}
+	var outcome string
+	if job.Status == amclient.JobStatusComplete && len(failed) == 0 {
+		outcome = fmt.Sprintf("outcome: success, %d tasks completed", len(job.Tasks))
+	} else {
+		outcome = fmt.Sprintf("outcome: failure, %d of %d tasks failed", len(failed), len(job.Tasks))
+	}
+	tasks := []string{}
+	for i, task := range failed {
+		if i == maxFailedTaskDetails {
+			tasks = append(tasks, "...")
+			break
+		}
+		name := task.ID
+		if detailed, _, err := c.Task.Read(ctx, task.ID); err == nil && detailed.Filename != "" {
+			name = detailed.Filename
+		}
+		tasks = append(tasks, fmt.Sprintf("%s (exit code %d)", name, task.ExitCode))
+	}
+	if len(tasks) > 0 {
+		outcome = fmt.Sprintf("%s: %s", outcome, strings.Join(tasks, ", "))
+	}
+	return fmt.Sprintf("%s: %s (%s)", job.Microservice, job.Name, outcome)
+}
@@ -0,0 +1,84 @@
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/amclient"
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/broker/message"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIngestEvents(t *testing.T) {
+	const (
+		transferID = "e99afef7-90c5-4fd9-bf8f-bed13b3bd4ba"
+		SIPID      = "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0"
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v2beta/jobs/"+transferID+"/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+	{"uuid": "624581dc-ec01-4195-9da3-db0ab0ad1cc3", "name": "Scan for viruses", "status": "COMPLETE", "microservice": "Scan for viruses", "tasks": [
+		{"uuid": "491aebbd-457b-4a6e-adf6-87a3a9ee951a", "exit_code": 0},
+		{"uuid": "96acb0a1-525c-456a-9060-51bb84f5f708", "exit_code": 1}
+	]},
+	{"uuid": "1b2c8f0a-5c6f-4d4b-9a5e-3a0c3e2b7d11", "name": "Move to processing directory", "status": "COMPLETE", "microservice": "Verify transfer compliance", "tasks": [
+		{"uuid": "c0a3d9e5-1f3b-4f7e-8d2a-6b5c4a3b2e1f", "exit_code": 0}
+	]},
+	{"uuid": "0c1d2e3f-4a5b-4c6d-8e7f-9a0b1c2d3e4f", "name": "Identify file format", "status": "PROCESSING", "microservice": "Identify file format", "tasks": [
+		{"uuid": "5a4b3c2d-1e0f-4a9b-8c7d-6e5f4a3b2c1d", "exit_code": 0}
+	]}
+]`)
+	})
+	mux.HandleFunc("/api/v2beta/jobs/"+SIPID+"/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+	{"uuid": "7f1b6c5a-1c11-4b8d-9c62-2f4c2a1b8b1e", "name": "Normalize for preservation", "status": "COMPLETE", "microservice": "Normalize", "tasks": [
+		{"uuid": "3d2c1b0a-9f8e-4d7c-b6a5-4f3e2d1c0b9a", "exit_code": 0},
+		{"uuid": "8e7d6c5b-4a3f-4e2d-9c1b-0a9f8e7d6c5b", "exit_code": 0}
+	]},
+	{"uuid": "a8d1b4f0-3e2f-4bb6-8c5e-4e3a2b6f0c19", "name": "Check if DIP should be generated", "status": "COMPLETE", "microservice": "Prepare AIP", "tasks": []}
+]`)
+	})
+	mux.HandleFunc("/api/v2beta/task/96acb0a1-525c-456a-9060-51bb84f5f708/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"uuid": "96acb0a1-525c-456a-9060-51bb84f5f708", "exit_code": 1, "file_name": "virus.exe", "time_created": "2019-06-18T00:00:00", "time_started": "2019-06-18T00:00:00", "time_ended": "2019-06-18T00:00:00"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c, _ := amclient.New(nil, server.URL, "", "")
+	events, err := ingestEvents(context.Background(), c, transferID, SIPID)
+	require.NoError(t, err)
+
+	type event struct {
+		value     string
+		eventType message.PreservationEventTypeEnum
+		detail    string
+	}
+	got := []event{}
+	for _, e := range events {
+		got = append(got, event{e.PreservationEventValue, *e.PreservationEventType, e.PreservationEventDetail})
+	}
+	assert.Equal(t, []event{
+		{transferID, message.PreservationEventTypeEnum_ingestionStart, "Archivematica transfer " + transferID + " started"},
+		{"624581dc-ec01-4195-9da3-db0ab0ad1cc3", message.PreservationEventTypeEnum_virusCheck,
+			"Scan for viruses: Scan for viruses (outcome: failure, 1 of 2 tasks failed: virus.exe (exit code 1))"},
+		{"7f1b6c5a-1c11-4b8d-9c62-2f4c2a1b8b1e", message.PreservationEventTypeEnum_normalization,
+			"Normalize: Normalize for preservation (outcome: success, 2 tasks completed)"},
+		{SIPID, message.PreservationEventTypeEnum_ingestionEnd, "Archivematica AIP " + SIPID + " stored"},
+	}, got)
+}
+
+func TestIngestEvents_error(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	c, _ := amclient.New(nil, server.URL, "", "")
+	_, err := ingestEvents(context.Background(), c, "e99afef7-90c5-4fd9-bf8f-bed13b3bd4ba", "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0")
+
+	assert.Error(t, err)
+}
@@ -0,0 +1,173 @@
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/amclient"
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/broker"
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/broker/message"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// fixityAuditor periodically asks the Storage Service of each tenant to check
+// the fixity of the AIPs recorded in the storage. The results are recorded in
+// the storage and published as fixityCheck preservation events.
+type fixityAuditor struct {
+	logger       logrus.FieldLogger
+	storage      Storage
+	preservation broker.PreservationService
+	pipelines    func() map[uint64][]Pipeline
+	interval     time.Duration
+	now          func() time.Time
+}
+
+func newFixityAuditor(logger logrus.FieldLogger, storage Storage, preservation broker.PreservationService, pipelines func() map[uint64][]Pipeline, interval time.Duration) *fixityAuditor {
+	return &fixityAuditor{
+		logger:       logger,
+		storage:      storage,
+		preservation: preservation,
+		pipelines:    pipelines,
+		interval:     interval,
+		now:          time.Now,
+	}
+}
+
+// run audits the AIPs every interval until the context is canceled.
+func (f *fixityAuditor) run(ctx context.Context) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			f.audit(ctx)
+		}
+	}
+}
+
+// audit checks the fixity of the AIPs of all the tenants. Each AIP is checked
+// by the Storage Service of the pipeline that stored it. AIPs of pipelines
+// without a Storage Service, or no longer in the registry, are skipped.
+func (f *fixityAuditor) audit(ctx context.Context) {
+	aips, err := f.storage.ListAIPs(ctx)
+	if err != nil {
+		f.logger.WithError(err).Error("Fixity audit failed, AIPs cannot be listed")
+		return
+	}
+	for tenantID, pipelines := range f.pipelines() {
+		logger := f.logger.WithField("tenantJiscID", tenantID)
+		for _, aip := range aips[tenantID] {
+			if ctx.Err() != nil {
+				return
+			}
+			logger := logger.WithFields(logrus.Fields{"aipID": aip.AIPID, "pipeline": aip.PipelineID})
+			c := findPipeline(pipelines, aip.PipelineID)
+			if c == nil || c.StorageService == nil {
+				logger.Debug("Fixity check skipped, the Storage Service of the pipeline is not configured")
+				continue
+			}
+			if err := f.check(ctx, c.StorageService, aip); err != nil {
+				logger.WithError(err).Error("Fixity check failed")
+			}
+		}
+	}
+}
+
+// check checks the fixity of an AIP, records the result and publishes it.
+func (f *fixityAuditor) check(ctx context.Context, ss *amclient.StorageServiceClient, aip StoredAIP) error {
+	objectUUID, err := message.ParseUUID(aip.ObjectUUID)
+	if err != nil {
+		return errors.Wrap(err, "object UUID is invalid")
+	}
+	aipUUID, err := message.ParseUUID(aip.AIPID)
+	if err != nil {
+		return errors.Wrap(err, "AIP UUID is invalid")
+	}
+	payload, _, err := ss.Package.CheckFixity(ctx, aip.AIPID, nil)
+	if err != nil {
+		return errors.Wrap(err, "fixity check cannot be requested")
+	}
+	check := FixityCheck{
+		Time:    f.now(),
+		Success: payload.Success,
+		Detail:  fixityDetail(payload),
+	}
+	if err := f.storage.RecordFixityCheck(ctx, aip.ObjectUUID, check); err != nil {
+		// We still want to publish the result.
+		f.logger.WithError(err).WithField("aipID", aip.AIPID).Warn("Fixity check result cannot be recorded")
+	}
+	var (
+		packageTypeAIP        = message.PackageTypeEnum_AIP
+		packageContainerType  = message.ContainerTypeEnum_zip
+		preservationEventType = message.PreservationEventTypeEnum_fixityCheck
+	)
+	if pkg, _, err := ss.Package.Get(ctx, aip.AIPID); err != nil {
+		f.logger.WithError(err).WithField("aipID", aip.AIPID).Warn("Package cannot be retrieved, its container type is assumed")
+	} else {
+		packageContainerType = containerType(pkg.CurrentPath)
+	}
+	err = f.preservation.Event(ctx, &message.PreservationEventRequest{
+		InformationPackage: message.InformationPackage{
+			ObjectUUID:           objectUUID,
+			PackageUUID:          aipUUID,
+			PackageType:          &packageTypeAIP,
+			PackageContainerType: &packageContainerType,
+			PackagePreservationEvent: message.PreservationEvent{
+				PreservationEventValue:  uuid.New().String(),
+				PreservationEventType:   &preservationEventType,
+				PreservationEventDetail: check.Detail,
+			},
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "PreservationEvent message could not be sent")
+	}
+	return nil
+}
+
+// containerType returns the container type of a package given its path in the
+// Storage Service, which depends on the compression chosen in the processing
+// configuration. RDSS only tells packages in a container, which it calls zip
+// whatever the format is (7z, tar.bz2...), from uncompressed ones.
+func containerType(currentPath string) message.ContainerTypeEnum {
+	name := strings.ToLower(path.Base(currentPath))
+	for _, ext := range []string{".7z", ".zip", ".tar", ".tar.gz", ".tgz", ".tar.bz2", ".gz", ".bz2"} {
+		if strings.HasSuffix(name, ext) {
+			return message.ContainerTypeEnum_zip
+		}
+	}
+	return message.ContainerTypeEnum_none
+}
+
+// fixityDetail describes the result of a fixity check, e.g. "Fixity check
+// failed: Invalid bag (missing: data/objects/foo.jpg)".
+func fixityDetail(r *amclient.StoragePackageCheckFixityResponse) string {
+	if r.Success {
+		return "Fixity check succeeded"
+	}
+	files := r.Failures.Files
+	failures := joinNonEmpty("; ",
+		fixityFailures("missing", files.Missing),
+		fixityFailures("changed", files.Changed),
+		fixityFailures("untracked", files.Untracked))
+	detail := joinNonEmpty(": ", "Fixity check failed", r.Message)
+	if failures != "" {
+		detail = fmt.Sprintf("%s (%s)", detail, failures)
+	}
+	return detail
+}
+
+func fixityFailures(kind string, names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s: %s", kind, strings.Join(names, ", "))
+}
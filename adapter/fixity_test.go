@@ -0,0 +1,147 @@
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/amclient"
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/broker/message"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type fixityStorageMock struct {
+	Storage
+	aips    map[uint64][]StoredAIP
+	records map[string]FixityCheck
+	mu      sync.Mutex
+}
+
+func (s *fixityStorageMock) ListAIPs(ctx context.Context) (map[uint64][]StoredAIP, error) {
+	return s.aips, nil
+}
+
+func (s *fixityStorageMock) RecordFixityCheck(ctx context.Context, objectUUID string, check FixityCheck) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[objectUUID] = check
+	return nil
+}
+
+type preservationMock struct {
+	events []*message.PreservationEventRequest
+	mu     sync.Mutex
+}
+
+func (p *preservationMock) Event(ctx context.Context, req *message.PreservationEventRequest) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, req)
+	return nil
+}
+
+func TestFixityAuditor(t *testing.T) {
+	const (
+		objectOK     = "4bb5d4e2-3b6b-4b4f-a0ef-6f1b5b0f1e5e"
+		objectFailed = "7e36f2ed-7a2a-4fd5-9b44-4d4e5f9b2ef4"
+		aipOK        = "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0"
+		aipFailed    = "a8d1b4f0-3e2f-4bb6-8c5e-4e3a2b6f0c19"
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v2/file/"+aipOK+"/check_fixity/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"success": true, "message": "", "failures": {"files": {"missing": [], "changed": [], "untracked": []}}, "timestamp": null}`)
+	})
+	mux.HandleFunc("/api/v2/file/"+aipFailed+"/check_fixity/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"success": false, "message": "Invalid bag", "failures": {"files": {"missing": ["data/objects/a.jpg", "data/objects/b.jpg"], "changed": ["data/objects/c.jpg"], "untracked": []}}, "timestamp": null}`)
+	})
+	mux.HandleFunc("/api/v2/file/"+aipOK+"/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"uuid": "%s", "current_path": "d7c4/AIP-%s.7z"}`, aipOK, aipOK)
+	})
+	mux.HandleFunc("/api/v2/file/"+aipFailed+"/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"uuid": "%s", "current_path": "a8d1/AIP-%s"}`, aipFailed, aipFailed)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	withSS, _ := amclient.New(nil, "http://dashboard", "", "",
+		amclient.SetStorageService(amclient.NewStorageServiceClient(nil, server.URL, "", "")))
+	withoutSS, _ := amclient.New(nil, "http://dashboard", "", "")
+	pipelines := func() map[uint64][]Pipeline {
+		return map[uint64][]Pipeline{
+			1: {{ID: "default", Client: withoutSS}, {ID: "ss", Client: withSS}},
+			2: {{ID: "default", Client: withoutSS}},
+		}
+	}
+
+	storage := &fixityStorageMock{
+		aips: map[uint64][]StoredAIP{
+			1: {
+				{ObjectUUID: objectOK, AIPID: aipOK, PipelineID: "ss"},
+				{ObjectUUID: objectFailed, AIPID: aipFailed, PipelineID: "ss"},
+			},
+			2: {{ObjectUUID: objectOK, AIPID: aipOK}},
+		},
+		records: map[string]FixityCheck{},
+	}
+	preservation := &preservationMock{}
+	now := time.Date(2020, time.August, 1, 0, 0, 0, 0, time.UTC)
+
+	f := newFixityAuditor(logrus.StandardLogger(), storage, preservation, pipelines, time.Hour)
+	f.now = func() time.Time { return now }
+	f.audit(context.Background())
+
+	assert.Equal(t, map[string]FixityCheck{
+		objectOK: {Time: now, Success: true, Detail: "Fixity check succeeded"},
+		objectFailed: {Time: now, Success: false, Detail: "Fixity check failed: Invalid bag " +
+			"(missing: data/objects/a.jpg, data/objects/b.jpg; changed: data/objects/c.jpg)"},
+	}, storage.records)
+
+	assert.Len(t, preservation.events, 2)
+	for _, event := range preservation.events {
+		ip := event.InformationPackage
+		assert.Equal(t, message.PreservationEventTypeEnum_fixityCheck, *ip.PackagePreservationEvent.PreservationEventType)
+		assert.Equal(t, message.PackageTypeEnum_AIP, *ip.PackageType)
+		assert.Equal(t, storage.records[ip.ObjectUUID.String()].Detail, ip.PackagePreservationEvent.PreservationEventDetail)
+		switch ip.ObjectUUID.String() {
+		case objectOK:
+			assert.Equal(t, aipOK, ip.PackageUUID.String())
+			assert.Equal(t, message.ContainerTypeEnum_zip, *ip.PackageContainerType)
+		case objectFailed:
+			assert.Equal(t, aipFailed, ip.PackageUUID.String())
+			assert.Equal(t, message.ContainerTypeEnum_none, *ip.PackageContainerType, "uncompressed AIP")
+		default:
+			t.Errorf("unexpected object %s", ip.ObjectUUID)
+		}
+	}
+}
+
+func TestFixityAuditor_run(t *testing.T) {
+	storage := &fixityStorageMock{records: map[string]FixityCheck{}}
+	listed := make(chan struct{}, 1)
+	pipelines := func() map[uint64][]Pipeline {
+		select {
+		case listed <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	f := newFixityAuditor(logrus.StandardLogger(), storage, &preservationMock{}, pipelines, time.Millisecond)
+	go func() {
+		f.run(ctx)
+		close(done)
+	}()
+
+	<-listed
+	cancel()
+	<-done
+}
@@ -26,38 +26,97 @@ var (
 // handleMetadataCreateRequest handles the reception of Metadata Create
 // messages.
 func (c *Adapter) handleMetadataCreateRequest(msg *message.Message) error {
+	return c.ingestDataset(msg, false, nil)
+}
+
+// startedTransfer is a transfer started by a previous handler of a dataset.
+type startedTransfer struct {
+	pipeline Pipeline
+	ID       string
+}
+
+// ingestDataset preserves the dataset described by a Metadata Create message.
+// The handler is tracked while it runs so it can be inspected and canceled,
+// and remembered if it fails so it can be retried, see AdminAPI. Retries wait
+// for the transfer started by the handler that failed when it is given,
+// instead of starting a new one.
+func (c *Adapter) ingestDataset(msg *message.Message, retry bool, started *startedTransfer) (err error) {
 	body, err := msg.MetadataCreateRequest()
 	if err != nil {
 		return err
 	}
-	amClient := c.registry.Get(msg.MessageHeader.TenantJiscID)
-	if amClient == nil {
-		return errors.Wrap(UnknownTenantErr, strconv.Itoa(int(msg.MessageHeader.TenantJiscID)))
-	}
 	researchObject := body.InferResearchObject()
-	id, err := c.startTransfer(amClient, researchObject)
-	if err != nil {
-		return errors.Wrap(err, "transfer cannot be started")
-	}
-	c.logger.Debugf("The transfer has started successfully, id: %s", id)
-	if err := c.storage.AssociateResearchObject(c.ctx, researchObject.ObjectUUID.String(), id); err != nil {
-		// We don't want to discard the message at this point.
-		c.logger.Errorf("Error trying to persist the research object: %v", err)
+	h, ctx := c.handlers.start(c.ctx, msg, researchObject.ObjectUUID.String(), retry)
+	defer func() { c.handlers.finish(h, msg, err) }()
+	var (
+		p    Pipeline
+		done = func() {}
+		id   string
+		t    *amclient.TransferSession
+	)
+	if started != nil {
+		p, id = started.pipeline, started.ID
+		done = c.registry.trackPipeline(msg.MessageHeader.TenantJiscID, p.ID)
+	} else {
+		h.update(func(info *HandlerInfo) { info.Stage = StageSelectingPipeline })
+		// The transfer is started in the first pipeline of the tenant that
+		// takes it, see Registry.selectPipeline.
+		p, done, err = c.registry.selectPipeline(ctx, msg.MessageHeader.TenantJiscID, c.watchers.activeJobs, func(p Pipeline) error {
+			var err error
+			id, t, err = c.startTransfer(ctx, p, msg, &body.ResearchObjectBase)
+			if err != nil {
+				c.destroySession(t)
+			}
+			return err
+		})
+		if errors.Is(err, UnknownTenantErr) {
+			return errors.Wrap(UnknownTenantErr, strconv.Itoa(int(msg.MessageHeader.TenantJiscID)))
+		}
+		if err != nil {
+			return errors.Wrap(err, "transfer cannot be started")
+		}
+		c.logger.Debugf("The transfer has started successfully in pipeline %s, id: %s", p.ID, id)
+		if err := c.storage.AssociateResearchObject(ctx, researchObject.ObjectUUID.String(), id, p.ID); err != nil {
+			// We don't want to discard the message at this point.
+			c.logger.Errorf("Error trying to persist the research object: %v", err)
+		}
 	}
-	aipid, err := amclient.WaitUntilStored(c.ctx, amClient, id)
+	defer done()
+	h.update(func(info *HandlerInfo) {
+		info.Stage = StageWaitingIngest
+		info.PipelineID = p.ID
+		info.TransferID = id
+	})
+	amClient := p.Client
+	aipid, err := c.watchers.get(amClient).Wait(ctx, id)
 	if err != nil {
-		return err
+		// The error is sent back to RDSS so depositors know why it failed.
+		var failedErr *amclient.IngestFailedError
+		if errors.As(err, &failedErr) {
+			c.logger.WithFields(logrus.Fields{
+				"transfer":     failedErr.TransferID,
+				"sip":          failedErr.SIPID,
+				"microservice": failedErr.Microservice,
+				"job":          failedErr.JobID,
+			}).Error("Ingest failed")
+		}
+		return errors.Wrap(err, "AIP could not be stored")
 	}
 	aipuuid, err := message.ParseUUID(aipid)
 	if err != nil {
 		return errors.Wrap(err, "SIP UUID is invalid")
 	}
+	if err := c.storage.AssociateAIP(ctx, msg.MessageHeader.TenantJiscID, researchObject.ObjectUUID.String(), aipid); err != nil {
+		// The AIP won't be audited but we don't want to discard the message.
+		c.logger.Errorf("Error trying to persist the AIP: %v", err)
+	}
+	h.update(func(info *HandlerInfo) { info.Stage = StagePublishing })
 	var (
 		packageTypeAIP        = message.PackageTypeEnum_AIP
 		packageContainerType  = message.ContainerTypeEnum_zip
 		preservationEventType = message.PreservationEventTypeEnum_informationPackageCreation
 	)
-	err = c.broker.Preservation.Event(c.ctx, &message.PreservationEventRequest{
+	err = c.broker.Preservation.Event(ctx, &message.PreservationEventRequest{
 		InformationPackage: message.InformationPackage{
 			ObjectUUID:           researchObject.ObjectUUID,
 			PackageUUID:          aipuuid,
@@ -72,9 +131,43 @@ func (c *Adapter) handleMetadataCreateRequest(msg *message.Message) error {
 	if err != nil {
 		return errors.Wrap(err, "PreservationEvent message could not be sent")
 	}
+	c.publishIngestEvents(amClient, researchObject.ObjectUUID, aipuuid, id, aipid)
+	if c.cleanup {
+		c.cleanupTransfer(amClient, t, id, aipid)
+	}
 	return nil
 }
 
+// publishIngestEvents publishes the preservation events found in the job log
+// of the transfer and the SIP. Failures are only logged since the package has
+// been preserved already.
+func (c *Adapter) publishIngestEvents(amClient *amclient.Client, objectUUID, packageUUID *message.UUID, transferID, SIPID string) {
+	logger := c.logger.WithFields(logrus.Fields{"transfer": transferID, "sip": SIPID})
+	events, err := ingestEvents(c.ctx, amClient, transferID, SIPID)
+	if err != nil {
+		logger.WithError(err).Error("Preservation events cannot be retrieved from the job log")
+		return
+	}
+	var (
+		packageTypeAIP       = message.PackageTypeEnum_AIP
+		packageContainerType = message.ContainerTypeEnum_zip
+	)
+	for _, event := range events {
+		err := c.broker.Preservation.Event(c.ctx, &message.PreservationEventRequest{
+			InformationPackage: message.InformationPackage{
+				ObjectUUID:               objectUUID,
+				PackageUUID:              packageUUID,
+				PackageType:              &packageTypeAIP,
+				PackageContainerType:     &packageContainerType,
+				PackagePreservationEvent: event,
+			},
+		})
+		if err != nil {
+			logger.WithError(err).Error("PreservationEvent message could not be sent")
+		}
+	}
+}
+
 // handleMetadataUpdateRequest handles the reception of Metadata Update
 // messages. It may result in a package being reingested if it's been already
 // preserved before.
@@ -84,9 +177,9 @@ func (c *Adapter) handleMetadataUpdateRequest(msg *message.Message) error {
 	if err != nil {
 		return err
 	}
-	amClient := c.registry.Get(msg.MessageHeader.TenantJiscID)
-	if amClient == nil {
-		return errors.Wrap(UnknownTenantErr, fmt.Sprint(msg.MessageHeader.TenantJiscID))
+	tenantID := msg.MessageHeader.TenantJiscID
+	if c.registry.Get(tenantID) == nil {
+		return errors.Wrap(UnknownTenantErr, fmt.Sprint(tenantID))
 	}
 	researchObject := body.InferResearchObject()
 	// Determine if the message is pointing to a previous dataset.
@@ -103,44 +196,80 @@ func (c *Adapter) handleMetadataUpdateRequest(msg *message.Message) error {
 		return nil // Stop here, ignore message.
 	}
 	// Determine match.IdentifierValue's (ObjectUUID) is a known dataset.
-	transferID, err := c.storage.GetResearchObject(c.ctx, match.Identifier.IdentifierValue)
+	transferID, pipelineID, err := c.storage.GetResearchObject(c.ctx, match.Identifier.IdentifierValue)
 	if err != nil {
 		logger.WithFields(logrus.Fields{"err": err, "IdentifierValue": match.Identifier.IdentifierValue}).Warn("Cannot fetch or find associated object in the local store.")
 		return nil
 	}
 	// At this point we know the previous transferID so we could reingest.
-	// In this first iteration we're just starting a new transfer.
-	logger.WithFields(logrus.Fields{"transferID": transferID, "TODO": "Implement real reingest."}).Debug("Reingesting transfer.")
-	_, err = c.startTransfer(amClient, researchObject)
+	// In this first iteration we're just starting a new transfer, in the
+	// pipeline that holds the previous one when it is still known.
+	logger.WithFields(logrus.Fields{"transferID": transferID, "pipeline": pipelineID, "TODO": "Implement real reingest."}).Debug("Reingesting transfer.")
+	if amClient := c.registry.Pipeline(tenantID, pipelineID); amClient != nil {
+		_, t, err := c.startTransfer(c.ctx, Pipeline{ID: pipelineID, Client: amClient}, msg, &body.ResearchObjectBase)
+		if err != nil {
+			c.destroySession(t)
+		}
+		return err
+	}
+	logger.WithField("pipeline", pipelineID).Warn("Pipeline of the previous transfer not found in the registry.")
+	_, done, err := c.registry.selectPipeline(c.ctx, tenantID, c.watchers.activeJobs, func(p Pipeline) error {
+		_, t, err := c.startTransfer(c.ctx, p, msg, &body.ResearchObjectBase)
+		if err != nil {
+			c.destroySession(t)
+		}
+		return err
+	})
 	if err != nil {
 		return err
 	}
+	done()
 	return nil
 }
 
-func (c *Adapter) startTransfer(amClient *amclient.Client, researchObject *message.ResearchObject) (string, error) {
+// destroySession removes the directory of a transfer session that could not be
+// started. It is nil-safe.
+func (c *Adapter) destroySession(t *amclient.TransferSession) {
+	if t == nil {
+		return
+	}
+	if err := t.Destroy(); err != nil {
+		c.logger.Warningf("Error destroying transfer: %v", err)
+	}
+}
+
+// startTransfer submits the research object as a new transfer using the
+// settings of the tenant found in the registry. The transfer session is
+// returned so its directory can be removed once the transfer is completed.
+func (c *Adapter) startTransfer(ctx context.Context, p Pipeline, msg *message.Message, base *message.ResearchObjectBase) (string, *amclient.TransferSession, error) {
+	researchObject := base.InferResearchObject()
 	// Ignore messages with no files listed.
 	if len(researchObject.ObjectFile) == 0 {
-		return "", nil
+		return "", nil, nil
 	}
-	t, err := amClient.TransferSession(researchObject.ObjectTitle)
+	tenantID := msg.MessageHeader.TenantJiscID
+	cw := c.registry.tenantCrosswalk(tenantID)
+	t, err := p.Client.TransferSession(researchObject.ObjectTitle)
 	if err != nil {
-		return "", errors.Wrap(err, "transfer session cannot be initialized")
+		return "", nil, &pipelineUnavailableError{errors.Wrap(err, "transfer session cannot be initialized")}
+	}
+	config, missing := c.registry.processingConfig(tenantID, p.ID, researchObject)
+	if missing != "" {
+		c.logger.WithFields(logrus.Fields{"tenantJiscID": tenantID, "pipeline": p.ID, "processingConfig": missing}).Warn("Processing configuration not found in the pipeline, the default configuration is used instead")
+	}
+	t.WithProcessingConfig(config)
+	t.WithTransferType(c.registry.tenantTransferType(tenantID))
+	if st := c.registry.tenantStaging(tenantID); st != nil {
+		t.WithStager(&objectStager{storage: c.s3, staging: st})
 	}
-	t.WithProcessingConfig(archivematicaProcessingConfig)
 	// Process dataset metadata.
-	describeDataset(t, researchObject)
+	cw.describeDataset(t, researchObject, base)
+	describeBag(t, researchObject)
+	if err := writeSourceMetadata(t, msg, researchObject, base); err != nil {
+		c.destroySession(t)
+		return "", nil, err
+	}
 	for _, file := range researchObject.ObjectFile {
-		// Add checksum metadata. We're not going to verify checksums at this
-		// point because this is something meant to do by Archivematica.
-		for _, c := range file.FileChecksum {
-			switch c.ChecksumType {
-			case message.ChecksumTypeEnum_md5:
-				t.ChecksumMD5(file.FileName, c.ChecksumValue)
-			case message.ChecksumTypeEnum_sha256:
-				t.ChecksumSHA256(file.FileName, c.ChecksumValue)
-			}
-		}
 		// Download and describe each file.
 		// Using an anonymous function so I can use defer inside this loop.
 		func() {
@@ -151,23 +280,39 @@ func (c *Adapter) startTransfer(amClient *amclient.Client, researchObject *messa
 				return
 			}
 			defer f.Close()
-			if err = downloadFile(c.logger, c.ctx, c.s3, http.DefaultClient, f, file.FileStoragePlatform.StoragePlatformType, file.FileStorageLocation, nil); err != nil {
+			// The transfer session may have renamed the file.
+			name := f.Name()
+			// Add checksum metadata. We're not going to verify checksums at
+			// this point because this is something meant to do by
+			// Archivematica.
+			for _, c := range file.FileChecksum {
+				switch c.ChecksumType {
+				case message.ChecksumTypeEnum_md5:
+					t.ChecksumMD5(name, c.ChecksumValue)
+				case message.ChecksumTypeEnum_sha256:
+					t.ChecksumSHA256(name, c.ChecksumValue)
+				}
+			}
+			if err = downloadFile(c.logger, ctx, c.s3, http.DefaultClient, f, file.FileStoragePlatform.StoragePlatformType, file.FileStorageLocation, nil); err != nil {
 				return
 			}
-			describeFile(t, file.FileName, &file)
+			cw.describeFile(t, name, &file)
+			describePremisRights(t, name, &file, &researchObject.ObjectRights)
 		}()
 		// Just a single error is enough for us to halt the transfer completely.
 		if err == nil {
 			continue
 		}
-		defer func() {
-			if err := t.Destroy(); err != nil {
-				c.logger.Warningf("Error destroying transfer: %v", err)
-			}
-		}()
-		return "", err
+		defer c.destroySession(t)
+		return "", nil, err
 	}
-	return t.Start()
+	id, err := t.Start(ctx)
+	var startErr *amclient.TransferStartError
+	if err != nil && !errors.As(err, &startErr) {
+		// The transfer could not be written in the pipeline.
+		err = &pipelineUnavailableError{err}
+	}
+	return id, t, err
 }
 
 // retry is a retry-backoff time provider that manages times between retries for the http storage type.
@@ -235,74 +380,3 @@ func downloadFileHTTP(ctx context.Context, httpClient *http.Client, target io.Wr
 
 	return io.Copy(target, resp.Body)
 }
-
-// describeDataset maps properties from a research object into a CSV entry
-// in the `metadata.csv` file used in `amclient`.
-// No need to assign the identifierType now as the XSD has a fixed value of "DOI"
-// If this gets more types in future it can be added in the ObjectIdentifier loop with
-//  t.Describe("identifierType", item.IdentifierType)
-func describeDataset(t *amclient.TransferSession, f *message.ResearchObject) {
-	t.Describe("dc.title", f.ObjectTitle)
-	t.Describe("dc.type", f.ObjectResourceType.String())
-
-	for _, item := range f.ObjectIdentifier {
-		t.Describe("dc.identifier", item.IdentifierValue)
-		// No need to assign this now as the XSD has a fixed value of "DOI"
-		// t.Describe("identifierType", item.IdentifierType)
-	}
-
-	for _, item := range f.ObjectDate {
-		if item.DateType != message.DateTypeEnum_published {
-			continue
-		}
-		t.Describe("dcterms.issued", item.DateValue.String())
-		t.Describe("dc.publicationYear", item.DateValue.String())
-	}
-
-	for _, item := range f.ObjectOrganisationRole {
-		t.Describe("dc.publisher", item.Organisation.OrganisationName)
-	}
-
-	for _, item := range f.ObjectPersonRole {
-		if item.Role == message.PersonRoleEnum_dataCreator {
-			t.Describe(
-				"dc.creatorName",
-				normalizeNames(
-					item.Person.PersonGivenNames,
-					item.Person.PersonFamilyNames,
-				),
-			)
-		}
-		if item.Role == message.PersonRoleEnum_publisher {
-			t.Describe(
-				"dc.publisher",
-				normalizeNames(
-					item.Person.PersonGivenNames,
-					item.Person.PersonFamilyNames,
-				),
-			)
-		}
-	}
-
-}
-
-// normalizeNames will return a "familyNames, givenNames" string
-// construct if both values are available. Else, it will use the data
-// given to return either "givenNames" or "familyNames".
-func normalizeNames(givenNames string, familyNames string) string {
-	if familyNames == "" {
-		return givenNames
-	}
-	if givenNames == "" {
-		return familyNames
-	}
-	return fmt.Sprintf("%s, %s", familyNames, givenNames)
-}
-
-// describeFile maps properties from an intellectual asset into a CSV entry
-// in the `metadata.csv` file used in `amclient`.
-func describeFile(t *amclient.TransferSession, name string, f *message.File) {
-	n := fmt.Sprintf("objects/%s", name)
-	t.DescribeFile(n, "dc.identifier", f.FileIdentifier)
-	t.DescribeFile(n, "dc.title", f.FileName)
-}
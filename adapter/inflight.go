@@ -0,0 +1,196 @@
+package adapter
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/broker/message"
+
+	"github.com/pkg/errors"
+)
+
+// Stages of the handlers of the datasets, see HandlerInfo.
+const (
+	StageSelectingPipeline = "selecting pipeline"
+	StageWaitingIngest     = "waiting for ingest"
+	StagePublishing        = "publishing"
+)
+
+// maxFailedHandlers is how many failed handlers are remembered so they can be
+// retried. The oldest failures are forgotten first.
+const maxFailedHandlers = 100
+
+var (
+	errHandlerInFlight = errors.New("object in flight")
+	errNoFailedHandler = errors.New("no failed handler to retry")
+)
+
+// HandlerInfo describes a handler of a dataset.
+type HandlerInfo struct {
+	MessageID    string    `json:"messageID"`
+	ObjectUUID   string    `json:"objectUUID"`
+	TenantJiscID uint64    `json:"tenantJiscID"`
+	Stage        string    `json:"stage,omitempty"`
+	PipelineID   string    `json:"pipeline,omitempty"`
+	TransferID   string    `json:"transferID,omitempty"`
+	Started      time.Time `json:"started"`
+	Retry        bool      `json:"retry,omitempty"` // Started by Retry.
+}
+
+// FailedHandler describes a handler of a dataset that failed.
+type FailedHandler struct {
+	HandlerInfo
+	Error  string    `json:"error"`
+	Failed time.Time `json:"failed"`
+
+	msg *message.Message
+}
+
+// handler is a handler of a dataset in flight.
+type handler struct {
+	info   HandlerInfo
+	cancel context.CancelFunc
+	mu     sync.Mutex
+}
+
+func (h *handler) update(fn func(*HandlerInfo)) {
+	h.mu.Lock()
+	fn(&h.info)
+	h.mu.Unlock()
+}
+
+func (h *handler) snapshot() HandlerInfo {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.info
+}
+
+// handlers tracks the handlers of the datasets in flight and remembers the
+// ones that failed.
+type handlers struct {
+	running map[*handler]struct{}
+	failed  map[string]*FailedHandler // By object UUID.
+	mu      sync.Mutex
+}
+
+func newHandlers() *handlers {
+	return &handlers{
+		running: make(map[*handler]struct{}),
+		failed:  make(map[string]*FailedHandler),
+	}
+}
+
+// start tracks a new handler. The context returned is canceled by cancel or
+// when the parent context is.
+func (hs *handlers) start(parent context.Context, msg *message.Message, objectUUID string, retry bool) (*handler, context.Context) {
+	ctx, cancel := context.WithCancel(parent)
+	h := &handler{
+		info: HandlerInfo{
+			MessageID:    msg.ID(),
+			ObjectUUID:   objectUUID,
+			TenantJiscID: msg.MessageHeader.TenantJiscID,
+			Started:      time.Now(),
+			Retry:        retry,
+		},
+		cancel: cancel,
+	}
+	hs.mu.Lock()
+	hs.running[h] = struct{}{}
+	hs.mu.Unlock()
+	return h, ctx
+}
+
+// finish stops tracking a handler. Failed handlers are remembered along with
+// their message, successful ones clear the previous failures of the dataset.
+func (hs *handlers) finish(h *handler, msg *message.Message, err error) {
+	h.cancel()
+	info := h.snapshot()
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	delete(hs.running, h)
+	if err == nil {
+		delete(hs.failed, info.ObjectUUID)
+		return
+	}
+	hs.failed[info.ObjectUUID] = &FailedHandler{
+		HandlerInfo: info,
+		Error:       err.Error(),
+		Failed:      time.Now(),
+		msg:         msg,
+	}
+	if len(hs.failed) > maxFailedHandlers {
+		var oldest *FailedHandler
+		for _, f := range hs.failed {
+			if oldest == nil || f.Failed.Before(oldest.Failed) {
+				oldest = f
+			}
+		}
+		delete(hs.failed, oldest.ObjectUUID)
+	}
+}
+
+// list returns the handlers in flight, oldest first.
+func (hs *handlers) list() []HandlerInfo {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	list := make([]HandlerInfo, 0, len(hs.running))
+	for h := range hs.running {
+		list = append(list, h.snapshot())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Started.Before(list[j].Started) })
+	return list
+}
+
+// find returns the handlers in flight of a dataset and its last failure, if
+// it is remembered.
+func (hs *handlers) find(objectUUID string) ([]HandlerInfo, *FailedHandler) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	var running []HandlerInfo
+	for h := range hs.running {
+		if info := h.snapshot(); info.ObjectUUID == objectUUID {
+			running = append(running, info)
+		}
+	}
+	var failed *FailedHandler
+	if f, ok := hs.failed[objectUUID]; ok {
+		copy := *f
+		failed = &copy
+	}
+	return running, failed
+}
+
+// cancel cancels the handlers in flight of a dataset. It returns how many
+// were canceled.
+func (hs *handlers) cancel(objectUUID string) int {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	n := 0
+	for h := range hs.running {
+		if h.snapshot().ObjectUUID == objectUUID {
+			h.cancel()
+			n++
+		}
+	}
+	return n
+}
+
+// takeFailed returns the message of the last failed handler of a dataset and
+// forgets it, so it is only retried once. Datasets in flight are not retried.
+func (hs *handlers) takeFailed(objectUUID string) (*message.Message, error) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	for h := range hs.running {
+		if h.snapshot().ObjectUUID == objectUUID {
+			return nil, errHandlerInFlight
+		}
+	}
+	f, ok := hs.failed[objectUUID]
+	if !ok {
+		return nil, errNoFailedHandler
+	}
+	delete(hs.failed, objectUUID)
+	return f.msg, nil
+}
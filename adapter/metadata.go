@@ -0,0 +1,378 @@
+package adapter
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/amclient"
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/broker/message"
+
+	"github.com/pkg/errors"
+)
+
+// dateLayout is the layout used to format dates in the transfer metadata.
+const dateLayout = "2006-01-02"
+
+// dateTypeFields maps the date types to DC/DCTerms elements. Published dates
+// are special-cased in describeDataset.
+var dateTypeFields = map[message.DateTypeEnum]string{
+	message.DateTypeEnum_accepted:    "dcterms.dateAccepted",
+	message.DateTypeEnum_approved:    "dc.date",
+	message.DateTypeEnum_available:   "dcterms.available",
+	message.DateTypeEnum_awarded:     "dc.date",
+	message.DateTypeEnum_collected:   "dc.date",
+	message.DateTypeEnum_copyrighted: "dcterms.dateCopyrighted",
+	message.DateTypeEnum_created:     "dcterms.created",
+	message.DateTypeEnum_issued:      "dcterms.issued",
+	message.DateTypeEnum_modified:    "dcterms.modified",
+	message.DateTypeEnum_posted:      "dcterms.dateSubmitted",
+}
+
+// descriptionTypeFields maps the description types to DCTerms refinements.
+// Other description types are mapped to "dc.description".
+var descriptionTypeFields = map[message.DescriptionTypeEnum]string{
+	message.DescriptionTypeEnum_abstract:        "dcterms.abstract",
+	message.DescriptionTypeEnum_tableOfContents: "dcterms.tableOfContents",
+}
+
+// relationTypeFields maps the relation types to DCTerms refinements. Other
+// relation types are mapped to "dc.relation".
+var relationTypeFields = map[message.RelationTypeEnum]string{
+	message.RelationTypeEnum_hasPart:             "dcterms.hasPart",
+	message.RelationTypeEnum_isPartOf:            "dcterms.isPartOf",
+	message.RelationTypeEnum_isNewVersionOf:      "dcterms.isVersionOf",
+	message.RelationTypeEnum_isPreviousVersionOf: "dcterms.hasVersion",
+	message.RelationTypeEnum_isReferencedBy:      "dcterms.isReferencedBy",
+	message.RelationTypeEnum_references:          "dcterms.references",
+	message.RelationTypeEnum_isRequiredBy:        "dcterms.isRequiredBy",
+	message.RelationTypeEnum_requires:            "dcterms.requires",
+	message.RelationTypeEnum_isDerivedFrom:       "dc.source",
+	message.RelationTypeEnum_isBasedOn:           "dc.source",
+	message.RelationTypeEnum_basedOnData:         "dc.source",
+}
+
+// describeDataset maps properties from a research object into a CSV entry
+// in the `metadata.csv` file used in `amclient`.
+// No need to assign the identifierType now as the XSD has a fixed value of "DOI"
+// If this gets more types in future it can be added in the ObjectIdentifier
+// loop with `t.Describe("identifierType", item.IdentifierType)`.
+func describeDataset(t *amclient.TransferSession, f *message.ResearchObject) {
+	t.Describe("dc.title", f.ObjectTitle)
+	t.Describe("dc.type", f.ObjectResourceType.String())
+
+	for _, item := range f.ObjectIdentifier {
+		t.Describe("dc.identifier", item.IdentifierValue)
+	}
+
+	for _, item := range f.ObjectDate {
+		value, ok := formatDate(item.DateValue)
+		if !ok {
+			continue
+		}
+		if item.DateType == message.DateTypeEnum_published {
+			t.Describe("dcterms.issued", value)
+			t.Describe("dc.publicationYear", value[:4])
+			continue
+		}
+		if field, ok := dateTypeFields[item.DateType]; ok {
+			t.Describe(field, value)
+		}
+	}
+
+	for _, item := range f.ObjectDescription {
+		field, ok := descriptionTypeFields[item.DescriptionType]
+		if !ok {
+			field = "dc.description"
+		}
+		describeValue(t, field, item.DescriptionValue)
+	}
+
+	for _, item := range f.ObjectKeyword {
+		describeValue(t, "dc.subject", item)
+	}
+	for _, item := range f.ObjectCategory {
+		describeValue(t, "dc.subject", item)
+	}
+
+	for _, item := range f.ObjectRelatedIdentifier {
+		field, ok := relationTypeFields[item.RelationType]
+		if !ok {
+			field = "dc.relation"
+		}
+		describeValue(t, field, item.Identifier.IdentifierValue)
+	}
+
+	for _, item := range f.ObjectOrganisationRole {
+		var field string
+		switch item.Role {
+		case message.OrganisationRoleEnum_publisher:
+			field = "dc.publisher"
+		case message.OrganisationRoleEnum_author:
+			field = "dc.creatorName"
+		case message.OrganisationRoleEnum_rightsHolder:
+			field = "dcterms.rightsHolder"
+		default:
+			field = "dc.contributor"
+		}
+		describeValue(t, field, item.Organisation.OrganisationName)
+	}
+
+	for _, item := range f.ObjectPersonRole {
+		var field string
+		switch item.Role {
+		case message.PersonRoleEnum_dataCreator, message.PersonRoleEnum_author:
+			field = "dc.creatorName"
+		case message.PersonRoleEnum_publisher:
+			field = "dc.publisher"
+		case message.PersonRoleEnum_rightsHolder:
+			field = "dcterms.rightsHolder"
+		default:
+			field = "dc.contributor"
+		}
+		describeValue(t, field, normalizeNames(
+			item.Person.PersonGivenNames,
+			item.Person.PersonFamilyNames,
+		))
+	}
+
+	describeRights(func(field, value string) {
+		t.Describe(field, value)
+	}, &f.ObjectRights)
+}
+
+// describeSubtype maps the properties that are specific to the subtypes of
+// research object, i.e. articles, datasets and theses or dissertations. They
+// are not available in the research object returned by InferResearchObject.
+func describeSubtype(t *amclient.TransferSession, b *message.ResearchObjectBase) {
+	switch {
+	case b.Article != nil:
+		describeLanguage(t, b.Article.Language)
+		describeCoverage(t, &b.Article.Coverage)
+		describeJournal(t, &b.Article.Journal)
+	case b.Dataset != nil:
+		describeLanguage(t, b.Dataset.Language)
+		describeCoverage(t, &b.Dataset.Coverage)
+	case b.ThesisDissertation != nil:
+		describeLanguage(t, b.ThesisDissertation.Language)
+		describeCoverage(t, &b.ThesisDissertation.Coverage)
+		describeValue(t, "dcterms.educationLevel", b.ThesisDissertation.QualificationLevel)
+		describeValue(t, "dcterms.educationLevel", b.ThesisDissertation.QualificationName)
+	}
+}
+
+func describeLanguage(t *amclient.TransferSession, languages []string) {
+	for _, item := range languages {
+		describeValue(t, "dc.language", item)
+	}
+}
+
+// describeCoverage maps the geospatial coverage into "dcterms.spatial" and the
+// temporal coverage into "dcterms.temporal" using an ISO 8601 time interval.
+// The missing end of an open interval is written as "..", following ISO
+// 8601-2, e.g. "2001-01-01/..".
+func describeCoverage(t *amclient.TransferSession, c *message.Coverage) {
+	for _, item := range c.GeospatialCoverage {
+		if item.GeolocationPlace != "" {
+			t.Describe("dcterms.spatial", item.GeolocationPlace)
+		}
+		if item.GeolocationPoint != nil {
+			t.Describe("dcterms.spatial", formatPoint(*item.GeolocationPoint))
+		}
+		if len(item.GeolocationPolygon) > 0 {
+			points := make([]string, len(item.GeolocationPolygon))
+			for i, point := range item.GeolocationPolygon {
+				points[i] = formatPoint(point)
+			}
+			t.Describe("dcterms.spatial", strings.Join(points, "; "))
+		}
+	}
+	start, hasStart := formatDate(c.TemporalCoverageStart)
+	end, hasEnd := formatDate(c.TemporalCoverageEnd)
+	if !hasStart {
+		start = ".."
+	}
+	if !hasEnd {
+		end = ".."
+	}
+	if hasStart || hasEnd {
+		t.Describe("dcterms.temporal", fmt.Sprintf("%s/%s", start, end))
+	}
+}
+
+// describeJournal maps the journal of an article into "dcterms.isPartOf" and
+// a "dcterms.bibliographicCitation", e.g. "Nature, 7(2), 10-20".
+func describeJournal(t *amclient.TransferSession, j *message.Journal) {
+	describeValue(t, "dcterms.isPartOf", j.FullTitle)
+	if j.ISSN != "" {
+		t.Describe("dcterms.isPartOf", "urn:ISSN:"+j.ISSN)
+	}
+	citation := j.FullTitle
+	if j.JournalVolume != "" {
+		citation = joinNonEmpty(", ", citation, j.JournalVolume)
+		if j.JournalIssue != "" {
+			citation = fmt.Sprintf("%s(%s)", citation, j.JournalIssue)
+		}
+	}
+	if j.FirstPage != "" {
+		pages := j.FirstPage
+		if j.LastPage != "" {
+			pages = fmt.Sprintf("%s-%s", j.FirstPage, j.LastPage)
+		}
+		citation = joinNonEmpty(", ", citation, pages)
+	}
+	describeValue(t, "dcterms.bibliographicCitation", citation)
+}
+
+// describeRights maps rights statements, holders, licences and access
+// conditions using the given function. It is shared by the dataset and the
+// file crosswalks.
+func describeRights(describe func(field, value string), r *message.Rights) {
+	for _, item := range r.RightsStatement {
+		if item != "" {
+			describe("dc.rights", item)
+		}
+	}
+	for _, item := range r.RightsHolder {
+		if item != "" {
+			describe("dcterms.rightsHolder", item)
+		}
+	}
+	for _, item := range r.Licence {
+		value := item.LicenceIdentifier
+		if value == "" {
+			value = item.LicenceName
+		}
+		if value != "" {
+			describe("dcterms.license", value)
+		}
+	}
+	for _, item := range r.Access {
+		describe("dcterms.accessRights", joinNonEmpty(": ", item.AccessType.String(), item.AccessStatement))
+	}
+}
+
+// normalizeNames will return a "familyNames, givenNames" string
+// construct if both values are available. Else, it will use the data
+// given to return either "givenNames" or "familyNames".
+func normalizeNames(givenNames string, familyNames string) string {
+	if familyNames == "" {
+		return givenNames
+	}
+	if givenNames == "" {
+		return familyNames
+	}
+	return fmt.Sprintf("%s, %s", familyNames, givenNames)
+}
+
+// describeFile maps properties from an intellectual asset into a CSV entry
+// in the `metadata.csv` file used in `amclient`.
+func describeFile(t *amclient.TransferSession, name string, f *message.File) {
+	n := fmt.Sprintf("objects/%s", name)
+	describe := func(field, value string) {
+		if value != "" {
+			t.DescribeFile(n, field, value)
+		}
+	}
+	t.DescribeFile(n, "dc.identifier", f.FileIdentifier)
+	t.DescribeFile(n, "dc.title", f.FileName)
+	describe("dc.description", f.FileLabel)
+	describe("dc.format", f.FileFormatType)
+	if f.FileDateCreated != nil {
+		if value, ok := formatDate(*f.FileDateCreated); ok {
+			describe("dcterms.created", value)
+		}
+	}
+	for _, item := range f.FileDateModified {
+		if value, ok := formatDate(item); ok {
+			describe("dcterms.modified", value)
+		}
+	}
+	if f.FileRights != nil {
+		describeRights(describe, f.FileRights)
+	}
+}
+
+// describeBag maps properties of the research object into the `bag-info.txt`
+// file of the transfer, which is only written when the transfer is a bag.
+func describeBag(t *amclient.TransferSession, f *message.ResearchObject) {
+	for _, item := range f.ObjectOrganisationRole {
+		if item.Role == message.OrganisationRoleEnum_publisher {
+			t.DescribeBag("Source-Organization", item.Organisation.OrganisationName)
+		}
+	}
+	if f.ObjectUUID != nil {
+		t.DescribeBag("External-Identifier", f.ObjectUUID.String())
+	}
+	for _, item := range f.ObjectIdentifier {
+		t.DescribeBag("External-Identifier", item.IdentifierValue)
+	}
+	t.DescribeBag("External-Description", f.ObjectTitle)
+	for _, item := range f.ObjectDescription {
+		t.DescribeBag("Internal-Sender-Description", item.DescriptionValue)
+	}
+}
+
+// writeSourceMetadata includes the original RDSS message and a DataCite
+// document generated from the research object in the metadata directory of the
+// transfer, i.e. "metadata/rdss/message.json" and "metadata/datacite.xml".
+func writeSourceMetadata(t *amclient.TransferSession, msg *message.Message, f *message.ResearchObject, b *message.ResearchObjectBase) error {
+	blob, err := msg.Raw()
+	if err != nil {
+		return errors.Wrap(err, "cannot encode message")
+	}
+	if err := writeMetadataFile(t, "rdss/message.json", func(w io.Writer) error {
+		_, err := w.Write(blob)
+		return err
+	}); err != nil {
+		return err
+	}
+	return writeMetadataFile(t, "datacite.xml", newDataCite(f, b).Write)
+}
+
+func writeMetadataFile(t *amclient.TransferSession, name string, write func(io.Writer) error) error {
+	file, err := t.CreateMetadataFile(name)
+	if err != nil {
+		return errors.Wrapf(err, "cannot create %s", name)
+	}
+	defer file.Close()
+	if err := write(file); err != nil {
+		return errors.Wrapf(err, "cannot write %s", name)
+	}
+	return nil
+}
+
+// describeValue registers metadata of the whole dataset unless the value is
+// empty.
+func describeValue(t *amclient.TransferSession, field, value string) {
+	if value == "" {
+		return
+	}
+	t.Describe(field, value)
+}
+
+// formatDate formats a timestamp using dateLayout. It reports false when the
+// timestamp is not set.
+func formatDate(ts message.Timestamp) (string, bool) {
+	tt := time.Time(ts)
+	if tt.IsZero() {
+		return "", false
+	}
+	return tt.Format(dateLayout), true
+}
+
+func formatPoint(p message.GeolocationPoint) string {
+	return fmt.Sprintf("%g %g", p.Latitude, p.Longitude)
+}
+
+// joinNonEmpty concatenates the non-empty elements using the given separator.
+func joinNonEmpty(sep string, elems ...string) string {
+	values := []string{}
+	for _, elem := range elems {
+		if elem != "" {
+			values = append(values, elem)
+		}
+	}
+	return strings.Join(values, sep)
+}
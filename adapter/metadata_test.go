@@ -0,0 +1,445 @@
+package adapter
+
+import (
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/amclient"
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/broker/message"
+)
+
+var metadataGenerationTests = map[string]struct {
+	researchObject message.ResearchObject // Given this research object,
+	expected       []string               // CSV record that we expect, as a slice of strings.
+}{
+	"No family name": {
+		researchObject: message.ResearchObject{
+			ObjectTitle: "ObjectTitle1",
+			ObjectPersonRole: []message.PersonRole{
+				{
+					Role: message.PersonRoleEnum_dataCreator,
+					Person: message.Person{
+						PersonGivenNames:  "Kat",
+						PersonFamilyNames: "",
+					},
+				},
+				{
+					Role: message.PersonRoleEnum_publisher,
+					Person: message.Person{
+						PersonGivenNames:  "Joan",
+						PersonFamilyNames: "",
+					},
+				},
+			},
+			ObjectIdentifier: []message.Identifier{
+				{
+					IdentifierType:  message.IdentifierTypeEnum_DOI,
+					IdentifierValue: "10.5072/FK2/QAWS8O",
+				},
+			},
+		},
+		expected: []string{"objects/", "Kat", "10.5072/FK2/QAWS8O", "Joan", "ObjectTitle1", "artDesignItem"},
+	},
+	"No given name": {
+		researchObject: message.ResearchObject{
+			ObjectTitle: "ObjectTitle2",
+			ObjectPersonRole: []message.PersonRole{
+				{
+					Role: message.PersonRoleEnum_dataCreator,
+					Person: message.Person{
+						PersonGivenNames:  "",
+						PersonFamilyNames: "Winter",
+					},
+				},
+				{
+					Role: message.PersonRoleEnum_publisher,
+					Person: message.Person{
+						PersonGivenNames:  "",
+						PersonFamilyNames: "Watson",
+					},
+				},
+			},
+			ObjectIdentifier: []message.Identifier{
+				{
+					IdentifierType:  message.IdentifierTypeEnum_DOI,
+					IdentifierValue: "10.5072/FK2/QAWS81",
+				},
+			},
+		},
+		expected: []string{"objects/", "Winter", "10.5072/FK2/QAWS81", "Watson", "ObjectTitle2", "artDesignItem"},
+	},
+	"Both names": {
+		researchObject: message.ResearchObject{
+			ObjectTitle: "ObjectTitle3",
+			ObjectPersonRole: []message.PersonRole{
+				{
+					Role: message.PersonRoleEnum_dataCreator,
+					Person: message.Person{
+						PersonGivenNames:  "Kat",
+						PersonFamilyNames: "Winter",
+					},
+				},
+				{
+					Role: message.PersonRoleEnum_publisher,
+					Person: message.Person{
+						PersonGivenNames:  "Joan",
+						PersonFamilyNames: "Watson",
+					},
+				},
+			},
+			ObjectIdentifier: []message.Identifier{
+				{
+					IdentifierType:  message.IdentifierTypeEnum_DOI,
+					IdentifierValue: "10.5072/FK2/QAWS82",
+				},
+			},
+		},
+		expected: []string{"objects/", "Winter, Kat", "10.5072/FK2/QAWS82", "Watson, Joan", "ObjectTitle3", "artDesignItem"},
+	},
+	"Contributors": {
+		researchObject: message.ResearchObject{
+			ObjectTitle: "ObjectTitle4",
+			ObjectPersonRole: []message.PersonRole{
+				{
+					Role: message.PersonRoleEnum_editor,
+					Person: message.Person{
+						PersonGivenNames:  "Kat",
+						PersonFamilyNames: "Winter",
+					},
+				},
+				{
+					Role: message.PersonRoleEnum_other,
+					Person: message.Person{
+						PersonGivenNames:  "Joan",
+						PersonFamilyNames: "Watson",
+					},
+				},
+			},
+			ObjectIdentifier: []message.Identifier{
+				{
+					IdentifierType:  message.IdentifierTypeEnum_DOI,
+					IdentifierValue: "10.5072/FK2/QAWS83",
+				},
+			},
+		},
+		expected: []string{"objects/", "Winter, Kat", "Watson, Joan", "10.5072/FK2/QAWS83", "ObjectTitle4", "artDesignItem"},
+	},
+}
+
+// TestMetadataGeneration inspects some of the internal functionality of the
+// channel adapter and ensures that from a given metadata set the correct fields
+// are mapped into an object which then returns an expected CSV configuration
+// for Archivematica. The test round-trips the CSV generation and checks that
+// when it is consumed the row data is as is expected.
+func TestMetadataGeneration(t *testing.T) {
+	for name, tc := range metadataGenerationTests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			fs := afero.Afero{Fs: afero.NewBasePathFs(afero.NewMemMapFs(), "/")}
+			transferSession := amclient.TransferSession{
+				Metadata: amclient.NewMetadataSet(fs),
+			}
+
+			describeDataset(&transferSession, &tc.researchObject)
+			transferSession.Metadata.Write()
+
+			const mdFile string = "/metadata/metadata.csv"
+			csvFile, err := fs.Open(mdFile)
+			assert.NoError(t, err, "cannot open CSV file")
+
+			csvObject := csv.NewReader(csvFile)
+
+			// Read the first line so we can move onto the row data.
+			_, err = csvObject.Read()
+			assert.NoError(t, err, "cannot read CSV file")
+
+			// Read the second line, the row data.
+			record, err := csvObject.Read()
+			assert.NoError(t, err, "cannot read CSV file")
+			assert.Equal(t, len(record), len(tc.expected), "unexpected length in the CSV record")
+			assert.EqualValues(t, tc.expected, record, "incorrect value in CSV record")
+		})
+	}
+}
+
+// newMetadataTransferSession returns a TransferSession that can only be used
+// to describe metadata.
+func newMetadataTransferSession() *amclient.TransferSession {
+	fs := afero.Afero{Fs: afero.NewBasePathFs(afero.NewMemMapFs(), "/")}
+	return &amclient.TransferSession{
+		Metadata: amclient.NewMetadataSet(fs),
+		BagInfo:  &amclient.BagInfo{},
+	}
+}
+
+func date(year int, month time.Month, day int) message.Timestamp {
+	return message.Timestamp(time.Date(year, month, day, 0, 0, 0, 0, time.UTC))
+}
+
+func TestDescribeDataset(t *testing.T) {
+	t.Parallel()
+
+	ts := newMetadataTransferSession()
+	describeDataset(ts, &message.ResearchObject{
+		ObjectTitle:        "Title",
+		ObjectResourceType: message.ResourceTypeEnum_dataset,
+		ObjectIdentifier: []message.Identifier{
+			{IdentifierType: message.IdentifierTypeEnum_DOI, IdentifierValue: "10.5072/FK2/QAWS8O"},
+		},
+		ObjectDate: []message.Date{
+			{DateType: message.DateTypeEnum_published, DateValue: date(2017, time.March, 17)},
+			{DateType: message.DateTypeEnum_created, DateValue: date(2016, time.January, 2)},
+			{DateType: message.DateTypeEnum_collected, DateValue: date(2015, time.May, 30)},
+			{DateType: message.DateTypeEnum_modified},
+		},
+		ObjectDescription: []message.ObjectDescription{
+			{DescriptionType: message.DescriptionTypeEnum_abstract, DescriptionValue: "Abstract"},
+			{DescriptionType: message.DescriptionTypeEnum_methods, DescriptionValue: "Methods"},
+		},
+		ObjectKeyword:  []string{"birds", "sounds"},
+		ObjectCategory: []string{"zoology"},
+		ObjectRelatedIdentifier: []message.IdentifierRelationship{
+			{RelationType: message.RelationTypeEnum_isPartOf, Identifier: message.Identifier{IdentifierValue: "10.5072/parent"}},
+			{RelationType: message.RelationTypeEnum_cites, Identifier: message.Identifier{IdentifierValue: "10.5072/cited"}},
+		},
+		ObjectOrganisationRole: []message.OrganisationRole{
+			{Role: message.OrganisationRoleEnum_publisher, Organisation: message.Organisation{OrganisationName: "Jisc"}},
+			{Role: message.OrganisationRoleEnum_funder, Organisation: message.Organisation{OrganisationName: "UKRI"}},
+		},
+		ObjectPersonRole: []message.PersonRole{
+			{Role: message.PersonRoleEnum_author, Person: message.Person{PersonGivenNames: "Kat", PersonFamilyNames: "Winter"}},
+			{Role: message.PersonRoleEnum_rightsHolder, Person: message.Person{PersonGivenNames: "Joan", PersonFamilyNames: "Watson"}},
+		},
+		ObjectRights: message.Rights{
+			RightsStatement: []string{"All rights reserved."},
+			RightsHolder:    []string{"University of Nowhere"},
+			Licence: []message.Licence{
+				{LicenceName: "CC BY 4.0", LicenceIdentifier: "https://creativecommons.org/licenses/by/4.0/"},
+				{LicenceName: "Custom"},
+			},
+			Access: []message.Access{
+				{AccessType: message.AccessTypeEnum_open},
+				{AccessType: message.AccessTypeEnum_restricted, AccessStatement: "Staff only."},
+			},
+		},
+	})
+
+	assert.Equal(t, [][2]string{
+		{"dc.title", "Title"},
+		{"dc.type", "dataset"},
+		{"dc.identifier", "10.5072/FK2/QAWS8O"},
+		{"dcterms.issued", "2017-03-17"},
+		{"dc.publicationYear", "2017"},
+		{"dcterms.created", "2016-01-02"},
+		{"dc.date", "2015-05-30"},
+		{"dcterms.abstract", "Abstract"},
+		{"dc.description", "Methods"},
+		{"dc.subject", "birds"},
+		{"dc.subject", "sounds"},
+		{"dc.subject", "zoology"},
+		{"dcterms.isPartOf", "10.5072/parent"},
+		{"dc.relation", "10.5072/cited"},
+		{"dc.publisher", "Jisc"},
+		{"dc.contributor", "UKRI"},
+		{"dc.creatorName", "Winter, Kat"},
+		{"dcterms.rightsHolder", "Watson, Joan"},
+		{"dc.rights", "All rights reserved."},
+		{"dcterms.rightsHolder", "University of Nowhere"},
+		{"dcterms.license", "https://creativecommons.org/licenses/by/4.0/"},
+		{"dcterms.license", "Custom"},
+		{"dcterms.accessRights", "open"},
+		{"dcterms.accessRights", "restricted: Staff only."},
+	}, ts.Metadata.Entries()["objects/"])
+}
+
+func TestDescribeSubtype(t *testing.T) {
+	coverage := message.Coverage{
+		GeospatialCoverage: []message.GeospatialCoverage{
+			{GeolocationPlace: "Edinburgh"},
+			{GeolocationPoint: &message.GeolocationPoint{Latitude: 55.95, Longitude: -3.19}},
+			{GeolocationPolygon: []message.GeolocationPoint{{Latitude: 1, Longitude: 2}, {Latitude: 3, Longitude: 4}}},
+		},
+		TemporalCoverageStart: date(2001, time.January, 1),
+		TemporalCoverageEnd:   date(2002, time.December, 31),
+	}
+	coverageEntries := [][2]string{
+		{"dcterms.spatial", "Edinburgh"},
+		{"dcterms.spatial", "55.95 -3.19"},
+		{"dcterms.spatial", "1 2; 3 4"},
+		{"dcterms.temporal", "2001-01-01/2002-12-31"},
+	}
+
+	tests := map[string]struct {
+		base message.ResearchObjectBase
+		want [][2]string
+	}{
+		"Article": {
+			base: message.ResearchObjectBase{Article: &message.Article{
+				Language: []string{"en"},
+				Coverage: coverage,
+				Journal: message.Journal{
+					ISSN:          "1234-5678",
+					FullTitle:     "Journal of Birds",
+					JournalVolume: "7",
+					JournalIssue:  "2",
+					FirstPage:     "10",
+					LastPage:      "20",
+				},
+			}},
+			want: append(append([][2]string{{"dc.language", "en"}}, coverageEntries...),
+				[2]string{"dcterms.isPartOf", "Journal of Birds"},
+				[2]string{"dcterms.isPartOf", "urn:ISSN:1234-5678"},
+				[2]string{"dcterms.bibliographicCitation", "Journal of Birds, 7(2), 10-20"},
+			),
+		},
+		"Dataset": {
+			base: message.ResearchObjectBase{Dataset: &message.Dataset{
+				Language: []string{"en", "cy"},
+			}},
+			want: [][2]string{
+				{"dc.language", "en"},
+				{"dc.language", "cy"},
+			},
+		},
+		"Thesis": {
+			base: message.ResearchObjectBase{ThesisDissertation: &message.ThesisDissertation{
+				Coverage:           message.Coverage{TemporalCoverageStart: date(2001, time.January, 1)},
+				QualificationLevel: "doctoral",
+				QualificationName:  "PhD",
+			}},
+			want: [][2]string{
+				{"dcterms.temporal", "2001-01-01/.."},
+				{"dcterms.educationLevel", "doctoral"},
+				{"dcterms.educationLevel", "PhD"},
+			},
+		},
+		"Research object": {
+			base: message.ResearchObjectBase{ResearchObject: &message.ResearchObject{}},
+			want: nil,
+		},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ts := newMetadataTransferSession()
+			describeSubtype(ts, &tc.base)
+			assert.Equal(t, tc.want, ts.Metadata.Entries()["objects/"])
+		})
+	}
+}
+
+func TestDescribeCoverage(t *testing.T) {
+	tests := map[string]struct {
+		coverage message.Coverage
+		want     [][2]string
+	}{
+		"Closed": {
+			coverage: message.Coverage{TemporalCoverageStart: date(2001, time.January, 1), TemporalCoverageEnd: date(2005, time.December, 31)},
+			want:     [][2]string{{"dcterms.temporal", "2001-01-01/2005-12-31"}},
+		},
+		"Open end": {
+			coverage: message.Coverage{TemporalCoverageStart: date(2001, time.January, 1)},
+			want:     [][2]string{{"dcterms.temporal", "2001-01-01/.."}},
+		},
+		"Open start": {
+			coverage: message.Coverage{TemporalCoverageEnd: date(2005, time.December, 31)},
+			want:     [][2]string{{"dcterms.temporal", "../2005-12-31"}},
+		},
+		"None": {
+			want: nil,
+		},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ts := newMetadataTransferSession()
+			describeCoverage(ts, &tc.coverage)
+			assert.Equal(t, tc.want, ts.Metadata.Entries()["objects/"])
+		})
+	}
+}
+
+func TestDescribeFile(t *testing.T) {
+	t.Parallel()
+
+	created := date(2017, time.March, 1)
+	ts := newMetadataTransferSession()
+	describeFile(ts, "woodpigeon_1.jpg", &message.File{
+		FileIdentifier:   "1",
+		FileName:         "woodpigeon.jpg",
+		FileLabel:        "Woodpigeon",
+		FileFormatType:   "image/jpeg",
+		FileDateCreated:  &created,
+		FileDateModified: []message.Timestamp{date(2017, time.March, 2)},
+		FileRights: &message.Rights{
+			Licence: []message.Licence{{LicenceIdentifier: "CC0"}},
+			Access:  []message.Access{{AccessType: message.AccessTypeEnum_closed}},
+		},
+	})
+
+	assert.Equal(t, [][2]string{
+		{"dc.identifier", "1"},
+		{"dc.title", "woodpigeon.jpg"},
+		{"dc.description", "Woodpigeon"},
+		{"dc.format", "image/jpeg"},
+		{"dcterms.created", "2017-03-01"},
+		{"dcterms.modified", "2017-03-02"},
+		{"dcterms.license", "CC0"},
+		{"dcterms.accessRights", "closed"},
+	}, ts.Metadata.Entries()["objects/woodpigeon_1.jpg"])
+}
+
+func TestDescribeBag(t *testing.T) {
+	t.Parallel()
+
+	ts := newMetadataTransferSession()
+	describeBag(ts, &message.ResearchObject{
+		ObjectUUID:  message.MustUUID("5680e8e0-28a5-4b20-948e-fd0d08781e0b"),
+		ObjectTitle: "Research about birds",
+		ObjectIdentifier: []message.Identifier{
+			{IdentifierValue: "10.1000/182", IdentifierType: message.IdentifierTypeEnum_DOI},
+		},
+		ObjectDescription: []message.ObjectDescription{
+			{DescriptionValue: "Pictures and\nsounds", DescriptionType: message.DescriptionTypeEnum_abstract},
+		},
+		ObjectOrganisationRole: []message.OrganisationRole{
+			{Role: message.OrganisationRoleEnum_funder, Organisation: message.Organisation{OrganisationName: "Funder"}},
+			{Role: message.OrganisationRoleEnum_publisher, Organisation: message.Organisation{OrganisationName: "Jisc"}},
+		},
+	})
+
+	assert.Equal(t, [][2]string{
+		{"Source-Organization", "Jisc"},
+		{"External-Identifier", "5680e8e0-28a5-4b20-948e-fd0d08781e0b"},
+		{"External-Identifier", "10.1000/182"},
+		{"External-Description", "Research about birds"},
+		{"Internal-Sender-Description", "Pictures and sounds"},
+	}, ts.BagInfo.Entries())
+}
+
+func TestWriteSourceMetadata(t *testing.T) {
+	t.Parallel()
+
+	c, err := amclient.New(nil, "http://localhost", "", "", amclient.SetFs(afero.NewMemMapFs()))
+	assert.NoError(t, err)
+	ts, err := c.TransferSession("Test")
+	assert.NoError(t, err)
+
+	msg := message.New(message.MessageTypeEnum_MetadataCreate, message.MessageClassEnum_Command)
+	body, _ := msg.MetadataCreateRequest()
+	body.Dataset = &message.Dataset{ObjectTitle: "Title"}
+
+	err = writeSourceMetadata(ts, msg, body.InferResearchObject(), &body.ResearchObjectBase)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"metadata/datacite.xml", "metadata/rdss/message.json"}, ts.Contents())
+}
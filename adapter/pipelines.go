@@ -0,0 +1,283 @@
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/amclient"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PipelinePolicy configures how the clients of the registry communicate with
+// the pipelines of the tenants.
+type PipelinePolicy struct {
+	// ResponseTimeout is the time to wait for the response headers of a
+	// pipeline. Disabled when zero.
+	ResponseTimeout time.Duration
+
+	// Retry of the idempotent requests that fail because the pipeline is not
+	// available.
+	Retry amclient.RetryPolicy
+
+	// RateLimit is the maximum number of requests per second sent to a
+	// pipeline, in bursts of up to RateLimitBurst requests. Disabled when
+	// zero.
+	RateLimit      float64
+	RateLimitBurst int
+
+	// BreakerThreshold is the number of consecutive failures that stop the
+	// requests to a pipeline for BreakerCooldown. Disabled when zero.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// RegistryOpt are options for NewRegistry.
+type RegistryOpt func(*Registry)
+
+// WithPipelinePolicy is a registry option for configuring the clients of the
+// pipelines.
+func WithPipelinePolicy(p PipelinePolicy) RegistryOpt {
+	return func(r *Registry) {
+		r.policy = p
+		if p.ResponseTimeout > 0 {
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.ResponseHeaderTimeout = p.ResponseTimeout
+			r.httpClient = &http.Client{Transport: transport}
+		}
+	}
+}
+
+// pipelineGuard holds the rate limiter and the circuit breaker of an API. The
+// registry recreates the clients every time it is reloaded, the guards are
+// kept so their state is not lost.
+type pipelineGuard struct {
+	limiter  *amclient.RateLimiter
+	breaker  *amclient.CircuitBreaker
+	inFlight int64        // Transfers started and not completed yet.
+	missing  atomic.Value // Processing configurations not found, map[string]bool.
+}
+
+func (g *pipelineGuard) add(n int64) {
+	atomic.AddInt64(&g.inFlight, n)
+}
+
+func (g *pipelineGuard) inFlightCount() int64 {
+	return atomic.LoadInt64(&g.inFlight)
+}
+
+// setMissingConfigs records the processing configurations that were not found
+// in the pipeline the last time they were validated.
+func (g *pipelineGuard) setMissingConfigs(names []string) {
+	missing := make(map[string]bool, len(names))
+	for _, name := range names {
+		missing[name] = true
+	}
+	g.missing.Store(missing)
+}
+
+// missingConfig reports whether a processing configuration is known to be
+// missing in the pipeline.
+func (g *pipelineGuard) missingConfig(name string) bool {
+	missing, _ := g.missing.Load().(map[string]bool)
+	return missing[name]
+}
+
+// missingConfigs returns the processing configurations known to be missing in
+// the pipeline, sorted.
+func (g *pipelineGuard) missingConfigs() []string {
+	missing, _ := g.missing.Load().(map[string]bool)
+	names := make([]string, 0, len(missing))
+	for name := range missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// guard returns the guard of the API found in the given URL.
+func (r *Registry) guard(URL string) *pipelineGuard {
+	if g, ok := r.guards[URL]; ok {
+		return g
+	}
+	g := &pipelineGuard{}
+	if r.policy.RateLimit > 0 {
+		g.limiter = amclient.NewRateLimiter(r.policy.RateLimit, r.policy.RateLimitBurst)
+	}
+	if r.policy.BreakerThreshold > 0 {
+		g.breaker = amclient.NewCircuitBreaker(r.policy.BreakerThreshold, r.policy.BreakerCooldown)
+	}
+	r.guards[URL] = g
+	return g
+}
+
+// clientOpts returns the client options that apply the policy to the API
+// found in the given URL.
+func (r *Registry) clientOpts(URL string) []amclient.ClientOpt {
+	g := r.guard(URL)
+	opts := []amclient.ClientOpt{amclient.SetRetryPolicy(r.policy.Retry)}
+	if g.limiter != nil {
+		opts = append(opts, amclient.SetRateLimiter(g.limiter))
+	}
+	if g.breaker != nil {
+		opts = append(opts, amclient.SetCircuitBreaker(g.breaker))
+	}
+	return opts
+}
+
+// PipelineHealth describes the state of the APIs of a pipeline of a tenant.
+type PipelineHealth struct {
+	TenantJiscID      uint64
+	PipelineID        string
+	URL               string
+	StorageServiceURL string // Empty when the Storage Service is not known.
+
+	// States of the circuit breakers, closed when they are disabled.
+	Breaker               amclient.BreakerState
+	StorageServiceBreaker amclient.BreakerState
+}
+
+// Health returns the state of the APIs of the pipelines of the tenants,
+// sorted by tenant. The pipelines of a tenant keep the order of the registry.
+func (r *Registry) Health() []PipelineHealth {
+	r.RLock()
+	defer r.RUnlock()
+	health := make([]PipelineHealth, 0, len(r.r))
+	for tenantID, t := range r.r {
+		for _, p := range t.pipelines {
+			h := PipelineHealth{
+				TenantJiscID: tenantID,
+				PipelineID:   p.id,
+				URL:          p.client.BaseURL.String(),
+				Breaker:      breakerState(p.guard),
+			}
+			if ss := p.client.StorageService; ss != nil {
+				h.StorageServiceURL = ss.BaseURL().String()
+				h.StorageServiceBreaker = breakerState(p.ssGuard)
+			}
+			health = append(health, h)
+		}
+	}
+	sort.SliceStable(health, func(i, j int) bool {
+		return health[i].TenantJiscID < health[j].TenantJiscID
+	})
+	return health
+}
+
+// CheckPipelines checks that the APIs of the pipelines of the tenants are
+// reachable and accept their credentials. The results are indexed by tenant
+// and pipeline, e.g. "tenant 1, pipeline default" and "tenant 1, pipeline
+// default, storage service".
+func (r *Registry) CheckPipelines(ctx context.Context) map[string]error {
+	type ping func(context.Context) error
+	checks := map[string]ping{}
+	for tenantID, pipelines := range r.Pipelines() {
+		for _, p := range pipelines {
+			name := fmt.Sprintf("tenant %d, pipeline %s", tenantID, p.ID)
+			checks[name] = p.Client.Ping
+			if ss := p.Client.StorageService; ss != nil {
+				checks[name+", storage service"] = ss.Ping
+			}
+		}
+	}
+	var (
+		results = make(map[string]error, len(checks))
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+	)
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check ping) {
+			defer wg.Done()
+			err := check(ctx)
+			mu.Lock()
+			results[name] = err
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+	return results
+}
+
+// TransferDirs returns the directories where the transfers of the tenants are
+// built, sorted and without duplicates.
+func (r *Registry) TransferDirs() []string {
+	r.RLock()
+	defer r.RUnlock()
+	seen := map[string]bool{}
+	dirs := []string{}
+	for _, t := range r.r {
+		for _, p := range t.pipelines {
+			if p.transferDir != "" && !seen[p.transferDir] {
+				seen[p.transferDir] = true
+				dirs = append(dirs, p.transferDir)
+			}
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+func breakerState(g *pipelineGuard) amclient.BreakerState {
+	if g == nil || g.breaker == nil {
+		return amclient.BreakerClosed
+	}
+	return g.breaker.State()
+}
+
+var breakerStateDesc = prometheus.NewDesc(
+	"rdss_archivematica_channel_adapter_pipeline_breaker_state",
+	"State of the circuit breaker of the APIs of the tenants: 0 (closed), 1 (half-open) or 2 (open).",
+	[]string{"tenant", "pipeline", "api", "url"}, nil,
+)
+
+var processingConfigMissingDesc = prometheus.NewDesc(
+	"rdss_archivematica_channel_adapter_processing_config_missing",
+	"Processing configurations of the tenants not found in their pipelines, the default configuration is used instead.",
+	[]string{"tenant", "pipeline", "config"}, nil,
+)
+
+var registryRecordsDesc = prometheus.NewDesc(
+	"rdss_archivematica_channel_adapter_registry_records",
+	"Number of registry records loaded and rejected in the last load of the registry.",
+	[]string{"status"}, nil,
+)
+
+// Describe implements prometheus.Collector.
+func (r *Registry) Describe(ch chan<- *prometheus.Desc) {
+	ch <- breakerStateDesc
+	ch <- processingConfigMissingDesc
+	ch <- registryRecordsDesc
+}
+
+// Collect implements prometheus.Collector.
+func (r *Registry) Collect(ch chan<- prometheus.Metric) {
+	for _, h := range r.Health() {
+		tenant := strconv.FormatUint(h.TenantJiscID, 10)
+		ch <- prometheus.MustNewConstMetric(breakerStateDesc, prometheus.GaugeValue,
+			float64(h.Breaker), tenant, h.PipelineID, "dashboard", h.URL)
+		if h.StorageServiceURL != "" {
+			ch <- prometheus.MustNewConstMetric(breakerStateDesc, prometheus.GaugeValue,
+				float64(h.StorageServiceBreaker), tenant, h.PipelineID, "storage_service", h.StorageServiceURL)
+		}
+	}
+	for _, t := range r.Tenants() {
+		tenant := strconv.FormatUint(t.TenantJiscID, 10)
+		for _, p := range t.Pipelines {
+			for _, name := range p.MissingProcessingConfigs {
+				ch <- prometheus.MustNewConstMetric(processingConfigMissingDesc, prometheus.GaugeValue, 1, tenant, p.ID, name)
+			}
+		}
+	}
+	r.RLock()
+	loaded, rejected := r.loaded, r.rejected
+	r.RUnlock()
+	ch <- prometheus.MustNewConstMetric(registryRecordsDesc, prometheus.GaugeValue, float64(loaded), "loaded")
+	ch <- prometheus.MustNewConstMetric(registryRecordsDesc, prometheus.GaugeValue, float64(rejected), "rejected")
+}
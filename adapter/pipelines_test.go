@@ -0,0 +1,112 @@
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/amclient"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_pipelinePolicy(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	m := &dynamock{}
+	m.On(
+		"ScanWithContext",
+		mock.AnythingOfType("*context.cancelCtx"),
+		mock.Anything,
+	).Return(&dynamodb.ScanOutput{
+		Items: []map[string]*dynamodb.AttributeValue{
+			{
+				"tenantJiscID": &dynamodb.AttributeValue{S: aws.String("1")},
+				"url":          &dynamodb.AttributeValue{S: aws.String(server.URL)},
+				"ssURL":        &dynamodb.AttributeValue{S: aws.String("http://ss.example.com")},
+			},
+		},
+	}, nil)
+
+	r, err := NewRegistry(logrus.StandardLogger(), m, "mockTable", WithPipelinePolicy(PipelinePolicy{
+		ResponseTimeout:  time.Second,
+		Retry:            amclient.RetryPolicy{MaxRetries: 1, InitialInterval: time.Millisecond},
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Hour,
+	}))
+	require.NoError(t, err)
+	defer r.Stop()
+
+	_, _, err = r.Get(1).Jobs.List(context.Background(), "unit", &amclient.JobsListRequest{})
+	assert.Error(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests), "request was not retried")
+
+	// The state of the breaker survives the reloads.
+	require.NoError(t, r.load())
+	assert.Equal(t, []PipelineHealth{{
+		TenantJiscID:          1,
+		PipelineID:            "default",
+		URL:                   server.URL,
+		StorageServiceURL:     "http://ss.example.com",
+		Breaker:               amclient.BreakerOpen,
+		StorageServiceBreaker: amclient.BreakerClosed,
+	}}, r.Health())
+	_, _, err = r.Get(1).Jobs.List(context.Background(), "unit", &amclient.JobsListRequest{})
+	assert.Equal(t, amclient.ErrCircuitOpen, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	err = testutil.CollectAndCompare(r, strings.NewReader(`
+# HELP rdss_archivematica_channel_adapter_pipeline_breaker_state State of the circuit breaker of the APIs of the tenants: 0 (closed), 1 (half-open) or 2 (open).
+# TYPE rdss_archivematica_channel_adapter_pipeline_breaker_state gauge
+rdss_archivematica_channel_adapter_pipeline_breaker_state{api="dashboard",pipeline="default",tenant="1",url="`+server.URL+`"} 2
+rdss_archivematica_channel_adapter_pipeline_breaker_state{api="storage_service",pipeline="default",tenant="1",url="http://ss.example.com"} 0
+`), "rdss_archivematica_channel_adapter_pipeline_breaker_state")
+	assert.NoError(t, err)
+}
+
+func TestRegistry_CheckPipelines(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "ApiKey user:key" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, "{}")
+	}))
+	defer server.Close()
+
+	source := &testRegistrySource{}
+	source.set([]RegistryRecord{
+		{TenantJiscID: "1", ArchivematicaURL: server.URL, ArchivematicaUser: "user", ArchivematicaKey: "key", ArchivematicaTransferDir: "/transfers/1"},
+		{TenantJiscID: "2", ArchivematicaURL: server.URL, ArchivematicaUser: "user", ArchivematicaKey: "wrong", ArchivematicaTransferDir: "/transfers/2",
+			StorageServiceURL: server.URL, StorageServiceUser: "user", StorageServiceKey: "key",
+			Pipelines: []RegistryPipeline{{ID: "b", ArchivematicaURL: server.URL, ArchivematicaTransferDir: "/transfers/1"}}},
+	}, nil)
+	r, err := NewRegistryFromSource(logrus.StandardLogger(), source)
+	require.NoError(t, err)
+	defer r.Stop()
+
+	results := r.CheckPipelines(context.Background())
+	assert.Len(t, results, 4)
+	assert.NoError(t, results["tenant 1, pipeline default"])
+	assert.Error(t, results["tenant 2, pipeline default"])
+	assert.NoError(t, results["tenant 2, pipeline default, storage service"])
+	assert.Error(t, results["tenant 2, pipeline b"])
+
+	assert.Equal(t, []string{"/transfers/1", "/transfers/2"}, r.TransferDirs())
+}
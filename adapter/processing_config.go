@@ -0,0 +1,109 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/amclient"
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/broker/message"
+
+	"github.com/pkg/errors"
+)
+
+// processingConfigs determines the Archivematica processing configuration used
+// by the transfers of a tenant. The configuration can be chosen based on the
+// resource type of the research object, e.g. "thesisDissertation", or on its
+// value, e.g. "veryHigh", in that order of precedence.
+type processingConfigs struct {
+	name          string
+	resourceTypes map[message.ResourceTypeEnum]string
+	objectValues  map[message.ObjectValueEnum]string
+}
+
+// newProcessingConfigs returns the processing configurations of a tenant. The
+// keys of the overrides are resource types or object values. Unknown keys are
+// returned in the error, but the rest of the overrides are still used.
+func newProcessingConfigs(name string, overrides map[string]string) (*processingConfigs, error) {
+	if name == "" {
+		name = archivematicaProcessingConfig
+	}
+	p := &processingConfigs{
+		name:          name,
+		resourceTypes: map[message.ResourceTypeEnum]string{},
+		objectValues:  map[message.ObjectValueEnum]string{},
+	}
+	unknown := []string{}
+	for key, config := range overrides {
+		data, _ := json.Marshal(key)
+		var (
+			resourceType message.ResourceTypeEnum
+			objectValue  message.ObjectValueEnum
+		)
+		if err := resourceType.UnmarshalJSON(data); err == nil {
+			p.resourceTypes[resourceType] = config
+		} else if err := objectValue.UnmarshalJSON(data); err == nil {
+			p.objectValues[objectValue] = config
+		} else {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return p, errors.Errorf("unknown resource types or object values: %s", strings.Join(unknown, ", "))
+	}
+	return p, nil
+}
+
+// resolve returns the name of the processing configuration of a research
+// object. It is nil-safe, the default configuration is used in that case.
+func (p *processingConfigs) resolve(ro *message.ResearchObject) string {
+	if p == nil {
+		return archivematicaProcessingConfig
+	}
+	if name, ok := p.resourceTypes[ro.ObjectResourceType]; ok {
+		return name
+	}
+	if name, ok := p.objectValues[ro.ObjectValue]; ok {
+		return name
+	}
+	return p.name
+}
+
+// names returns the names of the processing configurations used, sorted.
+func (p *processingConfigs) names() []string {
+	set := map[string]struct{}{p.name: {}}
+	for _, name := range p.resourceTypes {
+		set[name] = struct{}{}
+	}
+	for _, name := range p.objectValues {
+		set[name] = struct{}{}
+	}
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validate confirms that the processing configurations exist in the pipeline.
+// It returns the names of the configurations missing, and an error if the
+// pipeline could not be asked.
+func (p *processingConfigs) validate(ctx context.Context, c *amclient.Client) ([]string, error) {
+	missing := []string{}
+	for _, name := range p.names() {
+		_, _, err := c.ProcessingConfig.Get(ctx, name)
+		if err == nil {
+			continue
+		}
+		var errResp *amclient.ErrorResponse
+		if errors.As(err, &errResp) && errResp.Kind == amclient.ErrorKindNotFound {
+			missing = append(missing, name)
+			continue
+		}
+		return missing, errors.Wrapf(err, "processing configuration %s cannot be retrieved", name)
+	}
+	return missing, nil
+}
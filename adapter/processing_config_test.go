@@ -0,0 +1,69 @@
+package adapter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/amclient"
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/broker/message"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessingConfigs_resolve(t *testing.T) {
+	pcs, err := newProcessingConfigs("tenant", map[string]string{
+		"dataset":            "no-normalization",
+		"thesisDissertation": "theses",
+		"veryHigh":           "full",
+		"unknownType":        "foobar",
+	})
+	assert.EqualError(t, err, "unknown resource types or object values: unknownType")
+
+	tests := []struct {
+		resourceType message.ResourceTypeEnum
+		objectValue  message.ObjectValueEnum
+		want         string
+	}{
+		{message.ResourceTypeEnum_dataset, message.ObjectValueEnum_normal, "no-normalization"},
+		{message.ResourceTypeEnum_dataset, message.ObjectValueEnum_veryHigh, "no-normalization"},
+		{message.ResourceTypeEnum_thesisDissertation, message.ObjectValueEnum_normal, "theses"},
+		{message.ResourceTypeEnum_article, message.ObjectValueEnum_veryHigh, "full"},
+		{message.ResourceTypeEnum_article, message.ObjectValueEnum_high, "tenant"},
+	}
+	for _, tt := range tests {
+		ro := &message.ResearchObject{ObjectResourceType: tt.resourceType, ObjectValue: tt.objectValue}
+		assert.Equal(t, tt.want, pcs.resolve(ro), "%s/%s", tt.resourceType, tt.objectValue)
+	}
+	assert.Equal(t, []string{"full", "no-normalization", "tenant", "theses"}, pcs.names())
+
+	pcs, err = newProcessingConfigs("", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, archivematicaProcessingConfig, pcs.resolve(&message.ResearchObject{}))
+
+	pcs = nil
+	assert.Equal(t, archivematicaProcessingConfig, pcs.resolve(&message.ResearchObject{}))
+}
+
+func TestProcessingConfigs_validate(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/processing-configuration/automated/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<processingMCP/>"))
+	})
+	mux.HandleFunc("/api/processing-configuration/broken/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	c, _ := amclient.New(nil, server.URL, "", "")
+
+	pcs, _ := newProcessingConfigs("automated", map[string]string{"dataset": "missing"})
+	missing, err := pcs.validate(context.Background(), c)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"missing"}, missing)
+
+	pcs, _ = newProcessingConfigs("broken", nil)
+	_, err = pcs.validate(context.Background(), c)
+	assert.Error(t, err)
+}
@@ -2,102 +2,458 @@ package adapter
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"net/url"
+	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/JiscSD/rdss-archivematica-channel-adapter/amclient"
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/broker/message"
 	"github.com/pkg/errors"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 	"github.com/sirupsen/logrus"
 )
 
 var reloadFrequency = 10 * time.Second
 
-type registryRecord struct {
+// RegistryRecord describes a tenant, see RegistrySource.
+type RegistryRecord struct {
 	TenantJiscID             string `dynamodbav:"tenantJiscID"`
 	ArchivematicaURL         string `dynamodbav:"url"`
 	ArchivematicaUser        string `dynamodbav:"user"`
+	ArchivematicaKey         string `dynamodbav:"key"` // Or a reference, see SecretResolver.
+	ArchivematicaTransferDir string `dynamodbav:"transferDir"`
+	StorageServiceURL        string `dynamodbav:"ssURL"`
+	StorageServiceUser       string `dynamodbav:"ssUser"`
+	StorageServiceKey        string `dynamodbav:"ssKey"` // Or a reference, see SecretResolver.
+	Crosswalk                string `dynamodbav:"crosswalk"`
+
+	// Directory where the processing configurations of the pipeline are
+	// installed, i.e. sharedMicroserviceTasksConfigs/processingMCPConfigs in
+	// the shared directory, as seen by the adapter. Optional, it is only used
+	// by the processing-config sync command.
+	ProcessingConfigDir string `dynamodbav:"processingConfigDir"`
+
+	// Archivematica processing configuration and its overrides by resource
+	// type or object value.
+	ProcessingConfig  string            `dynamodbav:"processingConfig"`
+	ProcessingConfigs map[string]string `dynamodbav:"processingConfigs"`
+
+	// Transfer type: "standard" (default), "unzipped bag" or "zipped bag".
+	TransferType string `dynamodbav:"transferType"`
+
+	// Transfer source location of the Storage Service and the URL of the
+	// object store behind it, e.g. "s3://bucket/transfers". When both are
+	// given, transfers are staged there instead of in the transfer directory.
+	StagingLocation string `dynamodbav:"stagingLocation"`
+	StagingURL      string `dynamodbav:"stagingURL"`
+
+	// Capacity of the pipeline described above, see RegistryPipeline.
+	Capacity int `dynamodbav:"capacity"`
+
+	// Additional pipelines of the tenant and the strategy used to choose the
+	// pipeline of each transfer: "round robin" (default), "least in-flight"
+	// or "capacity".
+	Pipelines        []RegistryPipeline `dynamodbav:"pipelines"`
+	PipelineStrategy string             `dynamodbav:"pipelineStrategy"`
+}
+
+// RegistryPipeline describes one of the pipelines of a tenant. The pipeline
+// described by the top-level attributes of the record is identified as
+// "default".
+type RegistryPipeline struct {
+	ID                       string `dynamodbav:"id"`
+	ArchivematicaURL         string `dynamodbav:"url"`
+	ArchivematicaUser        string `dynamodbav:"user"`
 	ArchivematicaKey         string `dynamodbav:"key"`
 	ArchivematicaTransferDir string `dynamodbav:"transferDir"`
+	StorageServiceURL        string `dynamodbav:"ssURL"`
+	StorageServiceUser       string `dynamodbav:"ssUser"`
+	StorageServiceKey        string `dynamodbav:"ssKey"`
+	ProcessingConfigDir      string `dynamodbav:"processingConfigDir"`
+
+	// Number of jobs the pipeline can run at once, used by the capacity
+	// strategy. Defaults to one, i.e. the active jobs are compared.
+	Capacity int `dynamodbav:"capacity"`
+}
+
+// pipelines returns the pipelines described by the record, starting with the
+// one described by its top-level attributes when given.
+func (rec RegistryRecord) pipelines() []RegistryPipeline {
+	pipelines := make([]RegistryPipeline, 0, len(rec.Pipelines)+1)
+	if rec.ArchivematicaURL != "" || len(rec.Pipelines) == 0 {
+		pipelines = append(pipelines, RegistryPipeline{
+			ID:                       defaultPipelineID,
+			ArchivematicaURL:         rec.ArchivematicaURL,
+			ArchivematicaUser:        rec.ArchivematicaUser,
+			ArchivematicaKey:         rec.ArchivematicaKey,
+			ArchivematicaTransferDir: rec.ArchivematicaTransferDir,
+			StorageServiceURL:        rec.StorageServiceURL,
+			StorageServiceUser:       rec.StorageServiceUser,
+			StorageServiceKey:        rec.StorageServiceKey,
+			ProcessingConfigDir:      rec.ProcessingConfigDir,
+			Capacity:                 rec.Capacity,
+		})
+	}
+	return append(pipelines, rec.Pipelines...)
+}
+
+// tenant holds the resources loaded from the registry record of a tenant.
+type tenant struct {
+	pipelines         []*pipeline // At least one.
+	balancer          *balancer
+	crosswalk         *crosswalk // Nil when the built-in mapping is used.
+	processingConfigs *processingConfigs
+	transferType      string
+	staging           *staging // Nil when the transfer directory is shared.
+}
+
+// crosswalkFile is a crosswalk file that has been loaded before, even if it
+// was rejected. The registry reloads frequently, this avoids reading and
+// reporting the same file over and over again.
+type crosswalkFile struct {
+	modTime   time.Time
+	crosswalk *crosswalk
 }
 
 type Registry struct {
-	ctx            context.Context
-	cancel         context.CancelFunc
-	logger         logrus.FieldLogger
-	dynamodbClient dynamodbiface.DynamoDBAPI
-	dynamodbTable  string
-	reloadCh       chan struct{}
-	stopCh         chan chan struct{}
-	r              map[uint64]*amclient.Client
+	ctx        context.Context
+	cancel     context.CancelFunc
+	logger     logrus.FieldLogger
+	source     RegistrySource
+	reloadCh   chan struct{}
+	stopCh     chan chan struct{}
+	r          map[uint64]*tenant
+	crosswalks map[string]crosswalkFile
+	policy     PipelinePolicy
+	httpClient *http.Client
+	secrets    *SecretResolver
+	guards     map[string]*pipelineGuard
+	cursors    map[uint64]*uint32 // Round robin position of the tenants.
+	loaded     int                // Records used in the last load.
+	rejected   int                // Records rejected in the last load.
 	sync.RWMutex
 }
 
-// NewRegistry returns a usable registry.
-func NewRegistry(logger logrus.FieldLogger, dynamodbClient dynamodbiface.DynamoDBAPI, dynamodbTable string) (*Registry, error) {
+// NewRegistry returns a usable registry loaded from a DynamoDB table.
+func NewRegistry(logger logrus.FieldLogger, dynamodbClient dynamodbiface.DynamoDBAPI, dynamodbTable string, opts ...RegistryOpt) (*Registry, error) {
+	return NewRegistryFromSource(logger, NewDynamoDBRegistrySource(dynamodbClient, dynamodbTable), opts...)
+}
+
+// NewRegistryFromSource returns a usable registry loaded from the given
+// source. The registry is reloaded periodically, on demand (see Reload) and,
+// when the source is a RegistryWatcher, every time the source changes.
+func NewRegistryFromSource(logger logrus.FieldLogger, source RegistrySource, opts ...RegistryOpt) (*Registry, error) {
 	r := &Registry{
-		logger:         logger,
-		dynamodbClient: dynamodbClient,
-		dynamodbTable:  dynamodbTable,
-		reloadCh:       make(chan struct{}),
-		stopCh:         make(chan chan struct{}),
-		r:              make(map[uint64]*amclient.Client),
+		logger:     logger,
+		source:     source,
+		reloadCh:   make(chan struct{}),
+		stopCh:     make(chan chan struct{}),
+		r:          make(map[uint64]*tenant),
+		crosswalks: make(map[string]crosswalkFile),
+		httpClient: http.DefaultClient,
+		guards:     make(map[string]*pipelineGuard),
+		cursors:    make(map[uint64]*uint32),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.secrets == nil {
+		r.secrets = NewSecretResolver(logger, nil, 0)
 	}
 	r.ctx, r.cancel = context.WithCancel(context.Background())
 	if err := r.load(); err != nil {
-		return nil, errors.Wrap(err, "registry failed to load from source")
+		return nil, errors.Wrapf(err, "registry failed to load from source %s", source)
+	}
+	if w, ok := source.(RegistryWatcher); ok {
+		go func() {
+			if err := w.Watch(r.ctx, r.Reload); err != nil {
+				r.logger.WithError(err).WithField("source", source.String()).Error("Registry source cannot be watched, changes are only seen in the periodic reloads")
+			}
+		}()
 	}
 	go r.loop()
 	return r, nil
 }
 
-// load retrieves the registry records from DynamoDB into the local registry
-// data structure with initialized clients.
+// load retrieves the registry records from the source into the local registry
+// data structure with initialized clients. The registry is left as it was
+// when the source cannot be read. Records that cannot be used are reported
+// and skipped, the previous entry of their tenant is kept when there is one.
+// Tenants whose records are gone are removed.
 func (r *Registry) load() error {
-	res, err := r.dynamodbClient.ScanWithContext(r.ctx, &dynamodb.ScanInput{
-		TableName:      aws.String(r.dynamodbTable),
-		ConsistentRead: aws.Bool(true),
-	})
+	recs, rejected, err := r.source.Load(r.ctx)
 	if err != nil {
-		return errors.Wrap(err, "failed to scan registry")
+		return err
 	}
-	if len(res.Items) < 1 {
-		r.logger.WithField("table", r.dynamodbTable).Warn("Registry has been loaded but it is empty")
-		return nil
+	logger := r.logger.WithField("source", r.source.String())
+	r.RLock()
+	old := r.r
+	r.RUnlock()
+	newMap := make(map[uint64]*tenant, len(recs))
+	keep := map[uint64]bool{} // Tenants whose records were rejected.
+	nRejected := 0
+	reject := func(tenantJiscID string, err error) {
+		nRejected++
+		logger.WithError(err).WithField("tenantJiscID", tenantJiscID).Error("Registry record rejected")
+		if ID, err := strconv.ParseUint(tenantJiscID, 10, 64); err == nil {
+			keep[ID] = true
+		}
 	}
-	recs := []registryRecord{}
-	if err := dynamodbattribute.UnmarshalListOfMaps(res.Items, &recs); err != nil {
-		return errors.Wrap(err, "failed to unmarshal registry records")
+	for _, rej := range rejected {
+		reject(rej.TenantJiscID, rej.Err)
 	}
-	newMap := make(map[uint64]*amclient.Client)
 	for _, rec := range recs {
-		i, err := strconv.ParseInt(rec.TenantJiscID, 10, 64)
-		if err != nil {
-			return errors.Wrap(err, "failed to parse tenantJiscID")
+		ID, t, err := r.loadTenant(rec)
+		if err == nil && newMap[ID] != nil {
+			err = errors.Errorf("tenantJiscID %d is duplicated", ID)
 		}
-		c, err := amclient.New(
-			http.DefaultClient,
-			rec.ArchivematicaURL,
-			rec.ArchivematicaUser,
-			rec.ArchivematicaKey,
-			amclient.SetFsPath(rec.ArchivematicaTransferDir))
 		if err != nil {
-			return errors.Wrapf(err, "failed to create client for tenantJiscID %s", rec.TenantJiscID)
+			reject(rec.TenantJiscID, err)
+			continue
 		}
-		newMap[uint64(i)] = c
+		newMap[ID] = t
+	}
+	for ID := range keep {
+		if t, ok := old[ID]; ok && newMap[ID] == nil {
+			logger.WithField("tenantJiscID", ID).Warn("Previous registry entry kept")
+			newMap[ID] = t
+		}
+	}
+	if len(newMap) == 0 {
+		logger.Warn("Registry has been loaded but it is empty")
 	}
 	r.Lock()
 	r.r = newMap
+	r.loaded, r.rejected = len(recs)+len(rejected)-nRejected, nRejected
 	r.Unlock()
+	for ID := range old {
+		if _, ok := newMap[ID]; !ok {
+			logger.WithField("tenantJiscID", ID).Warn("Tenant removed from the registry")
+			delete(r.cursors, ID)
+		}
+	}
+	r.prune(recs)
+	return nil
+}
+
+// loadTenant creates the resources of the tenant described by a record.
+func (r *Registry) loadTenant(rec RegistryRecord) (uint64, *tenant, error) {
+	ID, err := strconv.ParseUint(rec.TenantJiscID, 10, 64)
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "invalid tenantJiscID %q", rec.TenantJiscID)
+	}
+	st := r.staging(rec)
+	pipelines, err := r.loadPipelines(rec, st != nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	if st != nil && len(pipelines) > 1 {
+		// The staging location belongs to the Storage Service of a pipeline.
+		return 0, nil, errors.Errorf("staging location cannot be shared by the %d pipelines of tenantJiscID %s", len(pipelines), rec.TenantJiscID)
+	}
+	pcs, err := newProcessingConfigs(rec.ProcessingConfig, rec.ProcessingConfigs)
+	if err != nil {
+		r.logger.WithError(err).WithField("tenantJiscID", rec.TenantJiscID).Error("Processing configuration overrides ignored")
+	}
+	cursor, ok := r.cursors[ID]
+	if !ok {
+		cursor = new(uint32)
+		r.cursors[ID] = cursor
+	}
+	return ID, &tenant{
+		pipelines:         pipelines,
+		balancer:          &balancer{strategy: r.pipelineStrategy(rec), cursor: cursor},
+		crosswalk:         r.loadCrosswalk(rec),
+		processingConfigs: pcs,
+		transferType:      r.transferType(rec),
+		staging:           st,
+	}, nil
+}
+
+// prune forgets the guards and the crosswalks that are no longer used by the
+// tenants of the registry.
+func (r *Registry) prune(recs []RegistryRecord) {
+	r.RLock()
+	used := map[*pipelineGuard]bool{}
+	for _, t := range r.r {
+		for _, p := range t.pipelines {
+			used[p.guard] = true
+			used[p.ssGuard] = true
+		}
+	}
+	r.RUnlock()
+	for URL, g := range r.guards {
+		if !used[g] {
+			delete(r.guards, URL)
+		}
+	}
+	crosswalks := map[string]bool{}
+	for _, rec := range recs {
+		crosswalks[rec.Crosswalk] = true
+	}
+	for path := range r.crosswalks {
+		if !crosswalks[path] {
+			delete(r.crosswalks, path)
+		}
+	}
+}
+
+// loadPipelines creates the clients of the pipelines of a record. Additional
+// pipelines without an identifier, or with one that is already taken, are
+// reported and ignored. Invalid URLs make the whole record invalid.
+func (r *Registry) loadPipelines(rec RegistryRecord, staged bool) ([]*pipeline, error) {
+	pipelines := []*pipeline{}
+	seen := map[string]bool{}
+	for _, p := range rec.pipelines() {
+		if p.ID == "" || seen[p.ID] {
+			r.logger.WithFields(logrus.Fields{
+				"tenantJiscID": rec.TenantJiscID,
+				"pipeline":     p.ID,
+				"url":          p.ArchivematicaURL,
+			}).Error("Pipeline ignored, its identifier is missing or duplicated")
+			continue
+		}
+		seen[p.ID] = true
+		if err := validateURL(p.ArchivematicaURL); err != nil {
+			return nil, errors.Wrapf(err, "invalid URL in pipeline %s", p.ID)
+		}
+		if p.StorageServiceURL != "" {
+			if err := validateURL(p.StorageServiceURL); err != nil {
+				return nil, errors.Wrapf(err, "invalid Storage Service URL in pipeline %s", p.ID)
+			}
+		}
+		key, err := r.secrets.Resolve(r.ctx, p.ArchivematicaKey)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid key in pipeline %s", p.ID)
+		}
+		transferDir := p.ArchivematicaTransferDir
+		if staged && transferDir == "" {
+			// Staged transfers are only built locally.
+			transferDir = os.TempDir()
+		}
+		opts := []amclient.ClientOpt{amclient.SetFsPath(transferDir)}
+		opts = append(opts, r.clientOpts(p.ArchivematicaURL)...)
+		var ssGuard *pipelineGuard
+		if p.StorageServiceURL != "" {
+			ssKey, err := r.secrets.Resolve(r.ctx, p.StorageServiceKey)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid Storage Service key in pipeline %s", p.ID)
+			}
+			ssGuard = r.guard(p.StorageServiceURL)
+			opts = append(opts, amclient.SetStorageService(amclient.NewStorageServiceClient(
+				r.httpClient,
+				p.StorageServiceURL,
+				p.StorageServiceUser,
+				ssKey,
+				r.clientOpts(p.StorageServiceURL)...)))
+		}
+		c, err := amclient.New(
+			r.httpClient,
+			p.ArchivematicaURL,
+			p.ArchivematicaUser,
+			key,
+			opts...)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create client for tenantJiscID %s (pipeline %s)", rec.TenantJiscID, p.ID)
+		}
+		capacity := p.Capacity
+		if capacity < 1 {
+			capacity = 1
+		}
+		pipelines = append(pipelines, &pipeline{
+			id:          p.ID,
+			client:      c,
+			guard:       r.guard(p.ArchivematicaURL),
+			ssGuard:     ssGuard,
+			ssURL:       p.StorageServiceURL,
+			capacity:    capacity,
+			transferDir: transferDir,
+			configDir:   p.ProcessingConfigDir,
+			keyRef:      describeSecret(p.ArchivematicaKey),
+			ssKeyRef:    describeSecret(p.StorageServiceKey),
+		})
+	}
+	if len(pipelines) == 0 {
+		return nil, errors.Errorf("no valid pipelines found for tenantJiscID %s", rec.TenantJiscID)
+	}
+	return pipelines, nil
+}
+
+// validateURL confirms that the URL of an API is an absolute HTTP(S) URL.
+func validateURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if !u.IsAbs() || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return errors.Errorf("%q is not an absolute HTTP URL", s)
+	}
 	return nil
 }
 
+// transferType returns the transfer type requested by the record. Unknown
+// types are reported and the standard type is used instead.
+func (r *Registry) transferType(rec RegistryRecord) string {
+	switch rec.TransferType {
+	case "":
+		return amclient.TransferTypeStandard
+	case amclient.TransferTypeStandard, amclient.TransferTypeUnzippedBag, amclient.TransferTypeZippedBag:
+		return rec.TransferType
+	}
+	r.logger.WithFields(logrus.Fields{
+		"tenantJiscID": rec.TenantJiscID,
+		"transferType": rec.TransferType,
+	}).Error("Unknown transfer type ignored")
+	return amclient.TransferTypeStandard
+}
+
+// staging returns the staging location described by the record, nil when the
+// record does not use one. Invalid locations are reported and ignored.
+func (r *Registry) staging(rec RegistryRecord) *staging {
+	if rec.StagingLocation == "" && rec.StagingURL == "" {
+		return nil
+	}
+	st, err := newStaging(rec.StagingLocation, rec.StagingURL)
+	if err != nil {
+		r.logger.WithError(err).WithField("tenantJiscID", rec.TenantJiscID).Error("Staging location ignored")
+		return nil
+	}
+	return st
+}
+
+// loadCrosswalk returns the crosswalk referenced by the record. Crosswalks that
+// cannot be loaded are reported and the built-in mapping is used instead.
+func (r *Registry) loadCrosswalk(rec RegistryRecord) *crosswalk {
+	if rec.Crosswalk == "" {
+		return nil
+	}
+	logger := r.logger.WithFields(logrus.Fields{
+		"tenantJiscID": rec.TenantJiscID,
+		"crosswalk":    rec.Crosswalk,
+	})
+	// A missing file has a zero modification time.
+	var modTime time.Time
+	if fi, err := os.Stat(rec.Crosswalk); err == nil {
+		modTime = fi.ModTime()
+	}
+	if f, ok := r.crosswalks[rec.Crosswalk]; ok && f.modTime.Equal(modTime) {
+		return f.crosswalk
+	}
+	cw, err := loadCrosswalk(rec.Crosswalk)
+	if err != nil {
+		logger.WithError(err).Error("Crosswalk is invalid, using the built-in mapping")
+	}
+	r.crosswalks[rec.Crosswalk] = crosswalkFile{modTime: modTime, crosswalk: cw}
+	return cw
+}
+
 func (r *Registry) loop() {
 	ticker := time.NewTicker(reloadFrequency)
 	for {
@@ -111,25 +467,248 @@ func (r *Registry) loop() {
 		case <-ticker.C:
 		case <-r.reloadCh:
 		}
-		_ = r.load()
+		if err := r.load(); err != nil && r.ctx.Err() == nil {
+			r.logger.WithError(err).WithField("source", r.source.String()).Error("Registry cannot be reloaded, the previous entries are kept")
+		}
 	}
 }
 
-// Get a client for a given tenant.
+// Get a client for a given tenant. It returns the first pipeline of tenants
+// with more than one pipeline.
 func (r *Registry) Get(tenantID uint64) *amclient.Client {
+	return r.Pipeline(tenantID, "")
+}
+
+// Pipeline returns the client of a pipeline of a given tenant. It returns the
+// first pipeline when the identifier is empty and nil when the tenant or the
+// pipeline are unknown.
+func (r *Registry) Pipeline(tenantID uint64, pipelineID string) *amclient.Client {
+	return findPipeline(r.Pipelines()[tenantID], pipelineID)
+}
+
+// Pipelines returns the pipelines of all the tenants.
+func (r *Registry) Pipelines() map[uint64][]Pipeline {
+	r.RLock()
+	defer r.RUnlock()
+	pipelines := make(map[uint64][]Pipeline, len(r.r))
+	for tenantID, t := range r.r {
+		for _, p := range t.pipelines {
+			pipelines[tenantID] = append(pipelines[tenantID], Pipeline{ID: p.id, Client: p.client, ProcessingConfigDir: p.configDir})
+		}
+	}
+	return pipelines
+}
+
+// TenantInfo describes a tenant of the registry. Keys are described as they
+// are in the logs, see describeSecret.
+type TenantInfo struct {
+	TenantJiscID      uint64         `json:"tenantJiscID"`
+	PipelineStrategy  string         `json:"pipelineStrategy"`
+	ProcessingConfigs []string       `json:"processingConfigs"`
+	TransferType      string         `json:"transferType"`
+	Crosswalk         string         `json:"crosswalk,omitempty"`
+	StagingLocation   string         `json:"stagingLocation,omitempty"`
+	StagingURL        string         `json:"stagingURL,omitempty"`
+	Pipelines         []PipelineInfo `json:"pipelines"`
+}
+
+// PipelineInfo describes a pipeline of a tenant, see TenantInfo.
+type PipelineInfo struct {
+	ID                    string `json:"id"`
+	URL                   string `json:"url"`
+	Key                   string `json:"key"`
+	Breaker               string `json:"breaker"`
+	InFlight              int64  `json:"inFlight"`
+	Capacity              int    `json:"capacity"`
+	TransferDir           string `json:"transferDir,omitempty"`
+	ProcessingConfigDir   string `json:"processingConfigDir,omitempty"`
+	StorageServiceURL     string `json:"storageServiceURL,omitempty"`
+	StorageServiceKey     string `json:"storageServiceKey,omitempty"`
+	StorageServiceBreaker string `json:"storageServiceBreaker,omitempty"`
+
+	// Processing configurations of the tenant not found in the pipeline.
+	MissingProcessingConfigs []string `json:"missingProcessingConfigs,omitempty"`
+}
+
+// Tenants describes the tenants of the registry sorted by identifier.
+func (r *Registry) Tenants() []TenantInfo {
 	r.RLock()
 	defer r.RUnlock()
-	return r.r[tenantID]
+	tenants := make([]TenantInfo, 0, len(r.r))
+	for tenantID, t := range r.r {
+		info := TenantInfo{
+			TenantJiscID:      tenantID,
+			PipelineStrategy:  t.balancer.strategy,
+			ProcessingConfigs: t.processingConfigs.names(),
+			TransferType:      t.transferType,
+		}
+		if t.crosswalk != nil {
+			info.Crosswalk = t.crosswalk.path
+		}
+		if t.staging != nil {
+			info.StagingLocation = t.staging.location
+			info.StagingURL = t.staging.url.String()
+		}
+		for _, p := range t.pipelines {
+			pi := PipelineInfo{
+				ID:                  p.id,
+				URL:                 p.client.BaseURL.String(),
+				Key:                 p.keyRef,
+				Breaker:             breakerState(p.guard).String(),
+				InFlight:            p.guard.inFlightCount(),
+				Capacity:            p.capacity,
+				TransferDir:         p.transferDir,
+				ProcessingConfigDir: p.configDir,
+			}
+			for _, name := range t.processingConfigs.names() {
+				if p.guard.missingConfig(name) {
+					pi.MissingProcessingConfigs = append(pi.MissingProcessingConfigs, name)
+				}
+			}
+			if p.ssGuard != nil {
+				pi.StorageServiceURL = p.ssURL
+				pi.StorageServiceKey = p.ssKeyRef
+				pi.StorageServiceBreaker = breakerState(p.ssGuard).String()
+			}
+			info.Pipelines = append(info.Pipelines, pi)
+		}
+		tenants = append(tenants, info)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].TenantJiscID < tenants[j].TenantJiscID })
+	return tenants
+}
+
+// tenantCrosswalk returns the crosswalk of a given tenant. It returns nil if
+// the tenant uses the built-in mapping.
+func (r *Registry) tenantCrosswalk(tenantID uint64) *crosswalk {
+	r.RLock()
+	defer r.RUnlock()
+	t, ok := r.r[tenantID]
+	if !ok {
+		return nil
+	}
+	return t.crosswalk
+}
+
+// tenantProcessingConfigs returns the processing configurations of a given
+// tenant. It returns nil if the tenant is unknown.
+func (r *Registry) tenantProcessingConfigs(tenantID uint64) *processingConfigs {
+	r.RLock()
+	defer r.RUnlock()
+	t, ok := r.r[tenantID]
+	if !ok {
+		return nil
+	}
+	return t.processingConfigs
+}
+
+// processingConfig returns the name of the processing configuration of a
+// research object transferred to a pipeline of a given tenant. The default
+// configuration is returned instead when the pipeline is known not to have it,
+// see ValidateProcessingConfigs, and the name of the missing one with it.
+func (r *Registry) processingConfig(tenantID uint64, pipelineID string, ro *message.ResearchObject) (name string, missing string) {
+	r.RLock()
+	defer r.RUnlock()
+	t, ok := r.r[tenantID]
+	if !ok {
+		return archivematicaProcessingConfig, ""
+	}
+	name = t.processingConfigs.resolve(ro)
+	for _, p := range t.pipelines {
+		if p.id == pipelineID && name != archivematicaProcessingConfig && p.guard.missingConfig(name) {
+			return archivematicaProcessingConfig, name
+		}
+	}
+	return name, ""
+}
+
+// tenantTransferType returns the transfer type of a given tenant. It returns
+// the standard type if the tenant is unknown.
+func (r *Registry) tenantTransferType(tenantID uint64) string {
+	r.RLock()
+	defer r.RUnlock()
+	t, ok := r.r[tenantID]
+	if !ok {
+		return amclient.TransferTypeStandard
+	}
+	return t.transferType
+}
+
+// tenantStaging returns the staging location of a given tenant. It returns nil
+// if the tenant is unknown or does not use one.
+func (r *Registry) tenantStaging(tenantID uint64) *staging {
+	r.RLock()
+	defer r.RUnlock()
+	t, ok := r.r[tenantID]
+	if !ok {
+		return nil
+	}
+	return t.staging
+}
+
+// ValidateProcessingConfigs confirms that the processing configurations named
+// in the registry exist in the pipelines of the tenants. The configurations
+// missing are reported and remembered: transfers use the default one instead
+// in those pipelines, see processingConfig. Pipelines that cannot be reached
+// are only reported.
+func (r *Registry) ValidateProcessingConfigs(ctx context.Context) {
+	r.RLock()
+	tenants := make(map[uint64]*tenant, len(r.r))
+	for tenantID, t := range r.r {
+		tenants[tenantID] = t
+	}
+	r.RUnlock()
+	missingByGuard := map[*pipelineGuard][]string{}
+	for tenantID, t := range tenants {
+		for _, p := range t.pipelines {
+			logger := r.logger.WithFields(logrus.Fields{"tenantJiscID": tenantID, "pipeline": p.id})
+			missing, err := t.processingConfigs.validate(ctx, p.client)
+			if err != nil {
+				logger.WithError(err).Warn("Processing configurations cannot be validated")
+			}
+			if len(missing) > 0 {
+				logger.WithField("processingConfigs", strings.Join(missing, ", ")).Error("Processing configurations not found in the pipeline, the default configuration is used instead")
+			}
+			missingByGuard[p.guard] = append(missingByGuard[p.guard], missing...)
+		}
+	}
+	for g, missing := range missingByGuard {
+		g.setMissingConfigs(missing)
+	}
 }
 
 func (r *Registry) Log() {
 	r.RLock()
 	defer r.RUnlock()
-	for tenantID, client := range r.r {
-		r.logger.WithFields(logrus.Fields{
+	for tenantID, t := range r.r {
+		urls := make([]string, 0, len(t.pipelines))
+		keys := make([]string, 0, len(t.pipelines))
+		for _, p := range t.pipelines {
+			urls = append(urls, fmt.Sprintf("%s=%s", p.id, p.client.BaseURL))
+			key := fmt.Sprintf("%s=%s", p.id, p.keyRef)
+			if p.ssGuard != nil {
+				key += fmt.Sprintf(" (ss=%s)", p.ssKeyRef)
+			}
+			keys = append(keys, key)
+		}
+		fields := logrus.Fields{
 			"tenantJiscID": tenantID,
-			"url":          client.BaseURL.String(),
-		}).Warn("Registry entry found")
+			"pipelines":    strings.Join(urls, ", "),
+			"keys":         strings.Join(keys, ", "),
+		}
+		if len(t.pipelines) > 1 {
+			fields["pipelineStrategy"] = t.balancer.strategy
+		}
+		if t.crosswalk != nil {
+			fields["crosswalk"] = t.crosswalk.path
+		}
+		fields["processingConfigs"] = strings.Join(t.processingConfigs.names(), ", ")
+		fields["transferType"] = t.transferType
+		if t.staging != nil {
+			fields["stagingLocation"] = t.staging.location
+			fields["stagingURL"] = t.staging.url.String()
+		}
+		r.logger.WithFields(fields).Warn("Registry entry found")
 	}
 }
 
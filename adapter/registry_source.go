@@ -0,0 +1,265 @@
+package adapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/fsnotify/fsnotify"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// RegistrySource is where the registry records of the tenants are loaded from.
+// Sources that can tell when their records change, e.g. FileRegistrySource,
+// also implement RegistryWatcher.
+type RegistrySource interface {
+	// Load returns the records of all the tenants. Records that cannot be
+	// decoded are returned as rejected so the others can still be used, the
+	// error is only returned when the source cannot be read at all.
+	Load(ctx context.Context) ([]RegistryRecord, []RejectedRecord, error)
+
+	// String describes the source in the logs, e.g. "dynamodb:table".
+	String() string
+}
+
+// RegistryWatcher is implemented by the sources that notify the changes of
+// their records. Watch calls changed after every change until the context is
+// canceled.
+type RegistryWatcher interface {
+	Watch(ctx context.Context, changed func()) error
+}
+
+// RejectedRecord is a record of the source that cannot be used.
+type RejectedRecord struct {
+	TenantJiscID string // Empty when it is not known.
+	Err          error
+}
+
+// DynamoDBRegistrySource loads the registry records from a DynamoDB table.
+type DynamoDBRegistrySource struct {
+	client dynamodbiface.DynamoDBAPI
+	table  string
+}
+
+var _ RegistrySource = (*DynamoDBRegistrySource)(nil)
+
+// NewDynamoDBRegistrySource returns a source that scans the given table.
+func NewDynamoDBRegistrySource(client dynamodbiface.DynamoDBAPI, table string) *DynamoDBRegistrySource {
+	return &DynamoDBRegistrySource{client: client, table: table}
+}
+
+// Load scans all the pages of the table. Items are decoded one by one so an
+// item with unexpected attributes is only rejected itself.
+func (s *DynamoDBRegistrySource) Load(ctx context.Context) ([]RegistryRecord, []RejectedRecord, error) {
+	input := &dynamodb.ScanInput{
+		TableName:      aws.String(s.table),
+		ConsistentRead: aws.Bool(true),
+	}
+	var (
+		recs     = []RegistryRecord{}
+		rejected []RejectedRecord
+	)
+	for {
+		res, err := s.client.ScanWithContext(ctx, input)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to scan registry")
+		}
+		for _, item := range res.Items {
+			rec := RegistryRecord{}
+			if err := dynamodbattribute.UnmarshalMap(item, &rec); err != nil {
+				var tenantJiscID string
+				if attr, ok := item["tenantJiscID"]; ok && attr.S != nil {
+					tenantJiscID = *attr.S
+				}
+				rejected = append(rejected, RejectedRecord{
+					TenantJiscID: tenantJiscID,
+					Err:          errors.Wrap(err, "failed to unmarshal registry record"),
+				})
+				continue
+			}
+			recs = append(recs, rec)
+		}
+		if len(res.LastEvaluatedKey) == 0 {
+			return recs, rejected, nil
+		}
+		input = &dynamodb.ScanInput{
+			TableName:         input.TableName,
+			ConsistentRead:    input.ConsistentRead,
+			ExclusiveStartKey: res.LastEvaluatedKey,
+		}
+	}
+}
+
+func (s *DynamoDBRegistrySource) String() string {
+	return "dynamodb:" + s.table
+}
+
+// FileRegistrySource loads the registry records from a local file. The format
+// is determined by the file extension: TOML (.toml), YAML (.yaml or .yml) or
+// JSON (.json). The records use the attributes of the DynamoDB table and are
+// listed under "tenants", e.g. in TOML:
+//
+//	[[tenants]]
+//	tenantJiscID = "1"
+//	url = "http://pipeline:8000"
+//	user = "user"
+//	key = "key"
+//	transferDir = "/mnt/share/tenant1"
+//
+// The transferDir is the path of a transfer source location of the Storage
+// Service. It must not be one of the watched directories of Archivematica,
+// which would start the transfers on its own while they are being written.
+//
+// Files that cannot be decoded are rejected as a whole, while records with
+// unknown or invalid attributes are rejected individually.
+type FileRegistrySource struct {
+	path string
+
+	// debounce is how long the changes of the file are left to settle,
+	// editors often write files in several steps.
+	debounce time.Duration
+}
+
+var (
+	_ RegistrySource  = (*FileRegistrySource)(nil)
+	_ RegistryWatcher = (*FileRegistrySource)(nil)
+)
+
+// NewFileRegistrySource returns a source that reads the given file.
+func NewFileRegistrySource(path string) *FileRegistrySource {
+	return &FileRegistrySource{path: path, debounce: 100 * time.Millisecond}
+}
+
+func (s *FileRegistrySource) Load(ctx context.Context) ([]RegistryRecord, []RejectedRecord, error) {
+	blob, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot read registry file")
+	}
+	recs, rejected, err := decodeRegistryFile(filepath.Ext(s.path), blob)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "invalid registry file %s", s.path)
+	}
+	return recs, rejected, nil
+}
+
+func (s *FileRegistrySource) String() string {
+	return "file:" + s.path
+}
+
+// Watch calls changed when the file is written, created, renamed or removed.
+// The directory is watched instead of the file so changes are still seen after
+// the file is replaced, e.g. by editors or by Kubernetes config maps.
+func (s *FileRegistrySource) Watch(ctx context.Context, changed func()) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "cannot watch registry file")
+	}
+	defer w.Close()
+	if err := w.Add(filepath.Dir(s.path)); err != nil {
+		return errors.Wrap(err, "cannot watch registry file")
+	}
+	name := filepath.Clean(s.path)
+	var settle <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Clean(event.Name) == name && event.Op != fsnotify.Chmod {
+				settle = time.After(s.debounce)
+			}
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			return errors.Wrap(err, "cannot watch registry file")
+		case <-settle:
+			settle = nil
+			changed()
+		}
+	}
+}
+
+// registryFile is the document stored in the registry files. The records are
+// decoded separately, see decodeRegistryRecord.
+type registryFile struct {
+	Tenants []interface{} `dynamodbav:"tenants"`
+}
+
+// decodeRegistryFile decodes the records of a registry file with the given
+// extension.
+func decodeRegistryFile(ext string, blob []byte) ([]RegistryRecord, []RejectedRecord, error) {
+	var doc interface{}
+	switch strings.ToLower(ext) {
+	case ".toml":
+		tree, err := toml.LoadBytes(blob)
+		if err != nil {
+			return nil, nil, err
+		}
+		doc = tree.ToMap()
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(blob, &doc); err != nil {
+			return nil, nil, err
+		}
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(blob))
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err != nil {
+			return nil, nil, err
+		}
+	default:
+		return nil, nil, errors.Errorf("unsupported format %q, use .toml, .yaml, .yml or .json", ext)
+	}
+	file := registryFile{}
+	if err := decodeRegistryValue(doc, &file); err != nil {
+		return nil, nil, err
+	}
+	var (
+		recs     = []RegistryRecord{}
+		rejected []RejectedRecord
+	)
+	for i, value := range file.Tenants {
+		rec := RegistryRecord{}
+		if err := decodeRegistryValue(value, &rec); err != nil {
+			// Best effort to tell which tenant is affected.
+			var id struct{ TenantJiscID string }
+			_ = mapstructure.WeakDecode(value, &id)
+			rejected = append(rejected, RejectedRecord{
+				TenantJiscID: id.TenantJiscID,
+				Err:          errors.Wrapf(err, "tenant #%d", i+1),
+			})
+			continue
+		}
+		recs = append(recs, rec)
+	}
+	return recs, rejected, nil
+}
+
+// decodeRegistryValue decodes a value of a registry file. The attributes are
+// the ones used in the DynamoDB table, unknown attributes are errors.
+func decodeRegistryValue(value interface{}, result interface{}) error {
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		TagName:          "dynamodbav",
+		WeaklyTypedInput: true, // E.g. tenantJiscID = 1.
+		ErrorUnused:      true,
+		Result:           result,
+	})
+	if err != nil {
+		return err
+	}
+	return dec.Decode(value)
+}
@@ -0,0 +1,287 @@
+package adapter
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const testRegistryTOML = `
+[[tenants]]
+tenantJiscID = 1
+url = "http://pipeline-a:8000"
+user = "user"
+key = "key"
+processingConfig = "automated"
+
+[tenants.processingConfigs]
+veryHigh = "full"
+
+[[tenants.pipelines]]
+id = "b"
+url = "http://pipeline-b:8000"
+capacity = 2
+`
+
+const testRegistryYAML = `
+tenants:
+  - tenantJiscID: 1
+    url: http://pipeline-a:8000
+    user: user
+    key: key
+    processingConfig: automated
+    processingConfigs:
+      veryHigh: full
+    pipelines:
+      - id: b
+        url: http://pipeline-b:8000
+        capacity: 2
+`
+
+const testRegistryJSON = `{
+  "tenants": [{
+    "tenantJiscID": "1",
+    "url": "http://pipeline-a:8000",
+    "user": "user",
+    "key": "key",
+    "processingConfig": "automated",
+    "processingConfigs": {"veryHigh": "full"},
+    "pipelines": [{"id": "b", "url": "http://pipeline-b:8000", "capacity": 2}]
+  }]
+}`
+
+func writeRegistryFile(t *testing.T, dir, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(contents), 0o644))
+	return path
+}
+
+func TestDynamoDBRegistrySource_Load(t *testing.T) {
+	m := &dynamock{}
+	lastKey := map[string]*dynamodb.AttributeValue{"tenantJiscID": {S: aws.String("2")}}
+	m.On("ScanWithContext", mock.Anything, &dynamodb.ScanInput{
+		ConsistentRead: aws.Bool(true),
+		TableName:      aws.String("mockTable"),
+	}).Return(&dynamodb.ScanOutput{
+		Items: []map[string]*dynamodb.AttributeValue{
+			{"tenantJiscID": {S: aws.String("1")}, "url": {S: aws.String("http://a.example.com")}},
+			{"tenantJiscID": {S: aws.String("2")}, "capacity": {S: aws.String("many")}},
+		},
+		LastEvaluatedKey: lastKey,
+	}, nil)
+	m.On("ScanWithContext", mock.Anything, &dynamodb.ScanInput{
+		ConsistentRead:    aws.Bool(true),
+		TableName:         aws.String("mockTable"),
+		ExclusiveStartKey: lastKey,
+	}).Return(&dynamodb.ScanOutput{
+		Items: []map[string]*dynamodb.AttributeValue{
+			{"tenantJiscID": {S: aws.String("3")}, "url": {S: aws.String("http://c.example.com")}},
+		},
+	}, nil)
+
+	recs, rejected, err := NewDynamoDBRegistrySource(m, "mockTable").Load(context.Background())
+	require.NoError(t, err)
+	m.AssertNumberOfCalls(t, "ScanWithContext", 2)
+	require.Len(t, recs, 2)
+	assert.Equal(t, "1", recs[0].TenantJiscID)
+	assert.Equal(t, "3", recs[1].TenantJiscID)
+	require.Len(t, rejected, 1)
+	assert.Equal(t, "2", rejected[0].TenantJiscID)
+}
+
+// testRegistrySource is a source whose records are changed by the tests.
+type testRegistrySource struct {
+	recs     []RegistryRecord
+	rejected []RejectedRecord
+	sync.Mutex
+}
+
+func (s *testRegistrySource) set(recs []RegistryRecord, rejected []RejectedRecord) {
+	s.Lock()
+	defer s.Unlock()
+	s.recs, s.rejected = recs, rejected
+}
+
+func (s *testRegistrySource) Load(ctx context.Context) ([]RegistryRecord, []RejectedRecord, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.recs, s.rejected, nil
+}
+
+func (s *testRegistrySource) String() string {
+	return "test"
+}
+
+func TestRegistry_load(t *testing.T) {
+	source := &testRegistrySource{}
+	source.set([]RegistryRecord{
+		{TenantJiscID: "1", ArchivematicaURL: "http://a.example.com"},
+		{TenantJiscID: "2", ArchivematicaURL: "http://b.example.com"},
+		{TenantJiscID: "3", ArchivematicaURL: "http://c.example.com"},
+	}, nil)
+	r, err := NewRegistryFromSource(logrus.StandardLogger(), source)
+	require.NoError(t, err)
+	defer r.Stop()
+	require.Len(t, r.Pipelines(), 3)
+
+	// Bad records are skipped individually and the previous entries of their
+	// tenants are kept. Tenant 3 is gone.
+	source.set([]RegistryRecord{
+		{TenantJiscID: "1", ArchivematicaURL: "http://a2.example.com"},
+		{TenantJiscID: "1", ArchivematicaURL: "http://duplicated.example.com"},
+		{TenantJiscID: "2", ArchivematicaURL: "http://b2.example.com", Pipelines: []RegistryPipeline{{ID: "x", ArchivematicaURL: ":"}}},
+		{TenantJiscID: "four", ArchivematicaURL: "http://d.example.com"},
+		{TenantJiscID: "6", ArchivematicaURL: "not a URL"},
+		{TenantJiscID: "7", ArchivematicaURL: "http://g.example.com", StorageServiceURL: "ss.example.com:8000"},
+	}, []RejectedRecord{{TenantJiscID: "5", Err: errors.New("bad record")}})
+	require.NoError(t, r.load())
+	assert.Equal(t, "http://a2.example.com", r.Get(1).BaseURL.String())
+	assert.Equal(t, "http://b.example.com", r.Get(2).BaseURL.String())
+	assert.Nil(t, r.Get(3))
+	assert.Nil(t, r.Get(5))
+	assert.Nil(t, r.Get(6))
+	assert.Nil(t, r.Get(7))
+	assert.Len(t, r.Pipelines(), 2)
+
+	err = testutil.CollectAndCompare(r, strings.NewReader(`
+# HELP rdss_archivematica_channel_adapter_registry_records Number of registry records loaded and rejected in the last load of the registry.
+# TYPE rdss_archivematica_channel_adapter_registry_records gauge
+rdss_archivematica_channel_adapter_registry_records{status="loaded"} 1
+rdss_archivematica_channel_adapter_registry_records{status="rejected"} 6
+`), "rdss_archivematica_channel_adapter_registry_records")
+	assert.NoError(t, err)
+
+	// An empty source empties the registry.
+	source.set(nil, nil)
+	require.NoError(t, r.load())
+	assert.Empty(t, r.Pipelines())
+	assert.Empty(t, r.guards)
+}
+
+func TestFileRegistrySource_Load(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	want := []RegistryRecord{{
+		TenantJiscID:      "1",
+		ArchivematicaURL:  "http://pipeline-a:8000",
+		ArchivematicaUser: "user",
+		ArchivematicaKey:  "key",
+		ProcessingConfig:  "automated",
+		ProcessingConfigs: map[string]string{"veryHigh": "full"},
+		Pipelines: []RegistryPipeline{
+			{ID: "b", ArchivematicaURL: "http://pipeline-b:8000", Capacity: 2},
+		},
+	}}
+	for name, contents := range map[string]string{
+		"registry.toml": testRegistryTOML,
+		"registry.yaml": testRegistryYAML,
+		"registry.json": testRegistryJSON,
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := NewFileRegistrySource(writeRegistryFile(t, dir, name, contents))
+			recs, rejected, err := s.Load(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, want, recs)
+			assert.Empty(t, rejected)
+		})
+	}
+}
+
+func TestFileRegistrySource_Load_invalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		contents string
+		err      string
+	}{
+		{"registry.ini", "", `unsupported format ".ini"`},
+		{"registry.toml", "[[tenants]\n", "unclosed table array key"},
+		{"registry.toml", "[[tenant]]\ntenantJiscID = 1\n", "invalid keys: tenant"},
+	}
+	for _, tc := range tests {
+		s := NewFileRegistrySource(writeRegistryFile(t, dir, tc.name, tc.contents))
+		_, _, err := s.Load(context.Background())
+		if assert.Error(t, err, tc.contents) {
+			assert.Contains(t, err.Error(), "invalid registry file "+filepath.Join(dir, tc.name))
+			assert.Contains(t, err.Error(), tc.err)
+		}
+	}
+
+	_, _, err = NewFileRegistrySource(filepath.Join(dir, "missing.toml")).Load(context.Background())
+	assert.Error(t, err)
+}
+
+func TestFileRegistrySource_Load_rejected(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := writeRegistryFile(t, dir, "registry.toml", `
+[[tenants]]
+tenantJiscID = 1
+ulr = "http://pipeline-a:8000"
+
+[[tenants]]
+tenantJiscID = 2
+url = "http://pipeline-b:8000"
+`)
+	recs, rejected, err := NewFileRegistrySource(path).Load(context.Background())
+	require.NoError(t, err)
+	require.Len(t, recs, 1)
+	assert.Equal(t, "2", recs[0].TenantJiscID)
+	require.Len(t, rejected, 1)
+	assert.Equal(t, "1", rejected[0].TenantJiscID)
+	assert.Contains(t, rejected[0].Err.Error(), "tenant #1")
+	assert.Contains(t, rejected[0].Err.Error(), "invalid keys: ulr")
+}
+
+func TestRegistry_fileSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := writeRegistryFile(t, dir, "registry.toml", testRegistryTOML)
+
+	source := NewFileRegistrySource(path)
+	source.debounce = time.Millisecond
+	r, err := NewRegistryFromSource(logrus.StandardLogger(), source)
+	require.NoError(t, err)
+	defer r.Stop()
+	require.NotNil(t, r.Get(1))
+	assert.Equal(t, "http://pipeline-a:8000", r.Get(1).BaseURL.String())
+
+	// Files that cannot be decoded are reported and the previous entries are
+	// kept, as well as the previous entries of the rejected records.
+	writeRegistryFile(t, dir, "registry.toml", "[[tenants]\n")
+	require.Error(t, r.load())
+	assert.NotNil(t, r.Get(1))
+	writeRegistryFile(t, dir, "registry.toml", "[[tenants]]\ntenantJiscID = 1\nulr = \"http://pipeline-c:8000\"\n")
+	require.NoError(t, r.load())
+	assert.Equal(t, "http://pipeline-a:8000", r.Get(1).BaseURL.String())
+
+	// Changes are picked up without waiting for the periodic reload. The file
+	// is written until then because the watch may not have started yet.
+	assert.Eventually(t, func() bool {
+		writeRegistryFile(t, dir, "registry.toml", "[[tenants]]\ntenantJiscID = 2\nurl = \"http://pipeline-c:8000\"\n")
+		return r.Get(1) == nil && r.Get(2) != nil
+	}, time.Second*5, time.Millisecond*50)
+}
@@ -1,9 +1,14 @@
 package adapter
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/broker/message"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
@@ -74,3 +79,160 @@ func TestRegistry(t *testing.T) {
 
 	assert.Nil(t, r.Get(3))
 }
+
+func TestRegistry_crosswalk(t *testing.T) {
+	m := &dynamock{}
+	valid := writeCrosswalk(t, "valid.toml", testCrosswalkTOML)
+	invalid := writeCrosswalk(t, "invalid.toml", "[[dataset]]\nfield = \"dc.title\"\npath = \"unknown\"")
+
+	m.On(
+		"ScanWithContext",
+		mock.AnythingOfType("*context.cancelCtx"),
+		mock.Anything,
+	).Return(&dynamodb.ScanOutput{
+		Items: []map[string]*dynamodb.AttributeValue{
+			{
+				"tenantJiscID": &dynamodb.AttributeValue{S: aws.String("1")},
+				"url":          &dynamodb.AttributeValue{S: aws.String("http://192.168.1.1")},
+				"crosswalk":    &dynamodb.AttributeValue{S: aws.String(valid)},
+			},
+			{
+				"tenantJiscID": &dynamodb.AttributeValue{S: aws.String("2")},
+				"url":          &dynamodb.AttributeValue{S: aws.String("http://192.168.1.2")},
+				"crosswalk":    &dynamodb.AttributeValue{S: aws.String(invalid)},
+			},
+			{
+				"tenantJiscID": &dynamodb.AttributeValue{S: aws.String("3")},
+				"url":          &dynamodb.AttributeValue{S: aws.String("http://192.168.1.3")},
+			},
+		},
+	}, nil)
+
+	r, err := NewRegistry(logrus.StandardLogger(), m, "mockTable")
+	assert.NoError(t, err)
+	defer r.Stop()
+
+	cw := r.tenantCrosswalk(1)
+	assert.NotNil(t, cw)
+	assert.Equal(t, valid, cw.path)
+
+	// Invalid or undefined crosswalks fall back to the built-in mapping.
+	assert.NotNil(t, r.Get(2))
+	assert.Nil(t, r.tenantCrosswalk(2))
+	assert.Nil(t, r.tenantCrosswalk(3))
+	assert.Nil(t, r.tenantCrosswalk(4))
+}
+
+func TestRegistry_processingConfigs(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/processing-configuration/automated/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<processingMCP/>"))
+	})
+	mux.HandleFunc("/api/processing-configuration/datasets/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<processingMCP/>"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	m := &dynamock{}
+	m.On(
+		"ScanWithContext",
+		mock.AnythingOfType("*context.cancelCtx"),
+		mock.Anything,
+	).Return(&dynamodb.ScanOutput{
+		Items: []map[string]*dynamodb.AttributeValue{
+			{
+				"tenantJiscID":     &dynamodb.AttributeValue{S: aws.String("1")},
+				"url":              &dynamodb.AttributeValue{S: aws.String(server.URL)},
+				"processingConfig": &dynamodb.AttributeValue{S: aws.String("automated")},
+				"processingConfigs": &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{
+					"dataset": {S: aws.String("datasets")},
+				}},
+			},
+			{
+				"tenantJiscID": &dynamodb.AttributeValue{S: aws.String("2")},
+				"url":          &dynamodb.AttributeValue{S: aws.String(server.URL)},
+				"processingConfigs": &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{
+					"thesisDissertation": {S: aws.String("theses")},
+				}},
+			},
+		},
+	}, nil)
+
+	r, err := NewRegistry(logrus.StandardLogger(), m, "mockTable")
+	assert.NoError(t, err)
+	defer r.Stop()
+
+	dataset := &message.ResearchObject{ObjectResourceType: message.ResourceTypeEnum_dataset}
+	assert.Equal(t, "datasets", r.tenantProcessingConfigs(1).resolve(dataset))
+	assert.Equal(t, "automated", r.tenantProcessingConfigs(2).resolve(dataset))
+	assert.Nil(t, r.tenantProcessingConfigs(3))
+
+	r.ValidateProcessingConfigs(context.Background())
+	tenants := r.Tenants()
+	assert.Empty(t, tenants[0].Pipelines[0].MissingProcessingConfigs)
+	assert.Equal(t, []string{"theses"}, tenants[1].Pipelines[0].MissingProcessingConfigs)
+
+	// The default configuration is used where the configuration is missing.
+	thesis := &message.ResearchObject{ObjectResourceType: message.ResourceTypeEnum_thesisDissertation}
+	name, missing := r.processingConfig(2, "default", thesis)
+	assert.Equal(t, "automated", name)
+	assert.Equal(t, "theses", missing)
+	name, missing = r.processingConfig(1, "default", dataset)
+	assert.Equal(t, "datasets", name)
+	assert.Equal(t, "", missing)
+}
+
+func TestRegistry_staging(t *testing.T) {
+	m := &dynamock{}
+	m.On(
+		"ScanWithContext",
+		mock.AnythingOfType("*context.cancelCtx"),
+		mock.Anything,
+	).Return(&dynamodb.ScanOutput{
+		Items: []map[string]*dynamodb.AttributeValue{
+			{
+				"tenantJiscID":    &dynamodb.AttributeValue{S: aws.String("1")},
+				"url":             &dynamodb.AttributeValue{S: aws.String("http://localhost")},
+				"transferType":    &dynamodb.AttributeValue{S: aws.String("zipped bag")},
+				"stagingLocation": &dynamodb.AttributeValue{S: aws.String("0aa9a6a4-77d7-4d12-b20e-1f2b3c4d5e6f")},
+				"stagingURL":      &dynamodb.AttributeValue{S: aws.String("s3://bucket/transfers")},
+			},
+			{
+				"tenantJiscID":    &dynamodb.AttributeValue{S: aws.String("2")},
+				"url":             &dynamodb.AttributeValue{S: aws.String("http://localhost")},
+				"transferType":    &dynamodb.AttributeValue{S: aws.String("tarball")},
+				"stagingLocation": &dynamodb.AttributeValue{S: aws.String("0aa9a6a4-77d7-4d12-b20e-1f2b3c4d5e6f")},
+			},
+			{
+				"tenantJiscID":    &dynamodb.AttributeValue{S: aws.String("4")},
+				"url":             &dynamodb.AttributeValue{S: aws.String("http://localhost")},
+				"stagingLocation": &dynamodb.AttributeValue{S: aws.String("0aa9a6a4-77d7-4d12-b20e-1f2b3c4d5e6f")},
+				"stagingURL":      &dynamodb.AttributeValue{S: aws.String("s3://bucket/transfers")},
+				"pipelines": &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{
+					{M: map[string]*dynamodb.AttributeValue{
+						"id":  {S: aws.String("b")},
+						"url": {S: aws.String("http://b.example.com")},
+					}},
+				}},
+			},
+		},
+	}, nil)
+
+	r, err := NewRegistry(logrus.StandardLogger(), m, "mockTable")
+	assert.NoError(t, err)
+	defer r.Stop()
+
+	assert.Equal(t, "zipped bag", r.tenantTransferType(1))
+	if st := r.tenantStaging(1); assert.NotNil(t, st) {
+		assert.Equal(t, "0aa9a6a4-77d7-4d12-b20e-1f2b3c4d5e6f", st.location)
+		assert.Equal(t, "s3://bucket/transfers", st.url.String())
+	}
+	assert.Equal(t, "standard", r.tenantTransferType(2))
+	assert.Nil(t, r.tenantStaging(2))
+	assert.Equal(t, "standard", r.tenantTransferType(3))
+	assert.Nil(t, r.tenantStaging(3))
+
+	// Staging is rejected with more than one pipeline.
+	assert.Nil(t, r.Get(4))
+}
@@ -0,0 +1,94 @@
+package adapter
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/amclient"
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/broker/message"
+)
+
+// grantRestrictions maps the access types to the restrictions of the PREMIS
+// rights granted. Other access types are mapped to "Conditional".
+var grantRestrictions = map[message.AccessTypeEnum]string{
+	message.AccessTypeEnum_open:   "Allow",
+	message.AccessTypeEnum_closed: "Disallow",
+}
+
+// describePremisRights registers the rights of a file in the transfer so they
+// become PREMIS rights statements in the AIP. The rights of the file take
+// precedence over the rights of the research object.
+func describePremisRights(t *amclient.TransferSession, name string, f *message.File, objectRights *message.Rights) {
+	rights := objectRights
+	if f.FileRights != nil {
+		rights = f.FileRights
+	}
+	for _, s := range premisRights(rights) {
+		t.AddRightsStatement(name, s)
+	}
+}
+
+// premisRights maps RDSS rights into PREMIS rights statements. Rights
+// statements and holders are combined into a copyright statement. Each licence
+// becomes a license statement that allows the dissemination of the files
+// during the licence dates. Each access condition becomes a policy statement
+// that allows, disallows or conditions the dissemination of the files.
+func premisRights(r *message.Rights) []amclient.RightsStatement {
+	statements := []amclient.RightsStatement{}
+	if len(r.RightsStatement) > 0 || len(r.RightsHolder) > 0 {
+		status := "unknown"
+		var holders string
+		if len(r.RightsHolder) > 0 {
+			status = "copyrighted"
+			holders = fmt.Sprintf("Rights holder: %s", strings.Join(r.RightsHolder, "; "))
+		}
+		statements = append(statements, amclient.RightsStatement{
+			Basis:  "copyright",
+			Status: status,
+			Note:   joinNonEmpty(" ", strings.Join(r.RightsStatement, " "), holders),
+		})
+	}
+	for _, item := range r.Licence {
+		start, end := time.Time(item.LicenseStartDate), time.Time(item.LicenseEndDate)
+		statements = append(statements, amclient.RightsStatement{
+			Basis:            "license",
+			Note:             item.LicenceName,
+			StartDate:        start,
+			EndDate:          end,
+			GrantAct:         "disseminate",
+			GrantRestriction: "Allow",
+			GrantStartDate:   start,
+			GrantEndDate:     end,
+			DocIDType:        identifierType(item.LicenceIdentifier),
+			DocIDValue:       item.LicenceIdentifier,
+			DocIDRole:        "license",
+		})
+	}
+	for _, item := range r.Access {
+		restriction, ok := grantRestrictions[item.AccessType]
+		if !ok {
+			restriction = "Conditional"
+		}
+		statements = append(statements, amclient.RightsStatement{
+			Basis:            "policy",
+			Note:             joinNonEmpty(": ", item.AccessType.String(), item.AccessStatement),
+			GrantAct:         "disseminate",
+			GrantRestriction: restriction,
+		})
+	}
+	return statements
+}
+
+// identifierType returns the type of a documentation identifier, i.e. "URI"
+// when it is an absolute URI.
+func identifierType(value string) string {
+	if value == "" {
+		return ""
+	}
+	if u, err := url.Parse(value); err == nil && u.IsAbs() {
+		return "URI"
+	}
+	return "local"
+}
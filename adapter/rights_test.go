@@ -0,0 +1,88 @@
+package adapter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/amclient"
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/broker/message"
+)
+
+func TestPremisRights(t *testing.T) {
+	t.Parallel()
+
+	start, end := date(2017, time.March, 1), date(2020, time.March, 1)
+	have := premisRights(&message.Rights{
+		RightsStatement: []string{"All rights reserved."},
+		RightsHolder:    []string{"University of Nowhere", "Jisc"},
+		Licence: []message.Licence{
+			{LicenceName: "CC BY 4.0", LicenceIdentifier: "https://creativecommons.org/licenses/by/4.0/", LicenseStartDate: start, LicenseEndDate: end},
+			{LicenceIdentifier: "CC0"},
+		},
+		Access: []message.Access{
+			{AccessType: message.AccessTypeEnum_open},
+			{AccessType: message.AccessTypeEnum_restricted, AccessStatement: "Staff only."},
+			{AccessType: message.AccessTypeEnum_closed},
+		},
+	})
+
+	assert.Equal(t, []amclient.RightsStatement{
+		{
+			Basis:  "copyright",
+			Status: "copyrighted",
+			Note:   "All rights reserved. Rights holder: University of Nowhere; Jisc",
+		},
+		{
+			Basis:            "license",
+			Note:             "CC BY 4.0",
+			StartDate:        time.Time(start),
+			EndDate:          time.Time(end),
+			GrantAct:         "disseminate",
+			GrantRestriction: "Allow",
+			GrantStartDate:   time.Time(start),
+			GrantEndDate:     time.Time(end),
+			DocIDType:        "URI",
+			DocIDValue:       "https://creativecommons.org/licenses/by/4.0/",
+			DocIDRole:        "license",
+		},
+		{
+			Basis:            "license",
+			GrantAct:         "disseminate",
+			GrantRestriction: "Allow",
+			DocIDType:        "local",
+			DocIDValue:       "CC0",
+			DocIDRole:        "license",
+		},
+		{Basis: "policy", Note: "open", GrantAct: "disseminate", GrantRestriction: "Allow"},
+		{Basis: "policy", Note: "restricted: Staff only.", GrantAct: "disseminate", GrantRestriction: "Conditional"},
+		{Basis: "policy", Note: "closed", GrantAct: "disseminate", GrantRestriction: "Disallow"},
+	}, have)
+
+	assert.Empty(t, premisRights(&message.Rights{}))
+}
+
+func TestDescribePremisRights(t *testing.T) {
+	t.Parallel()
+
+	ts := newMetadataTransferSession()
+	ts.Rights = amclient.NewRightsSet(nil)
+	objectRights := &message.Rights{
+		Access: []message.Access{{AccessType: message.AccessTypeEnum_open}},
+	}
+
+	describePremisRights(ts, "woodpigeon.jpg", &message.File{}, objectRights)
+	describePremisRights(ts, "secret.jpg", &message.File{
+		FileRights: &message.Rights{
+			Access: []message.Access{{AccessType: message.AccessTypeEnum_closed}},
+		},
+	}, objectRights)
+
+	assert.Equal(t, []amclient.RightsStatement{
+		{Basis: "policy", Note: "open", GrantAct: "disseminate", GrantRestriction: "Allow"},
+	}, ts.Rights.Statements("woodpigeon.jpg"))
+	assert.Equal(t, []amclient.RightsStatement{
+		{Basis: "policy", Note: "closed", GrantAct: "disseminate", GrantRestriction: "Disallow"},
+	}, ts.Rights.Statements("secret.jpg"))
+}
@@ -0,0 +1,199 @@
+package adapter
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Prefixes of the secret references accepted in the keys of the registry.
+const (
+	secretEnvPrefix  = "env:"  // E.g. "env:AM_KEY".
+	secretFilePrefix = "file:" // E.g. "file:/run/secrets/am-key".
+	secretARNPrefix  = "arn:"  // Secrets Manager secrets and SSM parameters.
+)
+
+// defaultSecretTTL is how long the secrets are cached when the resolver is
+// not given a TTL.
+const defaultSecretTTL = 5 * time.Minute
+
+// isSecretRef reports whether a key of the registry is a reference to a secret
+// rather than the secret itself.
+func isSecretRef(value string) bool {
+	for _, prefix := range []string{secretEnvPrefix, secretFilePrefix, secretARNPrefix} {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// describeSecret describes a key of the registry in the logs without revealing
+// it: references are shown as they are, plain values are masked.
+func describeSecret(value string) string {
+	switch {
+	case value == "":
+		return "none"
+	case isSecretRef(value):
+		return value
+	default:
+		return "plain text"
+	}
+}
+
+// SecretResolver resolves the secret references used in the registry:
+//
+//	env:NAME                                             environment variable
+//	file:/path/to/key                                    contents of a file
+//	arn:aws:secretsmanager:<region>:<account>:secret:... Secrets Manager secret
+//	arn:aws:ssm:<region>:<account>:parameter/...         SSM parameter
+//
+// Any other value is taken as the secret itself. Resolved secrets are cached
+// for the TTL of the resolver. When a secret cannot be refreshed the value
+// cached is still used until the secret can be resolved again.
+type SecretResolver struct {
+	logger logrus.FieldLogger
+	ttl    time.Duration
+
+	// Clients of the AWS services in the region of the secrets. Nil when
+	// the resolver has no AWS session.
+	secretsManager func(region string) secretsmanageriface.SecretsManagerAPI
+	ssm            func(region string) ssmiface.SSMAPI
+
+	cache map[string]cachedSecret
+	mu    sync.Mutex
+}
+
+type cachedSecret struct {
+	value   string
+	expires time.Time
+}
+
+// NewSecretResolver returns a resolver that uses the given AWS session, which
+// can be nil when secrets are not stored in AWS.
+func NewSecretResolver(logger logrus.FieldLogger, sess client.ConfigProvider, ttl time.Duration) *SecretResolver {
+	if ttl <= 0 {
+		ttl = defaultSecretTTL
+	}
+	s := &SecretResolver{
+		logger: logger,
+		ttl:    ttl,
+		cache:  make(map[string]cachedSecret),
+	}
+	if sess != nil {
+		s.secretsManager = func(region string) secretsmanageriface.SecretsManagerAPI {
+			return secretsmanager.New(sess, aws.NewConfig().WithRegion(region))
+		}
+		s.ssm = func(region string) ssmiface.SSMAPI {
+			return ssm.New(sess, aws.NewConfig().WithRegion(region))
+		}
+	}
+	return s
+}
+
+// WithSecretResolver is a registry option for resolving the keys of the
+// pipelines. References to environment variables and files are resolved by
+// default.
+func WithSecretResolver(s *SecretResolver) RegistryOpt {
+	return func(r *Registry) {
+		r.secrets = s
+	}
+}
+
+// Resolve returns the secret referenced by value, or value itself when it is
+// not a reference. Errors never include the secret.
+func (s *SecretResolver) Resolve(ctx context.Context, value string) (string, error) {
+	if !isSecretRef(value) {
+		return value, nil
+	}
+	s.mu.Lock()
+	cached, ok := s.cache[value]
+	s.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.value, nil
+	}
+	secret, err := s.fetch(ctx, value)
+	if err != nil {
+		if ok {
+			s.logger.WithError(err).WithField("ref", value).Warn("Secret cannot be refreshed, the cached value is used")
+			return cached.value, nil
+		}
+		return "", errors.Wrapf(err, "secret %s cannot be resolved", value)
+	}
+	s.mu.Lock()
+	s.cache[value] = cachedSecret{value: secret, expires: time.Now().Add(s.ttl)}
+	s.mu.Unlock()
+	return secret, nil
+}
+
+// fetch retrieves a secret from where the reference points.
+func (s *SecretResolver) fetch(ctx context.Context, ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, secretEnvPrefix):
+		name := strings.TrimPrefix(ref, secretEnvPrefix)
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", errors.Errorf("environment variable %s is not set", name)
+		}
+		return secret, nil
+	case strings.HasPrefix(ref, secretFilePrefix):
+		blob, err := ioutil.ReadFile(strings.TrimPrefix(ref, secretFilePrefix))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(blob), "\r\n"), nil
+	}
+	a, err := arn.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	switch a.Service {
+	case "secretsmanager":
+		if s.secretsManager == nil {
+			return "", errors.New("AWS secrets are not supported, the resolver has no session")
+		}
+		out, err := s.secretsManager(a.Region).GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{
+			SecretId: aws.String(ref),
+		})
+		if err != nil {
+			return "", err
+		}
+		if out.SecretString != nil {
+			return *out.SecretString, nil
+		}
+		return string(out.SecretBinary), nil
+	case "ssm":
+		if s.ssm == nil {
+			return "", errors.New("AWS secrets are not supported, the resolver has no session")
+		}
+		// The ARN drops the leading slash of hierarchical names, e.g.
+		// "parameter/adapter/key" is "/adapter/key" but "parameter/key" is
+		// "key".
+		name := strings.TrimPrefix(a.Resource, "parameter/")
+		if strings.Contains(name, "/") {
+			name = "/" + name
+		}
+		out, err := s.ssm(a.Region).GetParameterWithContext(ctx, &ssm.GetParameterInput{
+			Name:           aws.String(name),
+			WithDecryption: aws.Bool(true),
+		})
+		if err != nil {
+			return "", err
+		}
+		return aws.StringValue(out.Parameter.Value), nil
+	}
+	return "", errors.Errorf("unsupported service %q, use secretsmanager or ssm", a.Service)
+}
@@ -0,0 +1,179 @@
+package adapter
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type secretsManagerMock struct {
+	mock.Mock
+	secretsmanageriface.SecretsManagerAPI
+}
+
+func (m *secretsManagerMock) GetSecretValueWithContext(ctx aws.Context, input *secretsmanager.GetSecretValueInput, opts ...request.Option) (*secretsmanager.GetSecretValueOutput, error) {
+	args := m.Called(input)
+	return args.Get(0).(*secretsmanager.GetSecretValueOutput), args.Error(1)
+}
+
+type ssmMock struct {
+	mock.Mock
+	ssmiface.SSMAPI
+}
+
+func (m *ssmMock) GetParameterWithContext(ctx aws.Context, input *ssm.GetParameterInput, opts ...request.Option) (*ssm.GetParameterOutput, error) {
+	args := m.Called(input)
+	return args.Get(0).(*ssm.GetParameterOutput), args.Error(1)
+}
+
+func TestSecretResolver_Resolve(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "secrets")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "key")
+	require.NoError(t, ioutil.WriteFile(path, []byte("file-key\n"), 0o600))
+	os.Setenv("TEST_SECRET_RESOLVER_KEY", "env-key")
+	defer os.Unsetenv("TEST_SECRET_RESOLVER_KEY")
+
+	const (
+		secretARN = "arn:aws:secretsmanager:eu-west-2:123456789012:secret:am-key-AbCdEf"
+		paramARN  = "arn:aws:ssm:eu-west-1:123456789012:parameter/adapter/am-key"
+		flatARN   = "arn:aws:ssm:eu-west-1:123456789012:parameter/am-key"
+	)
+	sm := &secretsManagerMock{}
+	sm.On("GetSecretValueWithContext", &secretsmanager.GetSecretValueInput{SecretId: aws.String(secretARN)}).
+		Return(&secretsmanager.GetSecretValueOutput{SecretString: aws.String("sm-key")}, nil)
+	ps := &ssmMock{}
+	ps.On("GetParameterWithContext", &ssm.GetParameterInput{Name: aws.String("/adapter/am-key"), WithDecryption: aws.Bool(true)}).
+		Return(&ssm.GetParameterOutput{Parameter: &ssm.Parameter{Value: aws.String("ssm-key")}}, nil)
+	ps.On("GetParameterWithContext", &ssm.GetParameterInput{Name: aws.String("am-key"), WithDecryption: aws.Bool(true)}).
+		Return(&ssm.GetParameterOutput{Parameter: &ssm.Parameter{Value: aws.String("flat-ssm-key")}}, nil)
+
+	var regions []string
+	s := NewSecretResolver(logrus.StandardLogger(), nil, time.Hour)
+	s.secretsManager = func(region string) secretsmanageriface.SecretsManagerAPI {
+		regions = append(regions, region)
+		return sm
+	}
+	s.ssm = func(region string) ssmiface.SSMAPI {
+		regions = append(regions, region)
+		return ps
+	}
+
+	for value, want := range map[string]string{
+		"":                             "",
+		"plain-key":                    "plain-key",
+		"env:TEST_SECRET_RESOLVER_KEY": "env-key",
+		"file:" + path:                 "file-key",
+		secretARN:                      "sm-key",
+		paramARN:                       "ssm-key",
+		flatARN:                        "flat-ssm-key",
+	} {
+		got, err := s.Resolve(ctx, value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, want, got, value)
+	}
+	assert.ElementsMatch(t, []string{"eu-west-2", "eu-west-1", "eu-west-1"}, regions)
+
+	// Secrets are cached.
+	_, err = s.Resolve(ctx, secretARN)
+	assert.NoError(t, err)
+	sm.AssertNumberOfCalls(t, "GetSecretValueWithContext", 1)
+
+	for _, value := range []string{
+		"env:TEST_SECRET_RESOLVER_MISSING",
+		"file:" + filepath.Join(dir, "missing"),
+		"arn:aws:s3:::bucket/key",
+		"arn:invalid",
+	} {
+		got, err := s.Resolve(ctx, value)
+		assert.Error(t, err, value)
+		assert.Empty(t, got, value)
+	}
+
+	_, err = NewSecretResolver(logrus.StandardLogger(), nil, 0).Resolve(ctx, secretARN)
+	assert.EqualError(t, err, "secret "+secretARN+" cannot be resolved: AWS secrets are not supported, the resolver has no session")
+}
+
+func TestSecretResolver_refresh(t *testing.T) {
+	ctx := context.Background()
+	const ref = "arn:aws:secretsmanager:eu-west-2:123456789012:secret:am-key-AbCdEf"
+	sm := &secretsManagerMock{}
+	s := NewSecretResolver(logrus.StandardLogger(), nil, time.Millisecond)
+	s.secretsManager = func(string) secretsmanageriface.SecretsManagerAPI { return sm }
+
+	sm.On("GetSecretValueWithContext", mock.Anything).
+		Return(&secretsmanager.GetSecretValueOutput{SecretString: aws.String("old")}, nil).Once()
+	got, err := s.Resolve(ctx, ref)
+	require.NoError(t, err)
+	assert.Equal(t, "old", got)
+
+	// The key is rotated once the cache expires.
+	time.Sleep(2 * time.Millisecond)
+	sm.On("GetSecretValueWithContext", mock.Anything).
+		Return(&secretsmanager.GetSecretValueOutput{SecretString: aws.String("new")}, nil).Once()
+	got, err = s.Resolve(ctx, ref)
+	require.NoError(t, err)
+	assert.Equal(t, "new", got)
+
+	// The cached key is used while the secret cannot be refreshed.
+	time.Sleep(2 * time.Millisecond)
+	sm.On("GetSecretValueWithContext", mock.Anything).
+		Return((*secretsmanager.GetSecretValueOutput)(nil), errors.New("throttled"))
+	got, err = s.Resolve(ctx, ref)
+	require.NoError(t, err)
+	assert.Equal(t, "new", got)
+}
+
+func TestRegistry_secrets(t *testing.T) {
+	os.Setenv("TEST_REGISTRY_AM_KEY", "resolved-key")
+	defer os.Unsetenv("TEST_REGISTRY_AM_KEY")
+
+	logger, hook := test.NewNullLogger()
+	source := &testRegistrySource{}
+	source.set([]RegistryRecord{
+		{TenantJiscID: "1", ArchivematicaURL: "http://a.example.com", ArchivematicaKey: "env:TEST_REGISTRY_AM_KEY"},
+		{TenantJiscID: "2", ArchivematicaURL: "http://b.example.com", ArchivematicaKey: "secret-plain-key",
+			StorageServiceURL: "http://ss.example.com", StorageServiceKey: "env:TEST_REGISTRY_MISSING"},
+		{TenantJiscID: "3", ArchivematicaURL: "http://c.example.com", ArchivematicaKey: "secret-plain-key"},
+	}, nil)
+	r, err := NewRegistryFromSource(logger, source)
+	require.NoError(t, err)
+	defer r.Stop()
+
+	assert.Equal(t, "resolved-key", r.Get(1).Key)
+	assert.Nil(t, r.Get(2), "record with a key that cannot be resolved is rejected")
+	assert.Equal(t, "secret-plain-key", r.Get(3).Key)
+
+	r.Log()
+	for _, entry := range hook.AllEntries() {
+		s, err := entry.String()
+		require.NoError(t, err)
+		assert.NotContains(t, s, "resolved-key")
+		assert.NotContains(t, s, "secret-plain-key")
+	}
+	var keys []interface{}
+	for _, entry := range hook.AllEntries() {
+		if entry.Message == "Registry entry found" {
+			keys = append(keys, entry.Data["keys"])
+		}
+	}
+	assert.ElementsMatch(t, []interface{}{"default=env:TEST_REGISTRY_AM_KEY", "default=plain text"}, keys)
+}
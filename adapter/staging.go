@@ -0,0 +1,59 @@
+package adapter
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"path"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/amclient"
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/s3"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// staging describes the transfer source location where the transfers of a
+// tenant are staged instead of the transfer directory shared with
+// Archivematica.
+type staging struct {
+	// UUID of the transfer source location in the Storage Service.
+	location string
+
+	// URL of the object store matching the root of the location, e.g.
+	// "s3://bucket/transfers".
+	url *url.URL
+}
+
+func newStaging(location, rawURL string) (*staging, error) {
+	if _, err := uuid.Parse(location); err != nil {
+		return nil, errors.Wrapf(err, "invalid staging location %q", location)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid staging URL %q", rawURL)
+	}
+	if u.Scheme != "s3" || u.Host == "" {
+		return nil, errors.Errorf("invalid staging URL %q: an S3 URL is expected, e.g. s3://bucket/prefix", rawURL)
+	}
+	return &staging{location: location, url: u}, nil
+}
+
+// objectStager is an amclient.Stager that uploads the transfers to an object
+// store.
+type objectStager struct {
+	storage s3.ObjectStorage
+	*staging
+}
+
+var _ amclient.Stager = (*objectStager)(nil)
+
+func (s *objectStager) Location() string {
+	return s.location
+}
+
+func (s *objectStager) Stage(ctx context.Context, name string, r io.Reader) error {
+	u := *s.url
+	u.Path = path.Join("/", u.Path, name)
+	return s.storage.Upload(ctx, r, u.String())
+}
@@ -0,0 +1,60 @@
+package adapter
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/s3"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type uploadsMock struct {
+	s3.ObjectStorage
+	uploads map[string]string
+}
+
+func (m *uploadsMock) Upload(ctx context.Context, r io.Reader, URI string) error {
+	blob, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	m.uploads[URI] = string(blob)
+	return nil
+}
+
+func TestNewStaging(t *testing.T) {
+	const location = "0aa9a6a4-77d7-4d12-b20e-1f2b3c4d5e6f"
+
+	_, err := newStaging("", "s3://bucket")
+	assert.Error(t, err)
+	_, err = newStaging(location, "")
+	assert.EqualError(t, err, `invalid staging URL "": an S3 URL is expected, e.g. s3://bucket/prefix`)
+	_, err = newStaging(location, "https://bucket/transfers")
+	assert.Error(t, err)
+
+	st, err := newStaging(location, "s3://bucket/transfers")
+	assert.NoError(t, err)
+	assert.Equal(t, location, st.location)
+}
+
+func TestObjectStager(t *testing.T) {
+	for _, rawURL := range []string{"s3://bucket/transfers", "s3://bucket/transfers/"} {
+		st, err := newStaging("0aa9a6a4-77d7-4d12-b20e-1f2b3c4d5e6f", rawURL)
+		require.NoError(t, err)
+		storage := &uploadsMock{uploads: map[string]string{}}
+		stager := &objectStager{storage: storage, staging: st}
+
+		err = stager.Stage(context.Background(), "amclientTransfer123/metadata/metadata.csv", strings.NewReader("filename"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "0aa9a6a4-77d7-4d12-b20e-1f2b3c4d5e6f", stager.Location())
+		assert.Equal(t, map[string]string{
+			"s3://bucket/transfers/amclientTransfer123/metadata/metadata.csv": "filename",
+		}, storage.uploads)
+	}
+}
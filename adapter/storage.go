@@ -3,16 +3,51 @@ package adapter
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/pkg/errors"
 )
 
 type Storage interface {
-	AssociateResearchObject(ctx context.Context, objectUUID string, transferID string) error
-	GetResearchObject(ctx context.Context, objectUUID string) (string, error)
+	AssociateResearchObject(ctx context.Context, objectUUID string, transferID string, pipelineID string) error
+	GetResearchObject(ctx context.Context, objectUUID string) (transferID string, pipelineID string, err error)
+	GetObject(ctx context.Context, objectUUID string) (*StoredObject, error)
+	AssociateAIP(ctx context.Context, tenantID uint64, objectUUID string, aipID string) error
+	ListAIPs(ctx context.Context) (map[uint64][]StoredAIP, error)
+	RecordFixityCheck(ctx context.Context, objectUUID string, check FixityCheck) error
+}
+
+// StoredAIP is an AIP of a research object recorded in the storage.
+type StoredAIP struct {
+	ObjectUUID string `json:"objectUUID"`
+	AIPID      string `json:"aipID,omitempty"`
+	PipelineID string `json:"pipelineID,omitempty"` // Empty when recorded before it was known.
+
+	// Result of the last fixity check, nil if it has never been checked.
+	FixityCheck *FixityCheck `json:"fixityCheck,omitempty"`
+}
+
+// StoredObject is everything recorded in the storage about a research object.
+type StoredObject struct {
+	StoredAIP
+	TransferID   string `json:"transferID"`
+	TenantJiscID uint64 `json:"tenantJiscID,omitempty"` // Zero until the AIP is stored.
+}
+
+// ErrObjectNotFound is returned by GetObject when nothing has been recorded
+// about a research object.
+var ErrObjectNotFound = errors.New("research object not found")
+
+// FixityCheck is the result of a fixity check of an AIP.
+type FixityCheck struct {
+	Time    time.Time `json:"time"`
+	Success bool      `json:"success"`
+	Detail  string    `json:"detail"`
 }
 
 type storageDynamoDBImpl struct {
@@ -30,14 +65,23 @@ func NewStorageDynamoDB(client dynamodbiface.DynamoDBAPI, table string) *storage
 }
 
 type storageItem struct {
-	ObjectUUID string `dynamodbav:"objectUUID"`
-	TransferID string `dynamodbav:"transferID"`
+	ObjectUUID         string `dynamodbav:"objectUUID"`
+	TransferID         string `dynamodbav:"transferID"`
+	PipelineID         string `dynamodbav:"pipelineID,omitempty"`
+	TenantJiscID       uint64 `dynamodbav:"tenantJiscID,omitempty"`
+	AIPID              string `dynamodbav:"aipID,omitempty"`
+	FixityCheckTime    string `dynamodbav:"fixityCheckTime,omitempty"`
+	FixityCheckSuccess bool   `dynamodbav:"fixityCheckSuccess,omitempty"`
+	FixityCheckDetail  string `dynamodbav:"fixityCheckDetail,omitempty"`
 }
 
-func (s *storageDynamoDBImpl) AssociateResearchObject(ctx context.Context, objectUUID string, transferID string) error {
+// AssociateResearchObject records the transfer of a research object and the
+// pipeline where it was started.
+func (s *storageDynamoDBImpl) AssociateResearchObject(ctx context.Context, objectUUID string, transferID string, pipelineID string) error {
 	si := &storageItem{
 		ObjectUUID: objectUUID,
 		TransferID: transferID,
+		PipelineID: pipelineID,
 	}
 	item, err := dynamodbattribute.MarshalMap(si)
 	if err != nil {
@@ -51,7 +95,9 @@ func (s *storageDynamoDBImpl) AssociateResearchObject(ctx context.Context, objec
 	return err
 }
 
-func (s *storageDynamoDBImpl) GetResearchObject(ctx context.Context, objectUUID string) (string, error) {
+// GetResearchObject returns the transfer of a research object and the pipeline
+// where it was started.
+func (s *storageDynamoDBImpl) GetResearchObject(ctx context.Context, objectUUID string) (string, string, error) {
 	var input = &dynamodb.GetItemInput{
 		TableName: aws.String(s.Table),
 		Key: map[string]*dynamodb.AttributeValue{
@@ -60,11 +106,119 @@ func (s *storageDynamoDBImpl) GetResearchObject(ctx context.Context, objectUUID
 	}
 	output, err := s.DynamoDB.GetItemWithContext(ctx, input)
 	if err != nil || output.Item == nil {
-		return "", fmt.Errorf("not found")
+		return "", "", fmt.Errorf("not found")
 	}
 	si := &storageItem{}
 	if err := dynamodbattribute.UnmarshalMap(output.Item, si); err != nil {
-		return "", err
+		return "", "", err
+	}
+	return si.TransferID, si.PipelineID, nil
+}
+
+// GetObject returns everything recorded about a research object, or
+// ErrObjectNotFound.
+func (s *storageDynamoDBImpl) GetObject(ctx context.Context, objectUUID string) (*StoredObject, error) {
+	output, err := s.DynamoDB.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.Table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"objectUUID": {S: aws.String(objectUUID)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(output.Item) == 0 {
+		return nil, ErrObjectNotFound
+	}
+	si := storageItem{}
+	if err := dynamodbattribute.UnmarshalMap(output.Item, &si); err != nil {
+		return nil, err
+	}
+	return &StoredObject{
+		StoredAIP:    si.storedAIP(),
+		TransferID:   si.TransferID,
+		TenantJiscID: si.TenantJiscID,
+	}, nil
+}
+
+// AssociateAIP records the AIP stored for a research object of a tenant.
+func (s *storageDynamoDBImpl) AssociateAIP(ctx context.Context, tenantID uint64, objectUUID string, aipID string) error {
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.Table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"objectUUID": {S: aws.String(objectUUID)},
+		},
+		UpdateExpression: aws.String("SET tenantJiscID = :tenantJiscID, aipID = :aipID"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":tenantJiscID": {N: aws.String(strconv.FormatUint(tenantID, 10))},
+			":aipID":        {S: aws.String(aipID)},
+		},
+	}
+	_, err := s.DynamoDB.UpdateItemWithContext(ctx, input)
+	return err
+}
+
+// ListAIPs returns the AIPs recorded for all the tenants, indexed by tenant.
+// The table is scanned once.
+func (s *storageDynamoDBImpl) ListAIPs(ctx context.Context) (map[uint64][]StoredAIP, error) {
+	input := &dynamodb.ScanInput{
+		TableName:        aws.String(s.Table),
+		FilterExpression: aws.String("attribute_exists(tenantJiscID) AND attribute_exists(aipID)"),
+	}
+	var (
+		aips = map[uint64][]StoredAIP{}
+		err  error
+	)
+	scanErr := s.DynamoDB.ScanPagesWithContext(ctx, input, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		items := []storageItem{}
+		if err = dynamodbattribute.UnmarshalListOfMaps(page.Items, &items); err != nil {
+			return false
+		}
+		for _, item := range items {
+			aips[item.TenantJiscID] = append(aips[item.TenantJiscID], item.storedAIP())
+		}
+		return true
+	})
+	if scanErr != nil {
+		return nil, scanErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return aips, nil
+}
+
+// RecordFixityCheck records the result of the last fixity check of the AIP of
+// a research object.
+func (s *storageDynamoDBImpl) RecordFixityCheck(ctx context.Context, objectUUID string, check FixityCheck) error {
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.Table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"objectUUID": {S: aws.String(objectUUID)},
+		},
+		UpdateExpression: aws.String("SET fixityCheckTime = :time, fixityCheckSuccess = :success, fixityCheckDetail = :detail"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":time":    {S: aws.String(check.Time.UTC().Format(time.RFC3339))},
+			":success": {BOOL: aws.Bool(check.Success)},
+			":detail":  {S: aws.String(check.Detail)},
+		},
+	}
+	_, err := s.DynamoDB.UpdateItemWithContext(ctx, input)
+	return err
+}
+
+func (si storageItem) storedAIP() StoredAIP {
+	aip := StoredAIP{
+		ObjectUUID: si.ObjectUUID,
+		AIPID:      si.AIPID,
+		PipelineID: si.PipelineID,
+	}
+	if t, err := time.Parse(time.RFC3339, si.FixityCheckTime); err == nil {
+		aip.FixityCheck = &FixityCheck{
+			Time:    t,
+			Success: si.FixityCheckSuccess,
+			Detail:  si.FixityCheckDetail,
+		}
 	}
-	return si.TransferID, nil
+	return aip
 }
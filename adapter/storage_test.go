@@ -2,7 +2,9 @@ package adapter
 
 import (
 	"context"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/request"
@@ -14,25 +16,114 @@ import (
 func TestStorageDynamoDBImpl(t *testing.T) {
 	ctx := context.Background()
 	dynamock := &mockDynamoDBClient{
-		GetItemWantedItem: &storageItem{ObjectUUID: "1", TransferID: "2"},
+		GetItemWantedItem: &storageItem{ObjectUUID: "1", TransferID: "2", PipelineID: "3"},
 	}
 	s := NewStorageDynamoDB(dynamock, "table")
 
-	id, _ := s.GetResearchObject(ctx, "foo")
+	id, pipelineID, _ := s.GetResearchObject(ctx, "foo")
 	if have, want := *dynamock.GetItemInput.Key["objectUUID"].S, "foo"; have != want {
 		t.Fatalf("GetResearchObject(); want %v, have %v", want, have)
 	}
 	if want, have := dynamock.GetItemWantedItem.(*storageItem).TransferID, id; want != have {
 		t.Fatalf("GetResearchObject(); want %v, have %v", want, have)
 	}
+	if want, have := dynamock.GetItemWantedItem.(*storageItem).PipelineID, pipelineID; want != have {
+		t.Fatalf("GetResearchObject(); want %v, have %v", want, have)
+	}
 
-	_ = s.AssociateResearchObject(ctx, "foo", "bar")
+	_ = s.AssociateResearchObject(ctx, "foo", "bar", "baz")
 	if have, want := *dynamock.PutItemInput.Item["objectUUID"].S, "foo"; have != want {
 		t.Fatalf("GetResearchObject(); want %v, have %v", want, have)
 	}
 	if have, want := *dynamock.PutItemInput.Item["transferID"].S, "bar"; have != want {
 		t.Fatalf("GetResearchObject(); want %v, have %v", want, have)
 	}
+	if have, want := *dynamock.PutItemInput.Item["pipelineID"].S, "baz"; have != want {
+		t.Fatalf("GetResearchObject(); want %v, have %v", want, have)
+	}
+}
+
+func TestStorageDynamoDBImpl_GetObject(t *testing.T) {
+	ctx := context.Background()
+	dynamock := &mockDynamoDBClient{
+		GetItemWantedItem: &storageItem{ObjectUUID: "1", TransferID: "2", PipelineID: "3", TenantJiscID: 1, AIPID: "4"},
+	}
+	s := NewStorageDynamoDB(dynamock, "table")
+
+	object, err := s.GetObject(ctx, "1")
+	if err != nil {
+		t.Fatalf("GetObject(): %v", err)
+	}
+	want := &StoredObject{
+		StoredAIP:    StoredAIP{ObjectUUID: "1", AIPID: "4", PipelineID: "3"},
+		TransferID:   "2",
+		TenantJiscID: 1,
+	}
+	if !reflect.DeepEqual(object, want) {
+		t.Fatalf("GetObject(); want %v, have %v", want, object)
+	}
+
+	dynamock.GetItemWantedItem = nil
+	if _, err := s.GetObject(ctx, "1"); err != ErrObjectNotFound {
+		t.Fatalf("GetObject(); want %v, have %v", ErrObjectNotFound, err)
+	}
+}
+
+func TestStorageDynamoDBImpl_AIPs(t *testing.T) {
+	ctx := context.Background()
+	dynamock := &mockDynamoDBClient{
+		ScanWantedItems: []interface{}{
+			&storageItem{ObjectUUID: "1", TransferID: "2", TenantJiscID: 1, AIPID: "3"},
+			&storageItem{ObjectUUID: "4", TransferID: "5", TenantJiscID: 1, AIPID: "6", FixityCheckTime: "2020-08-01T00:00:00Z", FixityCheckDetail: "Fixity check failed"},
+			&storageItem{ObjectUUID: "7", TransferID: "8", TenantJiscID: 2, AIPID: "9"},
+		},
+	}
+	s := NewStorageDynamoDB(dynamock, "table")
+
+	if err := s.AssociateAIP(ctx, 1, "1", "3"); err != nil {
+		t.Fatalf("AssociateAIP(): %v", err)
+	}
+	if have, want := *dynamock.UpdateItemInput.ExpressionAttributeValues[":tenantJiscID"].N, "1"; have != want {
+		t.Fatalf("AssociateAIP(); want %v, have %v", want, have)
+	}
+	if have, want := *dynamock.UpdateItemInput.ExpressionAttributeValues[":aipID"].S, "3"; have != want {
+		t.Fatalf("AssociateAIP(); want %v, have %v", want, have)
+	}
+
+	aips, err := s.ListAIPs(ctx)
+	if err != nil {
+		t.Fatalf("ListAIPs(): %v", err)
+	}
+	if have, want := *dynamock.ScanInput.FilterExpression, "attribute_exists(tenantJiscID) AND attribute_exists(aipID)"; have != want {
+		t.Fatalf("ListAIPs(); want %v, have %v", want, have)
+	}
+	want := map[uint64][]StoredAIP{
+		1: {
+			{ObjectUUID: "1", AIPID: "3"},
+			{ObjectUUID: "4", AIPID: "6", FixityCheck: &FixityCheck{
+				Time:   time.Date(2020, time.August, 1, 0, 0, 0, 0, time.UTC),
+				Detail: "Fixity check failed",
+			}},
+		},
+		2: {{ObjectUUID: "7", AIPID: "9"}},
+	}
+	if !reflect.DeepEqual(aips, want) {
+		t.Fatalf("ListAIPs(); want %v, have %v", want, aips)
+	}
+
+	check := FixityCheck{Time: time.Date(2020, time.August, 1, 0, 0, 0, 0, time.UTC), Success: true, Detail: "Fixity check succeeded"}
+	if err := s.RecordFixityCheck(ctx, "1", check); err != nil {
+		t.Fatalf("RecordFixityCheck(): %v", err)
+	}
+	if have, want := *dynamock.UpdateItemInput.Key["objectUUID"].S, "1"; have != want {
+		t.Fatalf("RecordFixityCheck(); want %v, have %v", want, have)
+	}
+	if have, want := *dynamock.UpdateItemInput.ExpressionAttributeValues[":time"].S, "2020-08-01T00:00:00Z"; have != want {
+		t.Fatalf("RecordFixityCheck(); want %v, have %v", want, have)
+	}
+	if have, want := *dynamock.UpdateItemInput.ExpressionAttributeValues[":success"].BOOL, true; have != want {
+		t.Fatalf("RecordFixityCheck(); want %v, have %v", want, have)
+	}
 }
 
 type mockDynamoDBClient struct {
@@ -40,6 +131,9 @@ type mockDynamoDBClient struct {
 	GetItemWantedItem interface{}
 	GetItemInput      *dynamodb.GetItemInput
 	PutItemInput      *dynamodb.PutItemInput
+	UpdateItemInput   *dynamodb.UpdateItemInput
+	ScanWantedItems   []interface{}
+	ScanInput         *dynamodb.ScanInput
 }
 
 func (m *mockDynamoDBClient) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, opts ...request.Option) (*dynamodb.GetItemOutput, error) {
@@ -55,3 +149,23 @@ func (m *mockDynamoDBClient) PutItemWithContext(ctx aws.Context, input *dynamodb
 	m.PutItemInput = input
 	return &dynamodb.PutItemOutput{}, nil
 }
+
+func (m *mockDynamoDBClient) UpdateItemWithContext(ctx aws.Context, input *dynamodb.UpdateItemInput, opts ...request.Option) (*dynamodb.UpdateItemOutput, error) {
+	m.UpdateItemInput = input
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+// ScanPagesWithContext returns each wanted item in a different page.
+func (m *mockDynamoDBClient) ScanPagesWithContext(ctx aws.Context, input *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool, opts ...request.Option) error {
+	m.ScanInput = input
+	for i, wanted := range m.ScanWantedItems {
+		item, err := dynamodbattribute.MarshalMap(wanted)
+		if err != nil {
+			return err
+		}
+		if !fn(&dynamodb.ScanOutput{Items: []map[string]*dynamodb.AttributeValue{item}}, i == len(m.ScanWantedItems)-1) {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package adapter
+
+import (
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/amclient"
+
+	"github.com/google/uuid"
+)
+
+// completionWatchers holds a completion watcher per pipeline so the in-flight
+// transfers of a pipeline are checked together. Pipelines are identified by
+// the URL of the Dashboard since the registry recreates the clients often.
+type completionWatchers struct {
+	interval time.Duration // Interval between checks, the default when zero.
+	m        map[string]*amclient.Watcher
+	sync.Mutex
+}
+
+func newCompletionWatchers() *completionWatchers {
+	return &completionWatchers{m: map[string]*amclient.Watcher{}}
+}
+
+// get returns the watcher of the pipeline of the client.
+func (cw *completionWatchers) get(c *amclient.Client) *amclient.Watcher {
+	cw.Lock()
+	defer cw.Unlock()
+	key := c.BaseURL.String()
+	w, ok := cw.m[key]
+	if !ok {
+		w = amclient.NewWatcher(c)
+		if cw.interval > 0 {
+			w.Interval = cw.interval
+		}
+		cw.m[key] = w
+		return w
+	}
+	w.SetClient(c)
+	return w
+}
+
+// activeJobs returns the number of jobs being processed for the transfers
+// waited for in the pipeline of the client, see amclient.Watcher.ActiveJobs.
+func (cw *completionWatchers) activeJobs(c *amclient.Client) (int, error) {
+	return cw.get(c).ActiveJobs()
+}
+
+// notify brings forward the checks of the pipelines. It reports whether the
+// identifier matches a transfer or a SIP being waited for.
+func (cw *completionWatchers) notify(ID string) bool {
+	cw.Lock()
+	defer cw.Unlock()
+	var found bool
+	for _, w := range cw.m {
+		if w.Notify(ID) {
+			found = true
+		}
+	}
+	return found
+}
+
+// ServeHTTP receives the post-store callbacks of the Archivematica Storage
+// Service. The identifier of the package is the last element of the path,
+// e.g. "/webhooks/aip-stored/<package_uuid>". Callbacks are not trusted, they
+// only bring forward the next status check.
+func (cw *completionWatchers) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ID := path.Base(r.URL.Path)
+	if _, err := uuid.Parse(ID); err != nil {
+		http.Error(w, "invalid package identifier", http.StatusBadRequest)
+		return
+	}
+	if !cw.notify(ID) {
+		http.Error(w, "package not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,63 @@
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/amclient"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompletionWatchers_get(t *testing.T) {
+	cw := newCompletionWatchers()
+	cw.interval = time.Minute
+
+	c1, _ := amclient.New(nil, "http://pipeline-1", "", "")
+	c2, _ := amclient.New(nil, "http://pipeline-1", "", "")
+	c3, _ := amclient.New(nil, "http://pipeline-2", "", "")
+
+	w1 := cw.get(c1)
+	assert.Equal(t, time.Minute, w1.Interval)
+	assert.Same(t, w1, cw.get(c2))
+	assert.NotSame(t, w1, cw.get(c3))
+}
+
+func TestCompletionWatchers_ServeHTTP(t *testing.T) {
+	const (
+		transferID = "e99afef7-90c5-4fd9-bf8f-bed13b3bd4ba"
+		SIPID      = "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0"
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/transfer/status/"+transferID+"/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"status": "COMPLETE", "sip_uuid": "%s"}`, SIPID)
+	})
+	mux.HandleFunc("/api/ingest/status/"+SIPID+"/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"status": "PROCESSING", "type": "SIP", "uuid": "%s"}`, SIPID)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	cw := newCompletionWatchers()
+	c, _ := amclient.New(nil, server.URL, "", "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cw.get(c).Wait(ctx, transferID)
+
+	callback := func(method, path string) int {
+		rec := httptest.NewRecorder()
+		cw.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec.Code
+	}
+	assert.Eventually(t, func() bool {
+		return callback("POST", "/webhooks/aip-stored/"+SIPID) == http.StatusAccepted
+	}, time.Second, time.Millisecond*10)
+	assert.Equal(t, http.StatusAccepted, callback("GET", "/webhooks/aip-stored/"+transferID))
+	assert.Equal(t, http.StatusNotFound, callback("POST", "/webhooks/aip-stored/a8d1b4f0-3e2f-4bb6-8c5e-4e3a2b6f0c19"))
+	assert.Equal(t, http.StatusBadRequest, callback("POST", "/webhooks/aip-stored/foobar"))
+	assert.Equal(t, http.StatusMethodNotAllowed, callback("DELETE", "/webhooks/aip-stored/"+SIPID))
+}
@@ -9,7 +9,9 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
+	"github.com/cenkalti/backoff/v3"
 	"github.com/gorilla/schema"
 	"github.com/spf13/afero"
 )
@@ -41,9 +43,20 @@ type Client struct {
 	Package          PackageService
 	Jobs             JobsService
 	Task             TaskService
+	Ingest           IngestService
+	Validate         ValidateService
+
+	// Storage Service client of the pipeline, if known.
+	StorageService *StorageServiceClient
 
 	// Local temporary filesystem. See transfer_session.go for more details.
 	fs afero.Fs
+
+	// Retries, rate limiting and circuit breaking of the requests. See
+	// resilience.go for more details.
+	retry   RetryPolicy
+	limiter *RateLimiter
+	breaker *CircuitBreaker
 }
 
 // Response is an Archivematica response. This wraps the standard http.Response
@@ -52,19 +65,6 @@ type Response struct {
 	*http.Response
 }
 
-// An ErrorResponse reports the error caused by an API request
-type ErrorResponse struct {
-	// HTTP response that caused this error
-	Response *http.Response
-}
-
-func (r *ErrorResponse) Error() string {
-	return fmt.Sprintf("%v %v: %d",
-		r.Response.Request.Method,
-		r.Response.Request.URL,
-		r.Response.StatusCode)
-}
-
 // NewClient returns a new Archivematica API client.
 func NewClient(httpClient *http.Client, bu, u, k string) *Client {
 	if httpClient == nil {
@@ -83,6 +83,8 @@ func NewClient(httpClient *http.Client, bu, u, k string) *Client {
 	c.Package = &PackageServiceOp{client: c}
 	c.Jobs = &JobsServiceOp{client: c}
 	c.Task = &TaskServiceOp{client: c}
+	c.Ingest = &IngestServiceOp{client: c}
+	c.Validate = &ValidateServiceOp{client: c}
 	return c
 }
 
@@ -126,6 +128,13 @@ func SetFsPath(path string) ClientOpt {
 	}
 }
 
+// Ping checks that the Dashboard API is reachable and that the credentials
+// are accepted by fetching the default processing configuration.
+func (c *Client) Ping(ctx context.Context) error {
+	_, _, err := c.ProcessingConfig.Get(ctx, "default")
+	return err
+}
+
 // TransferSession returns a new TransferSession bounded to this client.
 func (c *Client) TransferSession(name string) (*TransferSession, error) {
 	return NewTransferSession(c, name)
@@ -199,7 +208,64 @@ func newResponse(r *http.Response) *Response {
 // JSON decoded and stored in the value pointed to by v, or returned as an error
 // if an API error has occurred. If v implements the io.Writer interface, the
 // raw response will be written to v, without attempting to decode it.
+//
+// Idempotent requests that fail because the API is not available are retried
+// following the retry policy of the client. Requests wait for the rate limiter
+// and are rejected with ErrCircuitOpen while the circuit breaker is open.
 func (c *Client) Do(ctx context.Context, req *http.Request, v interface{}) (*Response, error) {
+	retry := c.retry.backOff(ctx)
+	for {
+		resp, err := c.try(ctx, req, v)
+		if !temporary(ctx, err) || !idempotent(req) {
+			return resp, err
+		}
+		wait := retry.NextBackOff()
+		if wait == backoff.Stop {
+			return resp, err
+		}
+		select {
+		case <-ctx.Done():
+			return resp, err
+		case <-time.After(wait):
+		}
+		if req.GetBody != nil {
+			body, berr := req.GetBody()
+			if berr != nil {
+				return resp, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+// try sends the request once, going through the rate limiter and the circuit
+// breaker of the client.
+func (c *Client) try(ctx context.Context, req *http.Request, v interface{}) (*Response, error) {
+	if c.breaker != nil {
+		if err := c.breaker.allow(); err != nil {
+			return nil, err
+		}
+	}
+	if c.limiter != nil {
+		if err := c.limiter.Wait(ctx); err != nil {
+			if c.breaker != nil {
+				c.breaker.abort()
+			}
+			return nil, err
+		}
+	}
+	resp, err := c.do(ctx, req, v)
+	if c.breaker != nil {
+		if ctx.Err() != nil {
+			c.breaker.abort()
+		} else {
+			c.breaker.record(temporary(ctx, err))
+		}
+	}
+	return resp, err
+}
+
+func (c *Client) do(ctx context.Context, req *http.Request, v interface{}) (*Response, error) {
 	req = req.WithContext(ctx)
 	resp, err := c.client.Do(req)
 	if err != nil {
@@ -235,15 +301,3 @@ func (c *Client) Do(ctx context.Context, req *http.Request, v interface{}) (*Res
 
 	return response, err
 }
-
-// CheckResponse checks the API response for errors, and returns them if
-// present. A response is considered an error if it has a status code outside
-// the 200 range. API error responses are expected to have either no response
-// body, or a JSON response body that maps to ErrorResponse. Any other response
-// body will be silently ignored.
-func CheckResponse(r *http.Response) error {
-	if c := r.StatusCode; c >= 200 && c <= 299 {
-		return nil
-	}
-	return &ErrorResponse{Response: r}
-}
@@ -13,10 +13,11 @@ import (
 )
 
 var (
-	mux    *http.ServeMux
-	ctx    = context.TODO()
-	client *Client
-	server *httptest.Server
+	mux      *http.ServeMux
+	ctx      = context.TODO()
+	client   *Client
+	ssClient *StorageServiceClient
+	server   *httptest.Server
 )
 
 func setup() {
@@ -24,6 +25,7 @@ func setup() {
 	server = httptest.NewServer(mux)
 	url, _ := url.Parse(server.URL)
 	client = NewClient(nil, url.String(), "", "")
+	ssClient = NewStorageServiceClient(nil, url.String(), "", "")
 }
 
 func teardown() {
@@ -80,6 +82,27 @@ func TestDo_httpError(t *testing.T) {
 	}
 }
 
+func TestPing(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/processing-configuration/default/", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		if r.Header.Get("Authorization") != "ApiKey user:key" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, "<processingMCP><preconfiguredChoices/></processingMCP>")
+	})
+
+	if err := NewClient(nil, server.URL, "user", "key").Ping(ctx); err != nil {
+		t.Errorf("Ping(): %v", err)
+	}
+	if err := NewClient(nil, server.URL, "user", "wrong").Ping(ctx); err == nil {
+		t.Error("Ping(): expected error with invalid credentials")
+	}
+}
+
 func TestCustomUserAgent(t *testing.T) {
 	c, err := New(nil, "http://127.0.0.1", "", "", SetUserAgent("testing"))
 
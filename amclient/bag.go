@@ -0,0 +1,202 @@
+package amclient
+
+import (
+	"archive/zip"
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+// Transfer types supported by TransferSession.
+const (
+	TransferTypeStandard    = standardTransferType
+	TransferTypeUnzippedBag = "unzipped bag"
+	TransferTypeZippedBag   = "zipped bag"
+)
+
+const (
+	bagPayloadDir = "data"
+	bagItVersion  = "0.97"
+)
+
+// BagInfo holds the metadata of a bag, written in the `bag-info.txt` file.
+type BagInfo struct {
+	entries [][2]string
+}
+
+// Add registers a field of the bag, e.g. "External-Identifier". Fields can be
+// repeated.
+func (b *BagInfo) Add(label, value string) {
+	// Line breaks would corrupt the tag file.
+	value = strings.Join(strings.Fields(value), " ")
+	if label == "" || value == "" {
+		return
+	}
+	b.entries = append(b.entries, [2]string{label, value})
+}
+
+// Entries returns the fields registered, in the order they were added.
+func (b *BagInfo) Entries() [][2]string {
+	return append([][2]string{}, b.entries...)
+}
+
+// bag turns the contents of the filesystem into a BagIt bag: the contents are
+// moved into the payload directory and the tag files are created. The SHA-256
+// checksums known are used in the manifest instead of the actual checksums of
+// the files so the validation of the bag confirms them. sums are indexed by the
+// name of the file relative to the payload directory.
+func bag(fs afero.Fs, info *BagInfo, sums map[string]string, now time.Time) error {
+	entries, err := afero.ReadDir(fs, "/")
+	if err != nil {
+		return err
+	}
+	payloadDir := "/" + bagPayloadDir
+	if err := fs.Mkdir(payloadDir, os.FileMode(0o755)); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := fs.Rename(path.Join("/", entry.Name()), path.Join(payloadDir, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	manifest := map[string]string{}
+	var octets, count int64
+	err = afero.Walk(fs, payloadDir, func(name string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		name = strings.TrimPrefix(path.Clean("/"+name), "/")
+		rel := strings.TrimPrefix(name, bagPayloadDir+"/")
+		sum, ok := sums[rel]
+		if !ok {
+			if sum, err = sha256File(fs, "/"+name); err != nil {
+				return err
+			}
+		}
+		manifest[name] = strings.ToLower(sum)
+		octets += fi.Size()
+		count++
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "cannot build manifest")
+	}
+
+	if err := writeTagFile(fs, "bagit.txt", [][2]string{
+		{"BagIt-Version", bagItVersion},
+		{"Tag-File-Character-Encoding", "UTF-8"},
+	}); err != nil {
+		return err
+	}
+	bagInfo := append(info.Entries(),
+		[2]string{"Bagging-Date", now.Format("2006-01-02")},
+		[2]string{"Payload-Oxum", fmt.Sprintf("%d.%d", octets, count)})
+	if err := writeTagFile(fs, "bag-info.txt", bagInfo); err != nil {
+		return err
+	}
+	if err := writeManifest(fs, "manifest-sha256.txt", manifest); err != nil {
+		return err
+	}
+
+	tags := map[string]string{}
+	for _, name := range []string{"bagit.txt", "bag-info.txt", "manifest-sha256.txt"} {
+		sum, err := sha256File(fs, name)
+		if err != nil {
+			return err
+		}
+		tags[name] = sum
+	}
+	return writeManifest(fs, "tagmanifest-sha256.txt", tags)
+}
+
+func sha256File(fs afero.Fs, name string) (string, error) {
+	f, err := fs.Open(path.Join("/", name))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func writeTagFile(fs afero.Fs, name string, entries [][2]string) error {
+	f, err := fs.Create(path.Join("/", name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	buf := bufio.NewWriter(f)
+	for _, entry := range entries {
+		fmt.Fprintf(buf, "%s: %s\n", entry[0], entry[1])
+	}
+	return buf.Flush()
+}
+
+func writeManifest(fs afero.Fs, name string, sums map[string]string) error {
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	f, err := fs.Create(path.Join("/", name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	buf := bufio.NewWriter(f)
+	for _, name := range names {
+		fmt.Fprintf(buf, "%s  %s\n", sums[name], name)
+	}
+	return buf.Flush()
+}
+
+// zipDir writes the contents of the filesystem into a zip file. Entries are
+// placed inside a top-level directory called root as expected by Archivematica.
+func zipDir(fs afero.Fs, root string, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	err := afero.Walk(fs, "/", func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name = path.Join(root, path.Clean("/"+name))
+		if fi.IsDir() {
+			_, err := zw.Create(name + "/")
+			return err
+		}
+		hdr, err := zip.FileInfoHeader(fi)
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		hdr.Method = zip.Deflate
+		dst, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		src, err := fs.Open(strings.TrimPrefix(name, root))
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(dst, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
@@ -0,0 +1,126 @@
+package amclient
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sha256String(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestBag(t *testing.T) {
+	// MemMapFs can't rename directories with contents.
+	fs := afero.NewBasePathFs(afero.NewOsFs(), t.TempDir())
+	fs.MkdirAll("/sounds", 0o755)
+	fs.MkdirAll("/metadata", 0o755)
+	afero.WriteFile(fs, "/woodpigeon pic.jpg", []byte("woodpigeon"), 0o644)
+	afero.WriteFile(fs, "/sounds/bird.mp3", []byte("bird"), 0o644)
+	afero.WriteFile(fs, "/metadata/metadata.csv", []byte("filename,dc.title\n"), 0o644)
+
+	info := &BagInfo{}
+	info.Add("External-Identifier", "c7d2f1f2-8a4b-4d4a-9d3e-9f1f5c1a2b3c")
+	info.Add("External-Description", "Multi-line\n  description")
+	info.Add("Source-Organization", "")
+	now := time.Date(2020, time.August, 1, 0, 0, 0, 0, time.UTC)
+
+	// The checksum registered is used even if it doesn't match.
+	err := bag(fs, info, map[string]string{
+		"woodpigeon pic.jpg": "ABCDEF",
+	}, now)
+	require.NoError(t, err)
+
+	read := func(name string) string {
+		blob, err := afero.ReadFile(fs, name)
+		require.NoError(t, err)
+		return string(blob)
+	}
+	assert.Equal(t, "BagIt-Version: 0.97\nTag-File-Character-Encoding: UTF-8\n", read("/bagit.txt"))
+	assert.Equal(t, "External-Identifier: c7d2f1f2-8a4b-4d4a-9d3e-9f1f5c1a2b3c\n"+
+		"External-Description: Multi-line description\n"+
+		"Bagging-Date: 2020-08-01\n"+
+		"Payload-Oxum: 32.3\n", read("/bag-info.txt"))
+	assert.Equal(t, ""+
+		sha256String("filename,dc.title\n")+"  data/metadata/metadata.csv\n"+
+		sha256String("bird")+"  data/sounds/bird.mp3\n"+
+		"abcdef  data/woodpigeon pic.jpg\n", read("/manifest-sha256.txt"))
+	assert.Equal(t, ""+
+		sha256String(read("/bag-info.txt"))+"  bag-info.txt\n"+
+		sha256String(read("/bagit.txt"))+"  bagit.txt\n"+
+		sha256String(read("/manifest-sha256.txt"))+"  manifest-sha256.txt\n", read("/tagmanifest-sha256.txt"))
+
+	exists, _ := afero.Exists(fs, "/woodpigeon pic.jpg")
+	assert.False(t, exists)
+	exists, _ = afero.Exists(fs, "/data/sounds/bird.mp3")
+	assert.True(t, exists)
+}
+
+func TestTransferSession_Start_unzippedBag(t *testing.T) {
+	ts := newTransferSession(t, "Test").WithTransferType(TransferTypeUnzippedBag)
+	defer ts.Destroy()
+	f, _ := ts.Create("bird.mp3")
+	f.Write([]byte("bird"))
+	f.Close()
+	ts.ChecksumSHA256("bird.mp3", sha256String("bird"))
+	ts.DescribeBag("External-Identifier", "c7d2f1f2-8a4b-4d4a-9d3e-9f1f5c1a2b3c")
+
+	_, err := ts.Start(ctx)
+	require.NoError(t, err)
+
+	req := ts.c.Package.(*packageServiceMock).createReq
+	assert.Equal(t, TransferTypeUnzippedBag, req.Type)
+	assert.Equal(t, ts.path(), req.Path)
+	contents := ts.Contents()
+	sort.Strings(contents)
+	assert.Equal(t, []string{
+		"bag-info.txt",
+		"bagit.txt",
+		"data/bird.mp3",
+		"data/metadata/checksum.sha256",
+		"manifest-sha256.txt",
+		"tagmanifest-sha256.txt",
+	}, contents)
+}
+
+func TestTransferSession_Start_zippedBag(t *testing.T) {
+	ts := newTransferSession(t, "Test").WithTransferType(TransferTypeZippedBag)
+	f, _ := ts.Create("bird.mp3")
+	f.Write([]byte("bird"))
+	f.Close()
+
+	_, err := ts.Start(ctx)
+	require.NoError(t, err)
+
+	req := ts.c.Package.(*packageServiceMock).createReq
+	assert.Equal(t, TransferTypeZippedBag, req.Type)
+	assert.Equal(t, ts.path()+".zip", req.Path)
+	_, err = os.Stat(ts.fullPath())
+	assert.True(t, os.IsNotExist(err), "transfer directory not removed")
+
+	zr, err := zip.OpenReader(ts.fullPath() + ".zip")
+	require.NoError(t, err)
+	names := []string{}
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	zr.Close()
+	root := filepath.Base(ts.fullPath())
+	assert.Contains(t, names, root+"/bagit.txt")
+	assert.Contains(t, names, root+"/data/bird.mp3")
+	assert.Contains(t, names, root+"/manifest-sha256.txt")
+
+	assert.NoError(t, ts.Destroy())
+	_, err = os.Stat(ts.fullPath() + ".zip")
+	assert.True(t, os.IsNotExist(err), "zipped bag not removed")
+}
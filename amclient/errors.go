@@ -0,0 +1,149 @@
+package amclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// maxErrorBody is the maximum number of bytes of the response body kept in
+// ErrorResponse.
+const maxErrorBody = 1024
+
+// ErrorKind classifies the errors reported by the API.
+type ErrorKind int
+
+const (
+	// ErrorKindUnknown is used for responses that do not fit in the other
+	// kinds, e.g. "429 Too Many Requests".
+	ErrorKindUnknown ErrorKind = iota
+
+	// ErrorKindAuth is used for "401 Unauthorized" and "403 Forbidden".
+	ErrorKindAuth
+
+	// ErrorKindNotFound is used for "404 Not Found".
+	ErrorKindNotFound
+
+	// ErrorKindValidation is used for requests rejected by the API, e.g.
+	// "400 Bad Request" or "409 Conflict".
+	ErrorKindValidation
+
+	// ErrorKindServer is used for server errors, i.e. "5xx" status codes.
+	ErrorKindServer
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorKindAuth:
+		return "auth"
+	case ErrorKindNotFound:
+		return "not found"
+	case ErrorKindValidation:
+		return "validation"
+	case ErrorKindServer:
+		return "server"
+	default:
+		return "unknown"
+	}
+}
+
+func errorKind(code int) ErrorKind {
+	switch {
+	case code == http.StatusUnauthorized, code == http.StatusForbidden:
+		return ErrorKindAuth
+	case code == http.StatusNotFound:
+		return ErrorKindNotFound
+	case code == http.StatusBadRequest,
+		code == http.StatusMethodNotAllowed,
+		code == http.StatusConflict,
+		code == http.StatusUnsupportedMediaType,
+		code == http.StatusUnprocessableEntity:
+		return ErrorKindValidation
+	case code >= 500:
+		return ErrorKindServer
+	default:
+		return ErrorKindUnknown
+	}
+}
+
+// An ErrorResponse reports the error caused by an API request. Callers can
+// use errors.As to retrieve it and branch on its Kind, e.g.:
+//
+//	var errResp *amclient.ErrorResponse
+//	if errors.As(err, &errResp) && errResp.Kind == amclient.ErrorKindNotFound {
+//		...
+//	}
+type ErrorResponse struct {
+	// HTTP response that caused this error
+	Response *http.Response
+
+	// Kind of error, based on the status code of the response.
+	Kind ErrorKind
+
+	// Message found in the response body, e.g. the "message" attribute of
+	// `{"error": true, "message": "..."}`. Empty when the body could not be
+	// decoded.
+	Message string
+
+	// Body of the response, truncated to 1024 bytes.
+	Body []byte
+}
+
+func (r *ErrorResponse) Error() string {
+	err := fmt.Sprintf("%v %v: %d",
+		r.Response.Request.Method,
+		r.Response.Request.URL,
+		r.Response.StatusCode)
+	if r.Message != "" {
+		err = fmt.Sprintf("%s %s", err, r.Message)
+	}
+	return err
+}
+
+// Temporary reports whether the request may succeed if it is retried, i.e. the
+// error is a server error, the request timed out or it was throttled.
+func (r *ErrorResponse) Temporary() bool {
+	switch r.Response.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return r.Kind == ErrorKindServer
+}
+
+// CheckResponse checks the API response for errors, and returns them if
+// present. A response is considered an error if it has a status code outside
+// the 200 range. The body of the error responses is read into the
+// ErrorResponse returned, JSON bodies are decoded to find the error message.
+func CheckResponse(r *http.Response) error {
+	if c := r.StatusCode; c >= 200 && c <= 299 {
+		return nil
+	}
+	errResp := &ErrorResponse{
+		Response: r,
+		Kind:     errorKind(r.StatusCode),
+	}
+	if r.Body != nil {
+		errResp.Body, _ = ioutil.ReadAll(io.LimitReader(r.Body, maxErrorBody))
+	}
+	errResp.Message = errorMessage(errResp.Body)
+	return errResp
+}
+
+// errorMessage looks up the error message in a JSON response body. Dashboard
+// errors use the "message" attribute while Storage Service errors use "error"
+// or "error_message".
+func errorMessage(body []byte) string {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ""
+	}
+	for _, attr := range []string{"message", "error_message", "error"} {
+		if msg, ok := payload[attr].(string); ok && strings.TrimSpace(msg) != "" {
+			return strings.TrimSpace(msg)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,84 @@
+package amclient
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckResponse(t *testing.T) {
+	tests := []struct {
+		name      string
+		code      int
+		body      string
+		kind      ErrorKind
+		message   string
+		temporary bool
+	}{
+		{"dashboard error", http.StatusBadRequest, `{"error": true, "message": "Cannot fetch unitTransfer with UUID"}`, ErrorKindValidation, "Cannot fetch unitTransfer with UUID", false},
+		{"storage service error", http.StatusNotFound, `{"error": "Package not found"}`, ErrorKindNotFound, "Package not found", false},
+		{"tastypie error", http.StatusInternalServerError, `{"error_message": "Sorry, this request could not be processed."}`, ErrorKindServer, "Sorry, this request could not be processed.", true},
+		{"unauthorized", http.StatusUnauthorized, ``, ErrorKindAuth, "", false},
+		{"forbidden", http.StatusForbidden, `<h1>Forbidden</h1>`, ErrorKindAuth, "", false},
+		{"throttled", http.StatusTooManyRequests, `{"error": true}`, ErrorKindUnknown, "", true},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "http://localhost/api/foo/", nil)
+			resp := &http.Response{Request: req, StatusCode: tc.code, Body: http.NoBody}
+			if tc.body != "" {
+				resp.Body = ioutil.NopCloser(strings.NewReader(tc.body))
+			}
+
+			err := CheckResponse(resp)
+
+			var errResp *ErrorResponse
+			require.True(t, errors.As(err, &errResp))
+			assert.Equal(t, tc.kind, errResp.Kind)
+			assert.Equal(t, tc.message, errResp.Message)
+			assert.Equal(t, tc.body, string(errResp.Body))
+			assert.Equal(t, tc.temporary, errResp.Temporary())
+		})
+	}
+}
+
+func TestCheckResponse_truncated(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://localhost/api/foo/", nil)
+	resp := &http.Response{Request: req, StatusCode: http.StatusBadGateway, Body: ioutil.NopCloser(strings.NewReader(strings.Repeat("x", maxErrorBody*2)))}
+
+	err := CheckResponse(resp).(*ErrorResponse)
+
+	assert.Len(t, err.Body, maxErrorBody)
+	assert.Equal(t, "GET http://localhost/api/foo/: 502", err.Error())
+}
+
+func TestDo_errorResponse(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/transfer/status/foo/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": true, "message": "Cannot fetch unitTransfer with UUID foo", "type": "transfer"}`))
+	})
+
+	_, _, err := client.Transfer.Status(ctx, "foo")
+
+	var errResp *ErrorResponse
+	require.True(t, errors.As(errors.Wrap(err, "request failed"), &errResp))
+	assert.Equal(t, ErrorKindValidation, errResp.Kind)
+	assert.Equal(t, "GET "+server.URL+"/api/transfer/status/foo/: 400 Cannot fetch unitTransfer with UUID foo", err.Error())
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "short", truncate("short", 10))
+	assert.Equal(t, "abc...", truncate("abcdef", 3))
+	// "é" is two bytes long, it is not split.
+	assert.Equal(t, "ab...", truncate("abé", 3))
+	assert.Equal(t, "abé...", truncate("abéd", 4))
+}
@@ -0,0 +1,118 @@
+package amclient
+
+import (
+	"context"
+	"fmt"
+)
+
+const ingestBasePath = "api/ingest"
+
+// Unit statuses reported by TransferService.Status and IngestService.Status.
+const (
+	UnitStatusProcessing = "PROCESSING"
+	UnitStatusUserInput  = "USER_INPUT"
+	UnitStatusComplete   = "COMPLETE"
+	UnitStatusFailed     = "FAILED"
+	UnitStatusRejected   = "REJECTED"
+)
+
+// IngestService is an interface for interfacing with the Ingest endpoints of
+// the Dashboard API.
+type IngestService interface {
+	Status(context.Context, string) (*IngestStatusResponse, *Response, error)
+	Hide(context.Context, string) (*HideResponse, *Response, error)
+	Completed(context.Context) (*CompletedResponse, *Response, error)
+	ReingestApprove(context.Context, *IngestReingestApproveRequest) (*IngestReingestApproveResponse, *Response, error)
+}
+
+// IngestServiceOp handles communication with the Ingest related methods of
+// the Archivematica API.
+type IngestServiceOp struct {
+	client *Client
+}
+
+var _ IngestService = &IngestServiceOp{}
+
+// IngestStatusResponse represents the status of a SIP.
+type IngestStatusResponse struct {
+	ID           string `json:"uuid"`
+	Status       string `json:"status"`
+	Name         string `json:"name"`
+	Microservice string `json:"microservice"`
+	Directory    string `json:"directory"`
+	Path         string `json:"path"`
+	Message      string `json:"message"`
+	Type         string `json:"type"`
+}
+
+// Status obtains the status of a SIP given its identifier.
+func (s *IngestServiceOp) Status(ctx context.Context, ID string) (*IngestStatusResponse, *Response, error) {
+	path := fmt.Sprintf("%s/status/%s", ingestBasePath, ID)
+
+	req, err := s.client.NewRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payload := &IngestStatusResponse{}
+	resp, err := s.client.Do(ctx, req, payload)
+
+	return payload, resp, err
+}
+
+// Hide removes a completed SIP from the Dashboard. Its AIP is not deleted.
+func (s *IngestServiceOp) Hide(ctx context.Context, ID string) (*HideResponse, *Response, error) {
+	path := fmt.Sprintf("%s/%s/delete/", ingestBasePath, ID)
+
+	req, err := s.client.NewRequest(ctx, "DELETE", path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payload := &HideResponse{}
+	resp, err := s.client.Do(ctx, req, payload)
+
+	return payload, resp, err
+}
+
+// Completed lists the identifiers of the completed SIPs that are not hidden.
+func (s *IngestServiceOp) Completed(ctx context.Context) (*CompletedResponse, *Response, error) {
+	path := fmt.Sprintf("%s/completed/", ingestBasePath)
+
+	req, err := s.client.NewRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payload := &CompletedResponse{}
+	resp, err := s.client.Do(ctx, req, payload)
+
+	return payload, resp, err
+}
+
+// IngestReingestApproveRequest represents a request to approve the reingest
+// of an AIP, see StoragePackageService.Reingest.
+type IngestReingestApproveRequest struct {
+	SIPID string `schema:"uuid"`
+}
+
+// IngestReingestApproveResponse represents a response to
+// IngestReingestApproveRequest.
+type IngestReingestApproveResponse struct {
+	Message string `json:"message"`
+}
+
+// ReingestApprove approves a partial reingest awaiting for approval.
+func (s *IngestServiceOp) ReingestApprove(ctx context.Context, r *IngestReingestApproveRequest) (*IngestReingestApproveResponse, *Response, error) {
+	path := fmt.Sprintf("%s/reingest/approve/", ingestBasePath)
+
+	req, err := s.client.NewRequest(ctx, "POST", path, r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payload := &IngestReingestApproveResponse{}
+	resp, err := s.client.Do(ctx, req, payload)
+
+	return payload, resp, err
+}
@@ -0,0 +1,90 @@
+package amclient
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIngest_Status(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/ingest/status/41699e73-ec9e-4240-b153-71f4155e7da4/", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprint(w, `{
+	"status": "COMPLETE",
+	"name": "imgs",
+	"microservice": "Remove the processing directory",
+	"directory": "imgs-41699e73-ec9e-4240-b153-71f4155e7da4",
+	"path": "/var/archivematica/sharedDirectory/currentlyProcessing/imgs-41699e73-ec9e-4240-b153-71f4155e7da4/",
+	"message": "Fetched status for 41699e73-ec9e-4240-b153-71f4155e7da4 successfully.",
+	"type": "SIP",
+	"uuid": "41699e73-ec9e-4240-b153-71f4155e7da4"
+}`)
+	})
+
+	payload, _, err := client.Ingest.Status(ctx, "41699e73-ec9e-4240-b153-71f4155e7da4")
+
+	assert.NoError(t, err)
+	assert.Equal(t, &IngestStatusResponse{
+		ID:           "41699e73-ec9e-4240-b153-71f4155e7da4",
+		Status:       UnitStatusComplete,
+		Name:         "imgs",
+		Microservice: "Remove the processing directory",
+		Directory:    "imgs-41699e73-ec9e-4240-b153-71f4155e7da4",
+		Path:         "/var/archivematica/sharedDirectory/currentlyProcessing/imgs-41699e73-ec9e-4240-b153-71f4155e7da4/",
+		Message:      "Fetched status for 41699e73-ec9e-4240-b153-71f4155e7da4 successfully.",
+		Type:         "SIP",
+	}, payload)
+}
+
+func TestIngest_Hide(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/ingest/41699e73-ec9e-4240-b153-71f4155e7da4/delete/", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "DELETE")
+		fmt.Fprint(w, `{"removed": true}`)
+	})
+
+	payload, _, err := client.Ingest.Hide(ctx, "41699e73-ec9e-4240-b153-71f4155e7da4")
+
+	assert.NoError(t, err)
+	assert.Equal(t, &HideResponse{Removed: true}, payload)
+}
+
+func TestIngest_Completed(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/ingest/completed/", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprint(w, `{"message": "Fetched completed ingests successfully.", "results": ["41699e73-ec9e-4240-b153-71f4155e7da4", "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0"]}`)
+	})
+
+	payload, _, err := client.Ingest.Completed(ctx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"41699e73-ec9e-4240-b153-71f4155e7da4", "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0"}, payload.Results)
+}
+
+func TestIngest_ReingestApprove(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/ingest/reingest/approve/", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		assert.Equal(t, "41699e73-ec9e-4240-b153-71f4155e7da4", r.FormValue("uuid"))
+		fmt.Fprint(w, `{"message": "Approval successful."}`)
+	})
+
+	payload, _, err := client.Ingest.ReingestApprove(ctx, &IngestReingestApproveRequest{
+		SIPID: "41699e73-ec9e-4240-b153-71f4155e7da4",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Approval successful.", payload.Message)
+}
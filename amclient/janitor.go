@@ -0,0 +1,60 @@
+package amclient
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+// SweepTransferSessions removes the directories of the transfer sessions, and
+// their zipped bags, that have not been modified for longer than maxAge, e.g.
+// left behind by sessions that crashed before they were destroyed. A directory
+// is considered modified when any of its files is. It returns the names of the
+// entries removed.
+func (c *Client) SweepTransferSessions(maxAge time.Duration) ([]string, error) {
+	if c.fs == nil {
+		return nil, errors.New("the base filesystem is not assigned")
+	}
+	entries, err := afero.ReadDir(c.fs, "/")
+	if err != nil {
+		return nil, errors.Wrap(err, "transfer directory cannot be read")
+	}
+	deadline := time.Now().Add(-maxAge)
+	removed := []string{}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), transferSessionPrefix) {
+			continue
+		}
+		name := path.Join("/", entry.Name())
+		if lastModified(c.fs, name, entry).After(deadline) {
+			continue
+		}
+		if err := c.fs.RemoveAll(name); err != nil {
+			return removed, errors.Wrapf(err, "%s cannot be removed", entry.Name())
+		}
+		removed = append(removed, entry.Name())
+	}
+	sort.Strings(removed)
+	return removed, nil
+}
+
+// lastModified returns the last modification time of a file or, when it is a
+// directory, of the files it contains.
+func lastModified(fs afero.Fs, name string, info os.FileInfo) time.Time {
+	last := info.ModTime()
+	if !info.IsDir() {
+		return last
+	}
+	_ = afero.Walk(fs, name, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+		return nil
+	})
+	return last
+}
@@ -0,0 +1,41 @@
+package amclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_SweepTransferSessions(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	c, _ := New(nil, "http://localhost", "", "", SetFs(fs))
+	old := time.Now().Add(-time.Hour * 72)
+	touch := func(name string, modTime time.Time) {
+		require.NoError(t, afero.WriteFile(fs, name, []byte("contents"), 0o644))
+		require.NoError(t, fs.Chtimes(name, modTime, modTime))
+	}
+	touch("/amclientTransfer1/bird.mp3", old)
+	fs.Chtimes("/amclientTransfer1", old, old)
+	touch("/amclientTransfer2/bird.mp3", time.Now()) // Still being written.
+	fs.Chtimes("/amclientTransfer2", old, old)
+	touch("/amclientTransfer3.zip", old)
+	touch("/other/bird.mp3", old)
+	fs.Chtimes("/other", old, old)
+
+	removed, err := c.SweepTransferSessions(time.Hour * 48)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"amclientTransfer1", "amclientTransfer3.zip"}, removed)
+	for name, want := range map[string]bool{
+		"/amclientTransfer1":     false,
+		"/amclientTransfer2":     true,
+		"/amclientTransfer3.zip": false,
+		"/other":                 true,
+	} {
+		exists, _ := afero.Exists(fs, name)
+		assert.Equal(t, want, exists, name)
+	}
+}
@@ -3,7 +3,11 @@ package amclient
 import (
 	"bytes"
 	"context"
+	"encoding/xml"
 	"fmt"
+	"io"
+	"sort"
+	"strings"
 )
 
 const processingConfigBasePath = "api/processing-configuration"
@@ -28,6 +32,11 @@ type ProcessingConfig struct {
 	bytes.Buffer
 }
 
+// Decode parses the processing configuration document.
+func (p *ProcessingConfig) Decode() (*ProcessingMCP, error) {
+	return ParseProcessingConfig(bytes.NewReader(p.Bytes()))
+}
+
 // Get obtains a processing configuration given its name.
 func (s *ProcessingConfigOp) Get(ctx context.Context, name string) (*ProcessingConfig, *Response, error) {
 	path := fmt.Sprintf("%s/%s/", processingConfigBasePath, name)
@@ -42,3 +51,96 @@ func (s *ProcessingConfigOp) Get(ctx context.Context, name string) (*ProcessingC
 
 	return payload, resp, err
 }
+
+// ProcessingMCP is a processing configuration document. It lists the choices
+// that the workflow makes without asking the user.
+type ProcessingMCP struct {
+	XMLName xml.Name              `xml:"processingMCP"`
+	Choices []PreconfiguredChoice `xml:"preconfiguredChoices>preconfiguredChoice"`
+}
+
+// PreconfiguredChoice is the choice made in a decision point of the workflow.
+type PreconfiguredChoice struct {
+	// AppliesTo is the identifier of the decision point.
+	AppliesTo string `xml:"appliesTo"`
+
+	// GoToChain is the identifier of the chain or link chosen.
+	GoToChain string `xml:"goToChain"`
+
+	// Delay is an optional delay before the choice is made.
+	Delay *ProcessingDelay `xml:"delay,omitempty"`
+}
+
+// ProcessingDelay is the delay of a preconfigured choice.
+type ProcessingDelay struct {
+	UnitCtime string `xml:"unitCtime,attr,omitempty"`
+	Value     string `xml:",chardata"`
+}
+
+// ParseProcessingConfig parses a processing configuration document.
+func ParseProcessingConfig(r io.Reader) (*ProcessingMCP, error) {
+	config := &ProcessingMCP{}
+	if err := xml.NewDecoder(r).Decode(config); err != nil {
+		return nil, err
+	}
+	for i, choice := range config.Choices {
+		config.Choices[i].AppliesTo = strings.TrimSpace(choice.AppliesTo)
+		config.Choices[i].GoToChain = strings.TrimSpace(choice.GoToChain)
+	}
+	return config, nil
+}
+
+// Marshal encodes the processing configuration document.
+func (p *ProcessingMCP) Marshal() ([]byte, error) {
+	blob, err := xml.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(blob, '\n'), nil
+}
+
+// Choice returns the choice made in a decision point.
+func (p *ProcessingMCP) Choice(appliesTo string) (PreconfiguredChoice, bool) {
+	for _, choice := range p.Choices {
+		if choice.AppliesTo == appliesTo {
+			return choice, true
+		}
+	}
+	return PreconfiguredChoice{}, false
+}
+
+// ProcessingConfigDifference is a decision point where two processing
+// configurations differ. Choices missing in one of the documents are empty.
+type ProcessingConfigDifference struct {
+	AppliesTo string
+	Want      string
+	Got       string
+}
+
+// Diff lists the decision points where the processing configuration differs
+// from the one wanted, sorted by identifier. Delays are not compared.
+func (p *ProcessingMCP) Diff(want *ProcessingMCP) []ProcessingConfigDifference {
+	points := map[string]struct{}{}
+	for _, choice := range p.Choices {
+		points[choice.AppliesTo] = struct{}{}
+	}
+	for _, choice := range want.Choices {
+		points[choice.AppliesTo] = struct{}{}
+	}
+	diff := []ProcessingConfigDifference{}
+	for appliesTo := range points {
+		got, _ := p.Choice(appliesTo)
+		wanted, _ := want.Choice(appliesTo)
+		if got.GoToChain != wanted.GoToChain {
+			diff = append(diff, ProcessingConfigDifference{
+				AppliesTo: appliesTo,
+				Want:      wanted.GoToChain,
+				Got:       got.GoToChain,
+			})
+		}
+	}
+	sort.Slice(diff, func(i, j int) bool {
+		return diff[i].AppliesTo < diff[j].AppliesTo
+	})
+	return diff
+}
@@ -3,7 +3,10 @@ package amclient
 import (
 	"fmt"
 	"net/http"
+	"strings"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestProcessingConfig_Get(t *testing.T) {
@@ -33,3 +36,65 @@ func TestProcessingConfig_Get(t *testing.T) {
 		t.Fatalf("ProcessingConfig.Get: Document = %v, want %v", got, want)
 	}
 }
+
+func TestProcessingConfig_Decode(t *testing.T) {
+	config := &ProcessingConfig{}
+	config.WriteString(`<processingMCP>
+  <preconfiguredChoices>
+    <!-- Approve standard transfer -->
+    <preconfiguredChoice>
+      <appliesTo>
+        56eebd45-5600-4768-a8c2-ec0114555a3d
+      </appliesTo>
+      <goToChain>e9eaef1e-c2e0-4e3b-b942-bfb537162795</goToChain>
+    </preconfiguredChoice>
+    <preconfiguredChoice>
+      <appliesTo>bd899573-694e-4d33-8c9b-df0af802437d</appliesTo>
+      <goToChain>1b1a4565-30ab-4d7a-b9ac-b3a5ac6bd4e5</goToChain>
+      <delay unitCtime="yes">2</delay>
+    </preconfiguredChoice>
+  </preconfiguredChoices>
+</processingMCP>`)
+
+	doc, err := config.Decode()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []PreconfiguredChoice{
+		{
+			AppliesTo: "56eebd45-5600-4768-a8c2-ec0114555a3d",
+			GoToChain: "e9eaef1e-c2e0-4e3b-b942-bfb537162795",
+		},
+		{
+			AppliesTo: "bd899573-694e-4d33-8c9b-df0af802437d",
+			GoToChain: "1b1a4565-30ab-4d7a-b9ac-b3a5ac6bd4e5",
+			Delay:     &ProcessingDelay{UnitCtime: "yes", Value: "2"},
+		},
+	}, doc.Choices)
+
+	choice, ok := doc.Choice("bd899573-694e-4d33-8c9b-df0af802437d")
+	assert.True(t, ok)
+	assert.Equal(t, "1b1a4565-30ab-4d7a-b9ac-b3a5ac6bd4e5", choice.GoToChain)
+
+	_, err = ParseProcessingConfig(strings.NewReader("<processingMCP>"))
+	assert.Error(t, err)
+}
+
+func TestProcessingConfig_Diff(t *testing.T) {
+	got := &ProcessingMCP{Choices: []PreconfiguredChoice{
+		{AppliesTo: "a", GoToChain: "1"},
+		{AppliesTo: "b", GoToChain: "2"},
+		{AppliesTo: "c", GoToChain: "3"},
+	}}
+	want := &ProcessingMCP{Choices: []PreconfiguredChoice{
+		{AppliesTo: "d", GoToChain: "4"},
+		{AppliesTo: "b", GoToChain: "5"},
+		{AppliesTo: "a", GoToChain: "1", Delay: &ProcessingDelay{Value: "2"}},
+	}}
+
+	assert.Equal(t, []ProcessingConfigDifference{
+		{AppliesTo: "b", Want: "5", Got: "2"},
+		{AppliesTo: "c", Want: "", Got: "3"},
+		{AppliesTo: "d", Want: "4", Got: ""},
+	}, got.Diff(want))
+	assert.Empty(t, want.Diff(want))
+}
@@ -0,0 +1,285 @@
+package amclient
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v3"
+	"github.com/pkg/errors"
+)
+
+// RetryPolicy configures the retries of the requests that fail because the
+// API is not available, i.e. network errors, timeouts and responses with a
+// temporary error, see ErrorResponse.Temporary. Only idempotent requests are
+// retried, e.g. starting a transfer is never retried.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt. Retries
+	// are disabled when zero.
+	MaxRetries int
+
+	// InitialInterval is the wait before the first retry. It grows
+	// exponentially up to MaxInterval.
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+}
+
+func (p RetryPolicy) backOff(ctx context.Context) backoff.BackOff {
+	if p.MaxRetries <= 0 {
+		// WithMaxRetries would retry forever.
+		return &backoff.StopBackOff{}
+	}
+	b := backoff.NewExponentialBackOff()
+	if p.InitialInterval > 0 {
+		b.InitialInterval = p.InitialInterval
+	}
+	if p.MaxInterval > 0 {
+		b.MaxInterval = p.MaxInterval
+	}
+	b.MaxElapsedTime = 0
+	b.Reset()
+	return backoff.WithContext(backoff.WithMaxRetries(b, uint64(p.MaxRetries)), ctx)
+}
+
+// SetRetryPolicy is a client option for retrying the requests that fail
+// because the API is not available.
+func SetRetryPolicy(p RetryPolicy) ClientOpt {
+	return func(c *Client) error {
+		c.retry = p
+		return nil
+	}
+}
+
+// idempotent reports whether the request can be sent again safely.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	}
+	return false
+}
+
+// temporary reports whether the request failed because the API is not
+// available, which is also what the circuit breaker counts as a failure. That
+// is the case of the responses with a temporary error and of the timeouts and
+// the connection errors of the transport. Errors found once the response has
+// arrived, e.g. a body that cannot be decoded, and the errors that sending the
+// request again cannot fix, e.g. invalid certificates, are not temporary.
+func temporary(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	var errResp *ErrorResponse
+	if errors.As(err, &errResp) {
+		return errResp.Temporary()
+	}
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return false // Not returned by the transport.
+	}
+	if urlErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	switch {
+	case errors.As(err, &opErr):
+		return true // Connection refused, reset, name not resolved...
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return true // Connection closed by the server.
+	}
+	return false
+}
+
+// RateLimiter is a token bucket that limits the rate of the requests sent to
+// an API. It is safe for concurrent use and meant to be shared by all the
+// clients of the same API.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // Tokens added per second.
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a RateLimiter that allows rate requests per second
+// with bursts of up to burst requests.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a request is allowed or the context is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	for {
+		delay := l.reserve()
+		if delay == 0 {
+			return nil
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve takes a token from the bucket. It returns the time to wait until a
+// token is available when the bucket is empty.
+func (l *RateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// SetRateLimiter is a client option for limiting the rate of the requests.
+func SetRateLimiter(l *RateLimiter) ClientOpt {
+	return func(c *Client) error {
+		c.limiter = l
+		return nil
+	}
+}
+
+// BreakerState is the state of a CircuitBreaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets the requests through.
+	BreakerClosed BreakerState = iota
+
+	// BreakerHalfOpen lets a single request through to probe the API.
+	BreakerHalfOpen
+
+	// BreakerOpen rejects the requests with ErrCircuitOpen.
+	BreakerOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerHalfOpen:
+		return "half-open"
+	case BreakerOpen:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// ErrCircuitOpen is returned by Client.Do when the circuit breaker of the
+// client does not let the request through.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitBreaker stops sending requests to an API that keeps failing. It opens
+// after Threshold consecutive temporary failures, see RetryPolicy, and lets a
+// request through to probe the API once Cooldown has elapsed. It is safe for
+// concurrent use and meant to be shared by all the clients of the same API.
+type CircuitBreaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+	now      func() time.Time
+}
+
+// NewCircuitBreaker returns a closed CircuitBreaker.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		Threshold: threshold,
+		Cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// State returns the current state of the breaker.
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cool()
+	return b.state
+}
+
+// cool moves the breaker to half-open when the cooldown has elapsed.
+func (b *CircuitBreaker) cool() {
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.Cooldown {
+		b.state = BreakerHalfOpen
+		b.probing = false
+	}
+}
+
+// allow reports whether a request can be sent.
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cool()
+	switch b.state {
+	case BreakerOpen:
+		return ErrCircuitOpen
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record registers the outcome of a request let through.
+func (b *CircuitBreaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !failed {
+		b.state = BreakerClosed
+		b.failures = 0
+		b.probing = false
+		return
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.Threshold {
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+		b.probing = false
+	}
+}
+
+// abort releases the probe of a half-open breaker whose request was not
+// completed, e.g. because the context was canceled.
+func (b *CircuitBreaker) abort() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// SetCircuitBreaker is a client option for stopping the requests when the API
+// keeps failing.
+func SetCircuitBreaker(b *CircuitBreaker) ClientOpt {
+	return func(c *Client) error {
+		c.breaker = b
+		return nil
+	}
+}
@@ -0,0 +1,208 @@
+package amclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDo_retry(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		status   int
+		requests int32
+		wantErr  bool
+	}{
+		{"server error", "GET", http.StatusServiceUnavailable, 3, false},
+		{"server error, put", "PUT", http.StatusBadGateway, 3, false},
+		{"server error, not idempotent", "POST", http.StatusServiceUnavailable, 1, true},
+		{"throttled", "GET", http.StatusTooManyRequests, 3, false},
+		{"validation", "GET", http.StatusBadRequest, 1, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			setup()
+			defer teardown()
+
+			var requests int32
+			mux.HandleFunc("/api/foo/", func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&requests, 1) < 3 {
+					w.WriteHeader(tc.status)
+				}
+			})
+			SetRetryPolicy(RetryPolicy{MaxRetries: 5, InitialInterval: time.Millisecond})(client)
+
+			req, _ := client.NewRequestJSON(ctx, tc.method, "api/foo/", map[string]string{"foo": "bar"})
+			_, err := client.Do(ctx, req, nil)
+
+			assert.Equal(t, tc.wantErr, err != nil, err)
+			assert.Equal(t, tc.requests, atomic.LoadInt32(&requests))
+		})
+	}
+}
+
+func TestDo_retryExhausted(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var requests int32
+	mux.HandleFunc("/api/foo/", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	SetRetryPolicy(RetryPolicy{MaxRetries: 2, InitialInterval: time.Millisecond})(client)
+
+	req, _ := client.NewRequest(ctx, "GET", "api/foo/", nil)
+	_, err := client.Do(ctx, req, nil)
+
+	var errResp *ErrorResponse
+	assert.True(t, errors.As(err, &errResp))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+}
+
+func TestDo_circuitBreaker(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var requests int32
+	mux.HandleFunc("/api/foo/", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	breaker := NewCircuitBreaker(2, time.Hour)
+	SetCircuitBreaker(breaker)(client)
+
+	for i := 0; i < 3; i++ {
+		req, _ := client.NewRequest(ctx, "GET", "api/foo/", nil)
+		_, err := client.Do(ctx, req, nil)
+		assert.Error(t, err)
+	}
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	assert.Equal(t, BreakerOpen, breaker.State())
+	req, _ := client.NewRequest(ctx, "GET", "api/foo/", nil)
+	_, err := client.Do(ctx, req, nil)
+	assert.Equal(t, ErrCircuitOpen, err)
+}
+
+func TestDo_notTemporary(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// A proxy answering with a page instead of the API.
+	var requests int32
+	mux.HandleFunc("/api/foo/", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte("<html>Maintenance</html>"))
+	})
+	breaker := NewCircuitBreaker(1, time.Hour)
+	SetCircuitBreaker(breaker)(client)
+	SetRetryPolicy(RetryPolicy{MaxRetries: 5, InitialInterval: time.Millisecond})(client)
+
+	req, _ := client.NewRequest(ctx, "GET", "api/foo/", nil)
+	_, err := client.Do(ctx, req, &struct{}{})
+
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests), "decode errors are not retried")
+	assert.Equal(t, BreakerClosed, breaker.State(), "decode errors are not breaker failures")
+}
+
+func TestTemporary(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer slow.Close()
+	hangUp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer hangUp.Close()
+	untrusted := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer untrusted.Close()
+
+	get := func(c *http.Client, URL string) error {
+		resp, err := c.Get(URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want bool
+	}{
+		{"timeout", ctx, get(&http.Client{Timeout: 10 * time.Millisecond}, slow.URL), true},
+		{"connection refused", ctx, get(http.DefaultClient, "http://127.0.0.1:1"), true},
+		{"connection closed", ctx, get(http.DefaultClient, hangUp.URL), true},
+		{"server error", ctx, &ErrorResponse{Response: &http.Response{StatusCode: http.StatusBadGateway}, Kind: ErrorKindServer}, true},
+		{"validation error", ctx, &ErrorResponse{Response: &http.Response{StatusCode: http.StatusBadRequest}, Kind: ErrorKindValidation}, false},
+		{"untrusted certificate", ctx, get(http.DefaultClient, untrusted.URL), false},
+		{"malformed URL", ctx, get(http.DefaultClient, "foo://example.com"), false},
+		{"decode error", ctx, json.Unmarshal([]byte("<html>"), &struct{}{}), false},
+		{"circuit open", ctx, errors.Wrap(ErrCircuitOpen, "request failed"), false},
+		{"canceled", canceled, get(http.DefaultClient, "http://127.0.0.1:1"), false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Error(t, tc.err)
+			assert.Equal(t, tc.want, temporary(tc.ctx, tc.err), "%#v", tc.err)
+		})
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := NewCircuitBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	require.NoError(t, b.allow())
+	b.record(true)
+	assert.Equal(t, BreakerClosed, b.State())
+	require.NoError(t, b.allow())
+	b.record(true)
+	assert.Equal(t, BreakerOpen, b.State())
+	assert.Equal(t, ErrCircuitOpen, b.allow())
+
+	// A single probe is let through after the cooldown.
+	now = now.Add(time.Minute)
+	assert.Equal(t, BreakerHalfOpen, b.State())
+	require.NoError(t, b.allow())
+	assert.Equal(t, ErrCircuitOpen, b.allow())
+	b.record(true)
+	assert.Equal(t, BreakerOpen, b.State())
+
+	now = now.Add(time.Minute)
+	require.NoError(t, b.allow())
+	b.abort()
+	require.NoError(t, b.allow())
+	b.record(false)
+	assert.Equal(t, BreakerClosed, b.State())
+	assert.Equal(t, "closed", b.State().String())
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := NewRateLimiter(20, 2)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, l.Wait(context.Background()))
+	}
+	assert.True(t, time.Since(start) >= time.Millisecond*40, "third request was not delayed")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, l.Wait(ctx))
+}
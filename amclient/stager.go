@@ -0,0 +1,71 @@
+package amclient
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// Stager uploads the contents of transfers to a transfer source location of
+// the Storage Service, e.g. backed by an S3 bucket, so Archivematica can read
+// them without sharing a filesystem with the client.
+type Stager interface {
+	// Location returns the UUID of the transfer source location.
+	Location() string
+
+	// Stage uploads a file given its path relative to the location.
+	Stage(ctx context.Context, name string, r io.Reader) error
+}
+
+// WithStager makes the transfer session upload the contents of the transfer to
+// the location of the stager when the transfer is started. The transfer is
+// then referenced as `<location-uuid>:<path>` and the local copy is removed.
+func (s *TransferSession) WithStager(stager Stager) *TransferSession {
+	s.stager = stager
+	return s
+}
+
+// stage uploads the transfer with the stager, i.e. the zipped bag or every file
+// of the transfer directory, and returns the path used to reference it.
+func (s *TransferSession) stage(ctx context.Context, name string) (string, error) {
+	if s.transferType == TransferTypeZippedBag {
+		f, err := os.Open(s.fullPath() + ".zip")
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		if err := s.stager.Stage(ctx, name, f); err != nil {
+			return "", errors.Wrapf(err, "cannot stage %s", name)
+		}
+	} else {
+		err := s.fs.Walk("/", func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			f, err := s.fs.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			key := path.Join(name, filepath.ToSlash(p))
+			if err := s.stager.Stage(ctx, key, f); err != nil {
+				return errors.Wrapf(err, "cannot stage %s", key)
+			}
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	if err := s.Destroy(); err != nil {
+		return "", errors.Wrap(err, "cannot remove staged transfer")
+	}
+	return s.stager.Location() + ":" + name, nil
+}
@@ -0,0 +1,98 @@
+package amclient
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stagerMock struct {
+	objects map[string]string
+	err     error
+}
+
+func (m *stagerMock) Location() string {
+	return "0aa9a6a4-77d7-4d12-b20e-1f2b3c4d5e6f"
+}
+
+func (m *stagerMock) Stage(ctx context.Context, name string, r io.Reader) error {
+	if m.err != nil {
+		return m.err
+	}
+	blob, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	m.objects[name] = string(blob)
+	return nil
+}
+
+func (m *stagerMock) names() []string {
+	names := []string{}
+	for name := range m.objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestTransferSession_Start_staged(t *testing.T) {
+	stager := &stagerMock{objects: map[string]string{}}
+	ts := newTransferSession(t, "Test").WithStager(stager)
+	f, _ := ts.Create("bird.mp3")
+	f.Write([]byte("bird"))
+	f.Close()
+	ts.Describe("dc.title", "Birds")
+	name := ts.path()
+
+	_, err := ts.Start(ctx)
+	require.NoError(t, err)
+
+	req := ts.c.Package.(*packageServiceMock).createReq
+	assert.Equal(t, stager.Location()+":"+name, req.Path)
+	assert.Equal(t, []string{
+		name + "/bird.mp3",
+		name + "/metadata/metadata.csv",
+	}, stager.names())
+	assert.Equal(t, "bird", stager.objects[name+"/bird.mp3"])
+	_, err = os.Stat(ts.fullPath())
+	assert.True(t, os.IsNotExist(err), "transfer directory not removed")
+}
+
+func TestTransferSession_Start_stagedZippedBag(t *testing.T) {
+	stager := &stagerMock{objects: map[string]string{}}
+	ts := newTransferSession(t, "Test").WithTransferType(TransferTypeZippedBag).WithStager(stager)
+	f, _ := ts.Create("bird.mp3")
+	f.Write([]byte("bird"))
+	f.Close()
+	name := ts.path() + ".zip"
+
+	_, err := ts.Start(ctx)
+	require.NoError(t, err)
+
+	req := ts.c.Package.(*packageServiceMock).createReq
+	assert.Equal(t, stager.Location()+":"+name, req.Path)
+	assert.Equal(t, []string{name}, stager.names())
+	_, err = os.Stat(ts.fullPath() + ".zip")
+	assert.True(t, os.IsNotExist(err), "zipped bag not removed")
+}
+
+func TestTransferSession_Start_stagingError(t *testing.T) {
+	stager := &stagerMock{err: errors.New("bucket not found")}
+	ts := newTransferSession(t, "Test").WithStager(stager)
+	defer ts.Destroy()
+	f, _ := ts.Create("bird.mp3")
+	f.Close()
+
+	_, err := ts.Start(ctx)
+
+	assert.EqualError(t, err, "cannot stage transfer: cannot stage "+ts.path()+"/bird.mp3: bucket not found")
+	assert.Nil(t, ts.c.Package.(*packageServiceMock).createReq)
+}
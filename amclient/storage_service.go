@@ -0,0 +1,123 @@
+package amclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gorilla/schema"
+)
+
+// StorageServiceClient manages communication with the Archivematica Storage
+// Service API. It has its own base URL and credentials but it follows the
+// same conventions of Client, e.g. requests are sent with Do.
+type StorageServiceClient struct {
+	// api builds and sends the requests. Its Dashboard API services are not
+	// meant to be used.
+	api *Client
+
+	// Services used for communicating with the API
+	Package StoragePackageService
+}
+
+// NewStorageServiceClient returns a new Archivematica Storage Service API
+// client. Options that alter how the requests are sent, e.g. SetRetryPolicy,
+// are supported. Options that fail are ignored.
+func NewStorageServiceClient(httpClient *http.Client, bu, u, k string, opts ...ClientOpt) *StorageServiceClient {
+	api := NewClient(httpClient, bu, u, k)
+	for _, opt := range opts {
+		_ = opt(api)
+	}
+	c := &StorageServiceClient{
+		api: api,
+	}
+	c.Package = &StoragePackageServiceOp{client: c}
+	return c
+}
+
+// SetStorageService is a client option for setting the Storage Service client
+// used by the pipeline.
+func SetStorageService(ss *StorageServiceClient) ClientOpt {
+	return func(c *Client) error {
+		c.StorageService = ss
+		return nil
+	}
+}
+
+// BaseURL returns the base URL of the API requests.
+func (c *StorageServiceClient) BaseURL() *url.URL {
+	return c.api.BaseURL
+}
+
+// NewRequestJSON creates an API request. See Client.NewRequestJSON for more.
+func (c *StorageServiceClient) NewRequestJSON(ctx context.Context, method, urlStr string, body interface{}, opts ...RequestOpt) (*http.Request, error) {
+	return c.api.NewRequestJSON(ctx, method, urlStr, body, opts...)
+}
+
+// Do sends an API request and returns the API response. See Client.Do for
+// more.
+func (c *StorageServiceClient) Do(ctx context.Context, req *http.Request, v interface{}) (*Response, error) {
+	return c.api.Do(ctx, req, v)
+}
+
+// Ping checks that the Storage Service API is reachable and that the
+// credentials are accepted by listing a single package.
+func (c *StorageServiceClient) Ping(ctx context.Context) error {
+	_, _, err := c.Package.List(ctx, &StoragePackageListRequest{Limit: 1})
+	return err
+}
+
+// addQuery adds the parameters in opts as URL query parameters to urlStr. opts
+// must be a struct whose fields may contain "schema" tags.
+func addQuery(urlStr string, opts interface{}) (string, error) {
+	if v := reflect.ValueOf(opts); !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		return urlStr, nil
+	}
+	query := url.Values{}
+	if err := schema.NewEncoder().Encode(opts, query); err != nil {
+		return urlStr, err
+	}
+	if len(query) == 0 {
+		return urlStr, nil
+	}
+	return urlStr + "?" + query.Encode(), nil
+}
+
+// StorageListMeta describes a page of results of a list endpoint.
+type StorageListMeta struct {
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset"`
+	TotalCount int    `json:"total_count"`
+	Next       string `json:"next"`
+	Previous   string `json:"previous"`
+}
+
+// StorageDateTime is a date found in the Storage Service API responses, which
+// may omit the time zone, in which case UTC is assumed.
+type StorageDateTime struct {
+	time.Time
+}
+
+var storageDateTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+}
+
+func (t *StorageDateTime) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" || s == "" {
+		return nil
+	}
+	var err error
+	for _, layout := range storageDateTimeLayouts {
+		var td time.Time
+		if td, err = time.Parse(layout, s); err == nil {
+			t.Time = td
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,268 @@
+package amclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+const storagePackageBasePath = "api/v2/file"
+
+// Package types used by the Storage Service.
+const (
+	StoragePackageTypeAIP      = "AIP"
+	StoragePackageTypeAIC      = "AIC"
+	StoragePackageTypeDIP      = "DIP"
+	StoragePackageTypeTransfer = "transfer"
+)
+
+// Reingest types accepted by StoragePackageService.Reingest.
+const (
+	ReingestTypeMetadataOnly = "METADATA_ONLY"
+	ReingestTypeObjects      = "OBJECTS"
+	ReingestTypeFull         = "FULL"
+)
+
+// StoragePackageService is an interface for interfacing with the package
+// (file) endpoints of the Storage Service API.
+type StoragePackageService interface {
+	List(context.Context, *StoragePackageListRequest) (*StoragePackageListResponse, *Response, error)
+	Get(context.Context, string) (*StoragePackage, *Response, error)
+	Contents(context.Context, string) (*StoragePackageContentsResponse, *Response, error)
+	Delete(context.Context, string, *StoragePackageDeleteRequest) (*StoragePackageDeleteResponse, *Response, error)
+	Reingest(context.Context, string, *StoragePackageReingestRequest) (*StoragePackageReingestResponse, *Response, error)
+	CheckFixity(context.Context, string, *StoragePackageCheckFixityRequest) (*StoragePackageCheckFixityResponse, *Response, error)
+	Download(context.Context, string, io.Writer) (*Response, error)
+}
+
+// StoragePackageServiceOp handles communication with the package related
+// methods of the Storage Service API.
+type StoragePackageServiceOp struct {
+	client *StorageServiceClient
+}
+
+var _ StoragePackageService = &StoragePackageServiceOp{}
+
+// StoragePackage represents a package stored in the Storage Service.
+type StoragePackage struct {
+	ID              string          `json:"uuid"`
+	CurrentFullPath string          `json:"current_full_path"`
+	CurrentLocation string          `json:"current_location"`
+	CurrentPath     string          `json:"current_path"`
+	OriginPipeline  string          `json:"origin_pipeline"`
+	PackageType     string          `json:"package_type"`
+	RelatedPackages []string        `json:"related_packages"`
+	Replicas        []string        `json:"replicas"`
+	ResourceURI     string          `json:"resource_uri"`
+	Size            int64           `json:"size"`
+	Status          string          `json:"status"`
+	StoredDate      StorageDateTime `json:"stored_date"`
+}
+
+// StoragePackageListRequest represents a request to list packages.
+type StoragePackageListRequest struct {
+	PackageType string `schema:"package_type,omitempty"`
+	Status      string `schema:"status,omitempty"`
+	Limit       int    `schema:"limit,omitempty"`
+	Offset      int    `schema:"offset,omitempty"`
+}
+
+// StoragePackageListResponse represents a response to
+// StoragePackageListRequest.
+type StoragePackageListResponse struct {
+	Meta    StorageListMeta  `json:"meta"`
+	Objects []StoragePackage `json:"objects"`
+}
+
+// List lists the packages, one page at a time.
+func (s *StoragePackageServiceOp) List(ctx context.Context, r *StoragePackageListRequest) (*StoragePackageListResponse, *Response, error) {
+	path, err := addQuery(fmt.Sprintf("%s/", storagePackageBasePath), r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := s.client.NewRequestJSON(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payload := &StoragePackageListResponse{}
+	resp, err := s.client.Do(ctx, req, payload)
+
+	return payload, resp, err
+}
+
+// Get obtains the details of a package given its identifier.
+func (s *StoragePackageServiceOp) Get(ctx context.Context, ID string) (*StoragePackage, *Response, error) {
+	path := fmt.Sprintf("%s/%s/", storagePackageBasePath, ID)
+
+	req, err := s.client.NewRequestJSON(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payload := &StoragePackage{}
+	resp, err := s.client.Do(ctx, req, payload)
+
+	return payload, resp, err
+}
+
+// StoragePackageContentsResponse represents the list of files of a package.
+type StoragePackageContentsResponse struct {
+	Success bool                 `json:"success"`
+	Package string               `json:"package"`
+	Files   []StoragePackageFile `json:"files"`
+}
+
+// StoragePackageFile represents a file of a package.
+type StoragePackageFile struct {
+	ID           string `json:"fileuuid"`
+	RelativePath string `json:"relative_path"`
+	AccessionID  string `json:"accessionid"`
+	SIPID        string `json:"sipuuid"`
+	Origin       string `json:"origin"`
+}
+
+// Contents lists the files of a package.
+func (s *StoragePackageServiceOp) Contents(ctx context.Context, ID string) (*StoragePackageContentsResponse, *Response, error) {
+	path := fmt.Sprintf("%s/%s/contents/", storagePackageBasePath, ID)
+
+	req, err := s.client.NewRequestJSON(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payload := &StoragePackageContentsResponse{}
+	resp, err := s.client.Do(ctx, req, payload)
+
+	return payload, resp, err
+}
+
+// StoragePackageDeleteRequest represents a request to delete a package. The
+// request needs to be approved by an administrator of the Storage Service.
+type StoragePackageDeleteRequest struct {
+	EventReason string `json:"event_reason"`
+	Pipeline    string `json:"pipeline"`
+	UserID      int    `json:"user_id"`
+	UserEmail   string `json:"user_email"`
+}
+
+// StoragePackageDeleteResponse represents a response to
+// StoragePackageDeleteRequest.
+type StoragePackageDeleteResponse struct {
+	Message string `json:"message"`
+	ID      int    `json:"id"`
+}
+
+// Delete creates a request to delete a package.
+func (s *StoragePackageServiceOp) Delete(ctx context.Context, ID string, r *StoragePackageDeleteRequest) (*StoragePackageDeleteResponse, *Response, error) {
+	path := fmt.Sprintf("%s/%s/delete_aip/", storagePackageBasePath, ID)
+
+	req, err := s.client.NewRequestJSON(ctx, "POST", path, r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payload := &StoragePackageDeleteResponse{}
+	resp, err := s.client.Do(ctx, req, payload)
+
+	return payload, resp, err
+}
+
+// StoragePackageReingestRequest represents a request to reingest a package in
+// a pipeline.
+type StoragePackageReingestRequest struct {
+	Pipeline         string `json:"pipeline"`
+	ReingestType     string `json:"reingest_type"`
+	ProcessingConfig string `json:"processing_config,omitempty"`
+}
+
+// StoragePackageReingestResponse represents a response to
+// StoragePackageReingestRequest.
+type StoragePackageReingestResponse struct {
+	Error      bool   `json:"error"`
+	Message    string `json:"message"`
+	ReingestID string `json:"reingest_uuid"`
+}
+
+// Reingest starts the reingest of a package in a pipeline. The reingest is
+// metadata-only unless the request says otherwise, the request is not
+// modified.
+func (s *StoragePackageServiceOp) Reingest(ctx context.Context, ID string, r *StoragePackageReingestRequest) (*StoragePackageReingestResponse, *Response, error) {
+	path := fmt.Sprintf("%s/%s/reingest/", storagePackageBasePath, ID)
+
+	body := StoragePackageReingestRequest{}
+	if r != nil {
+		body = *r
+	}
+	if body.ReingestType == "" {
+		body.ReingestType = ReingestTypeMetadataOnly
+	}
+
+	req, err := s.client.NewRequestJSON(ctx, "POST", path, &body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payload := &StoragePackageReingestResponse{}
+	resp, err := s.client.Do(ctx, req, payload)
+
+	return payload, resp, err
+}
+
+// StoragePackageCheckFixityRequest represents a request to check the fixity of
+// a package.
+type StoragePackageCheckFixityRequest struct {
+	// ForceLocal checks the fixity in the Storage Service even if the space
+	// of the package supports remote fixity checks.
+	ForceLocal bool `schema:"force_local,omitempty"`
+}
+
+// StoragePackageCheckFixityResponse represents a response to
+// StoragePackageCheckFixityRequest.
+type StoragePackageCheckFixityResponse struct {
+	Success   bool                  `json:"success"`
+	Message   string                `json:"message"`
+	Failures  StorageFixityFailures `json:"failures"`
+	Timestamp StorageDateTime       `json:"timestamp"`
+}
+
+// StorageFixityFailures lists the files that failed a fixity check.
+type StorageFixityFailures struct {
+	Files struct {
+		Missing   []string `json:"missing"`
+		Changed   []string `json:"changed"`
+		Untracked []string `json:"untracked"`
+	} `json:"files"`
+}
+
+// CheckFixity checks the fixity of a package. The response reports whether
+// the check succeeded, i.e. a failed check is not reported as an error.
+func (s *StoragePackageServiceOp) CheckFixity(ctx context.Context, ID string, r *StoragePackageCheckFixityRequest) (*StoragePackageCheckFixityResponse, *Response, error) {
+	path, err := addQuery(fmt.Sprintf("%s/%s/check_fixity/", storagePackageBasePath, ID), r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := s.client.NewRequestJSON(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payload := &StoragePackageCheckFixityResponse{}
+	resp, err := s.client.Do(ctx, req, payload)
+
+	return payload, resp, err
+}
+
+// Download writes the contents of a package into w.
+func (s *StoragePackageServiceOp) Download(ctx context.Context, ID string, w io.Writer) (*Response, error) {
+	path := fmt.Sprintf("%s/%s/download/", storagePackageBasePath, ID)
+
+	req, err := s.client.NewRequestJSON(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.client.Do(ctx, req, w)
+}
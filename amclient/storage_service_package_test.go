@@ -0,0 +1,269 @@
+package amclient
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoragePackage_List(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/v2/file/", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		assert.Equal(t, "limit=1&package_type=AIP", r.URL.RawQuery)
+		fmt.Fprint(w, `{
+	"meta": {"limit": 1, "next": "/api/v2/file/?limit=1&offset=1&package_type=AIP", "offset": 0, "previous": null, "total_count": 2},
+	"objects": [
+		{
+			"uuid": "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0",
+			"current_full_path": "/var/archivematica/sharedDirectory/www/AIPsStore/2a4e/c2be/c4f4/4a4e/bb46/e69c/d3d6/e0c0/bird-2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0.7z",
+			"current_location": "/api/v2/location/3e0ea6e0-4702-49c3-9ba3-5ed9e1b8bd5b/",
+			"current_path": "2a4e/c2be/c4f4/4a4e/bb46/e69c/d3d6/e0c0/bird-2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0.7z",
+			"origin_pipeline": "/api/v2/pipeline/0b4ad4d0-c2a5-4b52-a1d4-6b4b8ef7e4a2/",
+			"package_type": "AIP",
+			"related_packages": [],
+			"replicas": [],
+			"resource_uri": "/api/v2/file/2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0/",
+			"size": 1024,
+			"status": "UPLOADED",
+			"stored_date": "2019-11-21T15:27:50.123456"
+		}
+	]
+}`)
+	})
+
+	payload, _, err := ssClient.Package.List(ctx, &StoragePackageListRequest{
+		PackageType: StoragePackageTypeAIP,
+		Limit:       1,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, StorageListMeta{
+		Limit:      1,
+		TotalCount: 2,
+		Next:       "/api/v2/file/?limit=1&offset=1&package_type=AIP",
+	}, payload.Meta)
+	assert.Len(t, payload.Objects, 1)
+	assert.Equal(t, "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0", payload.Objects[0].ID)
+	assert.Equal(t, int64(1024), payload.Objects[0].Size)
+	assert.Equal(t, "UPLOADED", payload.Objects[0].Status)
+	assert.Equal(t, time.Date(2019, time.November, 21, 15, 27, 50, 123456000, time.UTC), payload.Objects[0].StoredDate.Time)
+}
+
+func TestStoragePackage_Get(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/v2/file/2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0/", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprint(w, `{
+	"uuid": "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0",
+	"package_type": "AIP",
+	"status": "UPLOADED",
+	"stored_date": "2019-11-21T15:27:50+01:00"
+}`)
+	})
+
+	payload, _, err := ssClient.Package.Get(ctx, "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0", payload.ID)
+	assert.Equal(t, StoragePackageTypeAIP, payload.PackageType)
+	assert.True(t, payload.StoredDate.Equal(time.Date(2019, time.November, 21, 14, 27, 50, 0, time.UTC)))
+}
+
+func TestStoragePackage_Get_notFound(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/v2/file/2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	_, resp, err := ssClient.Package.Get(ctx, "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0")
+
+	assert.Error(t, err)
+	assert.IsType(t, &ErrorResponse{}, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestStoragePackage_Contents(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/v2/file/2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0/contents/", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprint(w, `{
+	"success": true,
+	"package": "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0",
+	"files": [
+		{
+			"relative_path": "bird-2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0/data/objects/woodpigeon.jpg",
+			"fileuuid": "7f1b6c5a-1c11-4b8d-9c62-2f4c2a1b8b1e",
+			"accessionid": "",
+			"sipuuid": "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0",
+			"origin": "0b4ad4d0-c2a5-4b52-a1d4-6b4b8ef7e4a2"
+		}
+	]
+}`)
+	})
+
+	payload, _, err := ssClient.Package.Contents(ctx, "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0")
+
+	assert.NoError(t, err)
+	assert.Equal(t, &StoragePackageContentsResponse{
+		Success: true,
+		Package: "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0",
+		Files: []StoragePackageFile{
+			{
+				ID:           "7f1b6c5a-1c11-4b8d-9c62-2f4c2a1b8b1e",
+				RelativePath: "bird-2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0/data/objects/woodpigeon.jpg",
+				SIPID:        "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0",
+				Origin:       "0b4ad4d0-c2a5-4b52-a1d4-6b4b8ef7e4a2",
+			},
+		},
+	}, payload)
+}
+
+func TestStoragePackage_Delete(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/v2/file/2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0/delete_aip/", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+
+		blob, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Body.Close()
+
+		assert.Equal(t,
+			`{"event_reason":"Deaccessioned","pipeline":"0b4ad4d0-c2a5-4b52-a1d4-6b4b8ef7e4a2","user_id":1,"user_email":"admin@example.com"}`,
+			string(bytes.TrimSpace(blob)))
+
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, `{"message": "Delete request created successfully.", "id": 12}`)
+	})
+
+	payload, _, err := ssClient.Package.Delete(ctx, "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0", &StoragePackageDeleteRequest{
+		EventReason: "Deaccessioned",
+		Pipeline:    "0b4ad4d0-c2a5-4b52-a1d4-6b4b8ef7e4a2",
+		UserID:      1,
+		UserEmail:   "admin@example.com",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, &StoragePackageDeleteResponse{
+		Message: "Delete request created successfully.",
+		ID:      12,
+	}, payload)
+}
+
+func TestStoragePackage_Reingest(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/v2/file/2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0/reingest/", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+
+		blob, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Body.Close()
+
+		assert.Equal(t,
+			`{"pipeline":"0b4ad4d0-c2a5-4b52-a1d4-6b4b8ef7e4a2","reingest_type":"METADATA_ONLY"}`,
+			string(bytes.TrimSpace(blob)))
+
+		fmt.Fprint(w, `{
+	"error": false,
+	"message": "Package 2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0 sent to pipeline Archivematica on am (0b4ad4d0-c2a5-4b52-a1d4-6b4b8ef7e4a2) for re-ingest",
+	"reingest_uuid": "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0"
+}`)
+	})
+
+	r := &StoragePackageReingestRequest{
+		Pipeline: "0b4ad4d0-c2a5-4b52-a1d4-6b4b8ef7e4a2",
+	}
+	payload, _, err := ssClient.Package.Reingest(ctx, "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0", r)
+
+	assert.NoError(t, err)
+	assert.False(t, payload.Error)
+	assert.Equal(t, "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0", payload.ReingestID)
+	assert.Empty(t, r.ReingestType, "the request is not modified")
+}
+
+func TestStoragePackage_Reingest_nilRequest(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/v2/file/2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0/reingest/", func(w http.ResponseWriter, r *http.Request) {
+		blob, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, `{"pipeline":"","reingest_type":"METADATA_ONLY"}`, string(bytes.TrimSpace(blob)))
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error": true, "message": "Pipeline is required"}`)
+	})
+
+	_, _, err := ssClient.Package.Reingest(ctx, "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0", nil)
+
+	assert.Error(t, err)
+}
+
+func TestStoragePackage_CheckFixity(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/v2/file/2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0/check_fixity/", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		assert.Equal(t, "force_local=true", r.URL.RawQuery)
+		fmt.Fprint(w, `{
+	"success": false,
+	"message": "Invalid bag",
+	"failures": {
+		"files": {
+			"missing": ["data/objects/woodpigeon.jpg"],
+			"changed": ["data/objects/bird-sounds.mp3"],
+			"untracked": []
+		}
+	},
+	"timestamp": null
+}`)
+	})
+
+	payload, _, err := ssClient.Package.CheckFixity(ctx, "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0", &StoragePackageCheckFixityRequest{
+		ForceLocal: true,
+	})
+
+	assert.NoError(t, err)
+	assert.False(t, payload.Success)
+	assert.Equal(t, "Invalid bag", payload.Message)
+	assert.Equal(t, []string{"data/objects/woodpigeon.jpg"}, payload.Failures.Files.Missing)
+	assert.Equal(t, []string{"data/objects/bird-sounds.mp3"}, payload.Failures.Files.Changed)
+	assert.Empty(t, payload.Failures.Files.Untracked)
+	assert.True(t, payload.Timestamp.IsZero())
+}
+
+func TestStoragePackage_Download(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/v2/file/2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0/download/", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprint(w, "7z contents")
+	})
+
+	buf := &bytes.Buffer{}
+	_, err := ssClient.Package.Download(ctx, "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0", buf)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "7z contents", buf.String())
+}
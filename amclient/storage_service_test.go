@@ -0,0 +1,64 @@
+package amclient
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStorageServiceClient(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/v2/file/2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0/", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "ApiKey ssuser:sskey", r.Header.Get("Authorization"))
+		assert.Equal(t, userAgent, r.Header.Get("User-Agent"))
+		w.WriteHeader(http.StatusOK)
+	})
+
+	ss := NewStorageServiceClient(nil, server.URL, "ssuser", "sskey")
+	c, err := New(nil, "http://dashboard.example.com", "user", "key", SetStorageService(ss))
+	assert.NoError(t, err)
+	assert.Equal(t, ss, c.StorageService)
+	assert.Equal(t, server.URL, c.StorageService.BaseURL().String())
+
+	_, err = c.StorageService.Package.Download(ctx, "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0", nil)
+	assert.NoError(t, err)
+}
+
+func TestStorageServiceClient_Ping(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/v2/file/", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "1", r.URL.Query().Get("limit"))
+		if r.Header.Get("Authorization") != "ApiKey ssuser:sskey" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"meta": {"total_count": 0}, "objects": []}`)
+	})
+
+	assert.NoError(t, NewStorageServiceClient(nil, server.URL, "ssuser", "sskey").Ping(ctx))
+	assert.Error(t, NewStorageServiceClient(nil, server.URL, "ssuser", "wrong").Ping(ctx))
+}
+
+func TestAddQuery(t *testing.T) {
+	path, err := addQuery("api/v2/file/", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "api/v2/file/", path)
+
+	path, err = addQuery("api/v2/file/", (*StoragePackageListRequest)(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "api/v2/file/", path)
+
+	path, err = addQuery("api/v2/file/", &StoragePackageListRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "api/v2/file/", path)
+
+	path, err = addQuery("api/v2/file/", &StoragePackageListRequest{Status: "UPLOADED", Offset: 20})
+	assert.NoError(t, err)
+	assert.Equal(t, "api/v2/file/?offset=20&status=UPLOADED", path)
+}
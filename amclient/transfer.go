@@ -17,6 +17,8 @@ type TransferService interface {
 	Approve(context.Context, *TransferApproveRequest) (*TransferApproveResponse, *Response, error)
 	Unapproved(context.Context, *TransferUnapprovedRequest) (*TransferUnapprovedResponse, *Response, error)
 	Status(context.Context, string) (*TransferStatusResponse, *Response, error)
+	Hide(context.Context, string) (*HideResponse, *Response, error)
+	Completed(context.Context) (*CompletedResponse, *Response, error)
 }
 
 // TransferServiceOp handles communication with the Tranfer related methods of
@@ -32,6 +34,13 @@ type TransferStartRequest struct {
 	Name  string   `schema:"name"`
 	Type  string   `schema:"type"`
 	Paths []string `schema:"paths"`
+
+	Accession      string `schema:"accession,omitempty"`
+	AccessSystemID string `schema:"access_system_id,omitempty"`
+
+	// MetadataSetIDs are the identifiers of the transfer metadata sets
+	// created before the transfer is started, one per path.
+	MetadataSetIDs []string `schema:"row_ids,omitempty"`
 }
 
 // TransferStartResponse represents a response to TransferStartRequest.
@@ -163,3 +172,48 @@ func (s *TransferServiceOp) Status(ctx context.Context, ID string) (*TransferSta
 
 	return payload, resp, err
 }
+
+// HideResponse represents a response to TransferService.Hide and
+// IngestService.Hide.
+type HideResponse struct {
+	Removed bool `json:"removed"`
+}
+
+// Hide removes a completed transfer from the Dashboard. Its files are not
+// deleted.
+func (s *TransferServiceOp) Hide(ctx context.Context, ID string) (*HideResponse, *Response, error) {
+	path := fmt.Sprintf("%s/%s/delete/", transferBasePath, ID)
+
+	req, err := s.client.NewRequest(ctx, "DELETE", path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payload := &HideResponse{}
+	resp, err := s.client.Do(ctx, req, payload)
+
+	return payload, resp, err
+}
+
+// CompletedResponse represents a response to TransferService.Completed and
+// IngestService.Completed.
+type CompletedResponse struct {
+	Message string   `json:"message"`
+	Results []string `json:"results"`
+}
+
+// Completed lists the identifiers of the completed transfers that are not
+// hidden.
+func (s *TransferServiceOp) Completed(ctx context.Context) (*CompletedResponse, *Response, error) {
+	path := fmt.Sprintf("%s/completed/", transferBasePath)
+
+	req, err := s.client.NewRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payload := &CompletedResponse{}
+	resp, err := s.client.Do(ctx, req, payload)
+
+	return payload, resp, err
+}
@@ -6,8 +6,12 @@ import (
 	"encoding/csv"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/afero"
@@ -15,6 +19,10 @@ import (
 
 const defaultProcessingConfig = "default"
 
+// transferSessionPrefix is the prefix of the names of the directories created
+// for the transfer sessions.
+const transferSessionPrefix = "amclientTransfer"
+
 // TransferSession is a convenience tool to make it easier to create and submit
 // transfers.
 //
@@ -34,10 +42,20 @@ type TransferSession struct {
 
 	processingConfig string
 
+	// Type of the transfer, see the TransferType constants.
+	transferType string
+
+	// Stager of the transfer contents, nil when the transfer directory is
+	// shared with Archivematica.
+	stager Stager
+
 	Metadata        *MetadataSet
 	ChecksumsMD5    *ChecksumSet
 	ChecksumsSHA1   *ChecksumSet
 	ChecksumsSHA256 *ChecksumSet
+	Filenames       *FilenameSet
+	Rights          *RightsSet
+	BagInfo         *BagInfo
 }
 
 // tmpfs creates a new temporary directory on the given filesystem and returns
@@ -62,8 +80,7 @@ func tmpfs(fs afero.Fs) (*afero.Afero, error) {
 		return nil, fmt.Errorf("filesystem is not accesible (%s)", basePath)
 	}
 
-	const prefix = "amclientTransfer"
-	tmpdir, err := afero.TempDir(fs, "/", prefix)
+	tmpdir, err := afero.TempDir(fs, "/", transferSessionPrefix)
 	if err != nil {
 		return nil, errors.Wrap(err, "error creating temporary directory")
 	}
@@ -85,11 +102,15 @@ func NewTransferSession(c *Client, name string) (*TransferSession, error) {
 		fs:               fs,
 		name:             name,
 		processingConfig: defaultProcessingConfig,
+		transferType:     TransferTypeStandard,
 	}
 	ts.Metadata = NewMetadataSet(ts.fs)
 	ts.ChecksumsMD5 = NewChecksumSet("md5", ts.fs)
 	ts.ChecksumsSHA1 = NewChecksumSet("sha1", ts.fs)
 	ts.ChecksumsSHA256 = NewChecksumSet("sha256", ts.fs)
+	ts.Filenames = NewFilenameSet(ts.fs)
+	ts.Rights = NewRightsSet(ts.fs)
+	ts.BagInfo = &BagInfo{}
 	return ts, nil
 }
 
@@ -98,6 +119,14 @@ func (s *TransferSession) WithProcessingConfig(name string) *TransferSession {
 	return s
 }
 
+// WithTransferType sets the type of the transfer. When it is a bag, the
+// contents of the transfer are packaged as a BagIt bag when the transfer is
+// started, see TransferSession.Start.
+func (s *TransferSession) WithTransferType(transferType string) *TransferSession {
+	s.transferType = transferType
+	return s
+}
+
 // fullPath returns the absolute path of the transfer directory.
 func (s *TransferSession) fullPath() string {
 	return afero.FullBaseFsPath(s.fs.Fs.(*afero.BasePathFs), "")
@@ -115,22 +144,119 @@ func (s *TransferSession) path() string {
 }
 
 // Create returns a new file created in the transfer directory.
+//
+// The name is sanitised before the file is created, see sanitizeName for more
+// details. Names that collide with files previously created in the session
+// are renamed deterministically, e.g. "data.csv" becomes "data_1.csv". The
+// Name method of the returned file reports the name that was finally used,
+// relative to the transfer directory.
 func (s *TransferSession) Create(name string) (afero.File, error) {
-	err := s.fs.MkdirAll(filepath.Dir(name), os.FileMode(0o755))
+	clean, err := sanitizeName(name)
+	if err != nil {
+		return nil, err
+	}
+	clean = s.Filenames.Add(name, clean)
+	err = s.fs.MkdirAll(path.Dir(clean), os.FileMode(0o755))
 	if err != nil {
 		return nil, err
 	}
-	f, err := s.fs.Create(name)
+	f, err := s.fs.Create(clean)
 	if err != nil {
 		return nil, err
 	}
-	return f, nil
+	return &transferFile{File: f, name: clean}, nil
 }
 
-// Start the transfer using the Package API endpoint. This API is still in beta.
-func (s *TransferSession) Start() (string, error) {
-	ctx := context.Background()
+// CreateMetadataFile returns a new file created in the metadata directory of
+// the transfer, e.g. "rdss/message.json" is created as
+// "metadata/rdss/message.json". The name is sanitised like in Create but
+// collisions are not resolved, i.e. existing files are truncated.
+func (s *TransferSession) CreateMetadataFile(name string) (afero.File, error) {
+	clean, err := sanitizeName(name)
+	if err != nil {
+		return nil, err
+	}
+	clean = path.Join("/metadata", clean)
+	err = s.fs.MkdirAll(path.Dir(clean), os.FileMode(0o755))
+	if err != nil {
+		return nil, err
+	}
+	return s.fs.Create(clean)
+}
+
+// transferFile is an afero.File that reports its name relative to the transfer
+// directory.
+type transferFile struct {
+	afero.File
+	name string
+}
+
+func (f *transferFile) Name() string {
+	return f.name
+}
+
+// sanitizeName normalises a file name so it can be safely used inside the
+// transfer directory. Backslashes are treated as separators, leading slashes
+// and empty or "." elements are dropped and characters that Archivematica or
+// the underlying filesystem may reject are replaced with underscores. Names
+// under the metadata directory of the transfer are moved to "metadata_", e.g.
+// "metadata/notes.txt" becomes "metadata_/notes.txt".
+//
+// Names that try to escape the transfer directory, e.g. "../foo", are
+// rejected.
+func sanitizeName(name string) (string, error) {
+	elems := []string{}
+	for _, elem := range strings.Split(strings.ReplaceAll(name, "\\", "/"), "/") {
+		elem = strings.TrimSpace(elem)
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			return "", errors.Errorf("invalid file name %q: path traversal is not allowed", name)
+		}
+		elem = strings.Map(func(r rune) rune {
+			if r < 0x20 || r == 0x7f || strings.ContainsRune(`<>:"|?*`, r) {
+				return '_'
+			}
+			return r
+		}, elem)
+		elems = append(elems, elem)
+	}
+	if len(elems) == 0 {
+		return "", errors.Errorf("invalid file name %q: name is empty", name)
+	}
+	if strings.EqualFold(elems[0], "metadata") {
+		elems[0] += "_"
+	}
+	return strings.Join(elems, "/"), nil
+}
 
+// TransferStartError is returned by TransferSession.Start when the request that
+// starts the transfer fails. Unlike the errors found while the transfer is
+// prepared, the pipeline may have started the transfer anyway, e.g. when the
+// response timed out.
+type TransferStartError struct {
+	Err error
+}
+
+func (e *TransferStartError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TransferStartError) Unwrap() error {
+	return e.Err
+}
+
+// Start the transfer using the Package API endpoint. This API is still in beta.
+//
+// Bags are built at this point: the contents of the transfer are moved into
+// the payload directory and the SHA-256 checksums registered are used in the
+// manifest, the checksums of the remaining files are computed. Zipped bags are
+// written next to the transfer directory, which is removed afterwards.
+//
+// Transfers with a stager are uploaded to its location before they are
+// started, see TransferSession.WithStager.
+func (s *TransferSession) Start(ctx context.Context) (string, error) {
 	if err := s.createMetadataDir(); err != nil {
 		return "", errors.Wrap(err, "cannot create metadata dir")
 	}
@@ -139,18 +265,47 @@ func (s *TransferSession) Start() (string, error) {
 		return "", errors.Wrap(err, "cannot write metadata")
 	}
 
+	if err := s.Rights.Write(); err != nil {
+		return "", errors.Wrap(err, "cannot write rights")
+	}
+
 	if err := s.createChecksumsFiles(); err != nil {
 		return "", errors.Wrap(err, "cannot create checksum files")
 	}
 
+	if err := s.Filenames.Write(); err != nil {
+		return "", errors.Wrap(err, "cannot write file names")
+	}
+
+	path := s.path()
+	switch s.transferType {
+	case TransferTypeUnzippedBag, TransferTypeZippedBag:
+		if err := bag(s.fs, s.BagInfo, s.ChecksumsSHA256.values, time.Now()); err != nil {
+			return "", errors.Wrap(err, "cannot create bag")
+		}
+	}
+	if s.transferType == TransferTypeZippedBag {
+		if err := s.zip(); err != nil {
+			return "", errors.Wrap(err, "cannot create zipped bag")
+		}
+		path += ".zip"
+	}
+	if s.stager != nil {
+		var err error
+		if path, err = s.stage(ctx, path); err != nil {
+			return "", errors.Wrap(err, "cannot stage transfer")
+		}
+	}
+
 	req := &PackageCreateRequest{
 		Name:             s.name,
-		Path:             s.path(),
+		Type:             s.transferType,
+		Path:             path,
 		ProcessingConfig: s.processingConfig,
 	}
 	payload, _, err := s.c.Package.Create(ctx, req)
 	if err != nil {
-		return "", err
+		return "", &TransferStartError{Err: err}
 	}
 
 	return payload.ID, nil
@@ -173,10 +328,30 @@ func (s *TransferSession) Contents() []string {
 	return paths
 }
 
+// zip writes the contents of the transfer into a zip file next to the transfer
+// directory, which is removed afterwards.
+func (s *TransferSession) zip() error {
+	f, err := os.Create(s.fullPath() + ".zip")
+	if err != nil {
+		return err
+	}
+	if err := zipDir(s.fs, filepath.Base(s.fullPath()), f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.RemoveAll(s.fullPath())
+}
+
 // Destroy removes the transfer directory and its contents. The caller should
 // not expect TransferSession to be in a usable state once this method has been
 // called.
 func (s *TransferSession) Destroy() error {
+	if err := os.Remove(s.fullPath() + ".zip"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
 	return os.RemoveAll(s.fullPath())
 }
 
@@ -192,6 +367,18 @@ func (s *TransferSession) Describe(field, value string) {
 	s.Metadata.Add("objects/", field, value)
 }
 
+// DescribeBag registers metadata of the bag, written in its `bag-info.txt`
+// file. It is ignored unless the transfer is a bag.
+func (s *TransferSession) DescribeBag(label, value string) {
+	s.BagInfo.Add(label, value)
+}
+
+// AddRightsStatement registers a PREMIS rights statement for a file. It causes
+// the transfer to include a `metadata/rights.csv` file.
+func (s *TransferSession) AddRightsStatement(name string, statement RightsStatement) {
+	s.Rights.Add(name, statement)
+}
+
 // ChecksumMD5 registers a MD5 checksum for a file.
 func (s *TransferSession) ChecksumMD5(name, sum string) {
 	s.ChecksumsMD5.Add(name, sum)
@@ -404,3 +591,223 @@ func (c *ChecksumSet) Write() error {
 
 	return nil
 }
+
+// FilenameSet keeps track of the names of the files created in the transfer.
+// It is used to detect collisions and to preserve the original names of the
+// files that had to be renamed.
+type FilenameSet struct {
+	// entries holds pairs of original and final names.
+	entries [][2]string
+	used    map[string]struct{} // Names of the files.
+	dirs    map[string]struct{} // Names of their parent directories.
+	fs      afero.Fs
+}
+
+// NewFilenameSet returns a new FilenameSet.
+func NewFilenameSet(fs afero.Fs) *FilenameSet {
+	return &FilenameSet{
+		used: make(map[string]struct{}),
+		dirs: make(map[string]struct{}),
+		fs:   fs,
+	}
+}
+
+// Add registers a file given its original and sanitised names. It returns the
+// final name, which differs from the sanitised name when the latter is already
+// in use, e.g. "data.csv" becomes "data_1.csv", then "data_2.csv" and so on.
+// Files and directories cannot share a name either: the directories of the
+// name that are already files are renamed the same way, e.g. "data.csv/a"
+// becomes "data.csv_1/a", and so is the file when it is already a directory.
+func (f *FilenameSet) Add(original, name string) string {
+	elems := strings.Split(name, "/")
+	for i := 0; i < len(elems)-1; i++ {
+		dir := elems[i]
+		for n := 1; f.taken(path.Join(elems[:i+1]...)); n++ {
+			elems[i] = dir + "_" + strconv.Itoa(n)
+		}
+	}
+	final := path.Join(elems...)
+	ext := path.Ext(final)
+	base := strings.TrimSuffix(final, ext)
+	for i := 1; f.taken(final) || f.isDir(final); i++ {
+		final = base + "_" + strconv.Itoa(i) + ext
+	}
+	f.used[strings.ToLower(final)] = struct{}{}
+	for dir := path.Dir(final); dir != "."; dir = path.Dir(dir) {
+		f.dirs[strings.ToLower(dir)] = struct{}{}
+	}
+	f.entries = append(f.entries, [2]string{original, final})
+	return final
+}
+
+// taken reports whether the name is in use by a file. The comparison is
+// case-insensitive so the transfer can be moved across case-insensitive
+// filesystems safely.
+func (f *FilenameSet) taken(name string) bool {
+	_, ok := f.used[strings.ToLower(name)]
+	return ok
+}
+
+// isDir reports whether the name is in use by a directory, see taken.
+func (f *FilenameSet) isDir(name string) bool {
+	_, ok := f.dirs[strings.ToLower(name)]
+	return ok
+}
+
+// Renamed returns the pairs of original and final names of the files that
+// were renamed, in the order they were added.
+func (f *FilenameSet) Renamed() [][2]string {
+	renamed := [][2]string{}
+	for _, entry := range f.entries {
+		if entry[0] != entry[1] {
+			renamed = append(renamed, entry)
+		}
+	}
+	return renamed
+}
+
+// Write creates the `metadata/filenames.csv` file mapping the original names
+// to the names used in the transfer. Nothing is written when all the files
+// kept their original names.
+func (f *FilenameSet) Write() error {
+	const path = "/metadata/filenames.csv"
+	renamed := f.Renamed()
+	if len(renamed) == 0 {
+		return nil
+	}
+	file, err := f.fs.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := csv.NewWriter(file)
+	_ = writer.Write([]string{"original", "filename"})
+	for _, entry := range renamed {
+		_ = writer.Write([]string{entry[0], "objects/" + entry[1]})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// RightsStatement is a PREMIS rights statement in the rights import format of
+// Archivematica, i.e. a row of the `metadata/rights.csv` file.
+type RightsStatement struct {
+	// Basis is one of "copyright", "statute", "license", "donor", "policy" or
+	// "other".
+	Basis string
+
+	// Status is the copyright status, e.g. "copyrighted" or "unknown".
+	Status string
+
+	DeterminationDate time.Time
+	Jurisdiction      string
+	Note              string
+
+	// StartDate and EndDate are the applicable dates of the basis. The end
+	// date is written as "open" when it's not set but the start date is.
+	StartDate time.Time
+	EndDate   time.Time
+
+	// GrantAct is the action granted, e.g. "disseminate". GrantRestriction is
+	// one of "Allow", "Disallow" or "Conditional".
+	GrantAct         string
+	GrantRestriction string
+	GrantStartDate   time.Time
+	GrantEndDate     time.Time
+	GrantNote        string
+
+	// Documentation identifier of the basis.
+	DocIDType  string
+	DocIDValue string
+	DocIDRole  string
+}
+
+// RightsSet holds the rights statements of the files of the transfer.
+type RightsSet struct {
+	statements map[string][]RightsStatement
+	fs         afero.Fs
+}
+
+// NewRightsSet returns a new RightsSet.
+func NewRightsSet(fs afero.Fs) *RightsSet {
+	return &RightsSet{
+		statements: make(map[string][]RightsStatement),
+		fs:         fs,
+	}
+}
+
+// Add registers a rights statement for a file given its name in the transfer,
+// e.g. as reported by TransferSession.Create.
+func (r *RightsSet) Add(name string, s RightsStatement) {
+	r.statements[name] = append(r.statements[name], s)
+}
+
+// Statements returns the rights statements registered for a file.
+func (r *RightsSet) Statements(name string) []RightsStatement {
+	return r.statements[name]
+}
+
+// Write creates the `metadata/rights.csv` file. Nothing is written when no
+// statements have been registered.
+func (r *RightsSet) Write() error {
+	const (
+		path       = "/metadata/rights.csv"
+		dateLayout = "2006-01-02"
+	)
+	if len(r.statements) == 0 {
+		return nil
+	}
+	f, err := r.fs.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	writer := csv.NewWriter(f)
+	_ = writer.Write([]string{
+		"file", "basis", "status", "determination_date", "jurisdiction",
+		"start_date", "end_date", "note", "grant_act", "grant_restriction",
+		"grant_start_date", "grant_end_date", "grant_note", "doc_id_type",
+		"doc_id_value", "doc_id_role",
+	})
+	date := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(dateLayout)
+	}
+	endDate := func(start, end time.Time) string {
+		if end.IsZero() && !start.IsZero() {
+			return "open"
+		}
+		return date(end)
+	}
+	names := make([]string, 0, len(r.statements))
+	for name := range r.statements {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, s := range r.statements[name] {
+			_ = writer.Write([]string{
+				"objects/" + name,
+				s.Basis,
+				s.Status,
+				date(s.DeterminationDate),
+				s.Jurisdiction,
+				date(s.StartDate),
+				endDate(s.StartDate, s.EndDate),
+				s.Note,
+				s.GrantAct,
+				s.GrantRestriction,
+				date(s.GrantStartDate),
+				endDate(s.GrantStartDate, s.GrantEndDate),
+				s.GrantNote,
+				s.DocIDType,
+				s.DocIDValue,
+				s.DocIDRole,
+			})
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/spf13/afero"
 )
@@ -82,7 +83,7 @@ func TestTransferSession_WithProcessingConfig(t *testing.T) {
 func TestTransferSession_Start(t *testing.T) {
 	ts := newTransferSession(t, "Test")
 
-	id, err := ts.Start()
+	id, err := ts.Start(ctx)
 	if err != nil {
 		t.Fatalf("TransferSession.Start() failed: %v", err)
 	}
@@ -105,7 +106,7 @@ func TestTransferSession_Create(t *testing.T) {
 	}{
 		{"foobar.jpg", filepath.Join(tsPath, "foobar.jpg")},
 		{"foo/bar.jpg", filepath.Join(tsPath, "foo/bar.jpg")},
-		{"/foo/bar.jpg", filepath.Join(tsPath, "foo/bar.jpg")},
+		{"/foo/bar.jpg", filepath.Join(tsPath, "foo/bar_1.jpg")},
 		{"/f/o/o/b/a/r.jpg", filepath.Join(tsPath, "f/o/o/b/a/r.jpg")},
 	}
 	for _, tt := range tests {
@@ -122,8 +123,185 @@ func TestTransferSession_Create(t *testing.T) {
 		if err != nil || !found {
 			t.Fatalf("file check failed: err=%s found=%t", err, found)
 		}
+		if have, want := filepath.Join(tsPath, f.Name()), tt.want; have != want {
+			t.Fatalf("Create() unexpected name; have %s, want %s", have, want)
+		}
+	}
+}
+
+func TestTransferSession_Create_invalid(t *testing.T) {
+	ts := newTransferSession(t, "")
+
+	tests := []string{
+		"",
+		"/",
+		"../foo.jpg",
+		"foo/../../bar.jpg",
+		"..\\foo.jpg",
+	}
+	for _, name := range tests {
+		if _, err := ts.Create(name); err == nil {
+			t.Errorf("Create(%q) expected an error", name)
+		}
+	}
+	if contents := ts.Contents(); len(contents) > 0 {
+		t.Fatalf("Create() created unexpected files: %v", contents)
 	}
 }
+
+func TestTransferSession_Create_collisions(t *testing.T) {
+	ts := newTransferSession(t, "")
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"data.csv", "data.csv"},
+		{"data.csv", "data_1.csv"},
+		{"/data.csv", "data_2.csv"},
+		{"DATA.csv", "DATA_3.csv"},
+		{"data_1.csv", "data_1_1.csv"},
+		{"dir\\file?.txt", "dir/file_.txt"},
+		{"dir/file_.txt", "dir/file__1.txt"},
+		{"README", "README"},
+		{"./README", "README_1"},
+		{"metadata/metadata.csv", "metadata_/metadata.csv"},
+		{"Metadata/metadata.csv", "Metadata_/metadata_1.csv"},
+		{"a", "a"},
+		{"a/b", "a_1/b"},
+		{"A/c", "A_1/c"},
+		{"d/e/f", "d/e/f"},
+		{"d/e", "d/e_1"},
+		{"D", "D_1"},
+	}
+	for _, tt := range tests {
+		f, err := ts.Create(tt.name)
+		if err != nil {
+			t.Fatalf("Create(%q) failed: %v", tt.name, err)
+		}
+		f.Close()
+		if have, want := f.Name(), tt.want; have != want {
+			t.Errorf("Create(%q) unexpected name; have %s, want %s", tt.name, have, want)
+		}
+	}
+	if have, want := len(ts.Contents()), len(tests); have != want {
+		t.Fatalf("Created %d files, only %d found", want, have)
+	}
+}
+
+func TestTransferSession_FilenameSet(t *testing.T) {
+	fs := afero.Afero{Fs: afero.NewBasePathFs(afero.NewMemMapFs(), "/")}
+	set := NewFilenameSet(fs)
+	set.Add("bird-sounds.mp3", "bird-sounds.mp3")
+	set.Add("bird-sounds.mp3", "bird-sounds.mp3")
+	set.Add("woodpigeon:pic.jpg", "woodpigeon_pic.jpg")
+	set.Add("metadata/notes.txt", "metadata_/notes.txt")
+	set.Add("bird-sounds.mp3/notes.txt", "bird-sounds.mp3/notes.txt")
+
+	want := `original,filename
+bird-sounds.mp3,objects/bird-sounds_1.mp3
+woodpigeon:pic.jpg,objects/woodpigeon_pic.jpg
+metadata/notes.txt,objects/metadata_/notes.txt
+bird-sounds.mp3/notes.txt,objects/bird-sounds.mp3_1/notes.txt
+`
+	if err := set.Write(); err != nil {
+		t.Fatal(err)
+	}
+	c, err := fs.ReadFile("/metadata/filenames.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := string(c); want != have {
+		t.Fatalf("Unexpected content:\nhave:\n%s\nwant:\n%s", have, want)
+	}
+}
+
+func TestTransferSession_FilenameSet_noRenames(t *testing.T) {
+	fs := afero.Afero{Fs: afero.NewBasePathFs(afero.NewMemMapFs(), "/")}
+	set := NewFilenameSet(fs)
+	set.Add("bird-sounds.mp3", "bird-sounds.mp3")
+
+	if err := set.Write(); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := fs.Exists("/metadata/filenames.csv"); exists {
+		t.Fatal("Write() created a file with no renames")
+	}
+}
+
+func TestTransferSession_RightsSet(t *testing.T) {
+	fs := afero.Afero{Fs: afero.NewBasePathFs(afero.NewMemMapFs(), "/")}
+	set := NewRightsSet(fs)
+	set.Add("woodpigeon.jpg", RightsStatement{
+		Basis:            "license",
+		Note:             "CC BY 4.0",
+		StartDate:        time.Date(2017, time.March, 1, 0, 0, 0, 0, time.UTC),
+		GrantAct:         "disseminate",
+		GrantRestriction: "Allow",
+		GrantStartDate:   time.Date(2017, time.March, 1, 0, 0, 0, 0, time.UTC),
+		GrantEndDate:     time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC),
+		DocIDType:        "URI",
+		DocIDValue:       "https://creativecommons.org/licenses/by/4.0/",
+		DocIDRole:        "license",
+	})
+	set.Add("bird-sounds.mp3", RightsStatement{
+		Basis:            "policy",
+		Note:             "closed",
+		GrantAct:         "disseminate",
+		GrantRestriction: "Disallow",
+	})
+	set.Add("woodpigeon.jpg", RightsStatement{
+		Basis:  "copyright",
+		Status: "unknown",
+		Note:   "All rights reserved.",
+	})
+
+	want := `file,basis,status,determination_date,jurisdiction,start_date,end_date,note,grant_act,grant_restriction,grant_start_date,grant_end_date,grant_note,doc_id_type,doc_id_value,doc_id_role
+objects/bird-sounds.mp3,policy,,,,,,closed,disseminate,Disallow,,,,,,
+objects/woodpigeon.jpg,license,,,,2017-03-01,open,CC BY 4.0,disseminate,Allow,2017-03-01,2020-03-01,,URI,https://creativecommons.org/licenses/by/4.0/,license
+objects/woodpigeon.jpg,copyright,unknown,,,,,All rights reserved.,,,,,,,,
+`
+	if err := set.Write(); err != nil {
+		t.Fatal(err)
+	}
+	c, err := fs.ReadFile("/metadata/rights.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := string(c); want != have {
+		t.Fatalf("Unexpected content:\nhave:\n%s\nwant:\n%s", have, want)
+	}
+}
+
+func TestTransferSession_RightsSet_empty(t *testing.T) {
+	fs := afero.Afero{Fs: afero.NewBasePathFs(afero.NewMemMapFs(), "/")}
+	set := NewRightsSet(fs)
+
+	if err := set.Write(); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := fs.Exists("/metadata/rights.csv"); exists {
+		t.Fatal("Write() created a file with no statements")
+	}
+}
+
+func TestTransferSession_CreateMetadataFile(t *testing.T) {
+	ts := newTransferSession(t, "")
+
+	f, err := ts.CreateMetadataFile("rdss/message.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if found, err := ts.fs.Exists("/metadata/rdss/message.json"); err != nil || !found {
+		t.Fatalf("file check failed: err=%s found=%t", err, found)
+	}
+
+	if _, err := ts.CreateMetadataFile("../objects/foo.jpg"); err == nil {
+		t.Fatal("CreateMetadataFile() expected an error")
+	}
+}
+
 func TestTransferSession_Destroy(t *testing.T) {
 	ts := newTransferSession(t, "MyTransfer")
 	afero.TempFile(ts.fs, "/", "uno")
@@ -215,7 +393,7 @@ func TestTransferSession_ChecksumSet(t *testing.T) {
 		want1 = `92c8ab01cecceb3bf0789c2cd8c7415a bird-sounds.mp3
 53a64110e067b14394c142c09571bea0 woodpigeon pic.jpg
 `
-		want2 = `53a64110e067b14394c142c09571bea0 woodpigeon-pic.jpg
+		want2 = `53a64110e067b14394c142c09571bea0 woodpigeon pic.jpg
 92c8ab01cecceb3bf0789c2cd8c7415a bird-sounds.mp3
 `
 	)
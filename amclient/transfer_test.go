@@ -123,3 +123,61 @@ func TestTransfer_Status(t *testing.T) {
 		Type:         "transfer",
 	}, payload)
 }
+
+func TestTransfer_Start_metadataSets(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/transfer/start_transfer/", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		r.ParseForm()
+		assert.Equal(t, []string{"a.jpg", "b.jpg"}, r.PostForm["paths"])
+		assert.Equal(t, []string{"3", "4"}, r.PostForm["row_ids"])
+		assert.Equal(t, "2020-001", r.PostForm.Get("accession"))
+		assert.NotContains(t, r.PostForm, "access_system_id")
+		fmt.Fprint(w, `{"message": "Copy successful", "path": "/var/foobar"}`)
+	})
+
+	_, _, err := client.Transfer.Start(ctx, &TransferStartRequest{
+		Name:           "foobar",
+		Paths:          []string{"a.jpg", "b.jpg"},
+		Type:           "standard",
+		Accession:      "2020-001",
+		MetadataSetIDs: []string{"3", "4"},
+	})
+
+	assert.NoError(t, err)
+}
+
+func TestTransfer_Hide(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/transfer/eaedbee3-2b02-4e40-baa0-3ef92c5fd17e/delete/", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "DELETE")
+		fmt.Fprint(w, `{"removed": true}`)
+	})
+
+	payload, _, err := client.Transfer.Hide(ctx, "eaedbee3-2b02-4e40-baa0-3ef92c5fd17e")
+
+	assert.NoError(t, err)
+	assert.Equal(t, &HideResponse{Removed: true}, payload)
+}
+
+func TestTransfer_Completed(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/transfer/completed/", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprint(w, `{"message": "Fetched completed transfers successfully.", "results": ["eaedbee3-2b02-4e40-baa0-3ef92c5fd17e"]}`)
+	})
+
+	payload, _, err := client.Transfer.Completed(ctx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &CompletedResponse{
+		Message: "Fetched completed transfers successfully.",
+		Results: []string{"eaedbee3-2b02-4e40-baa0-3ef92c5fd17e"},
+	}, payload)
+}
@@ -42,6 +42,8 @@ type TaskDetailed struct {
 	TimeStarted TaskDateTime `json:"time_started"`
 	TimeEnded   TaskDateTime `json:"time_ended"`
 	Duration    uint32       `json:"duration"`
+	Stdout      string       `json:"stdout"`
+	Stderr      string       `json:"stderr"`
 }
 
 func (s *TaskServiceOp) Read(ctx context.Context, ID string) (*TaskDetailed, *Response, error) {
@@ -23,7 +23,9 @@ func TestTask_Read(t *testing.T) {
 	"time_created": "2019-06-18T00:00:00",
 	"time_started": "2019-07-18T00:00:00",
 	"time_ended": "2019-08-18T00:00:00",
-	"duration": 4294967295
+	"duration": 4294967295,
+	"stdout": "",
+	"stderr": "foobar.txt: not found"
 }`)
 	})
 
@@ -39,5 +41,6 @@ func TestTask_Read(t *testing.T) {
 		TimeEnded:   TaskDateTime{Time: time.Date(2019, time.August, 18, 0, 0, 0, 0, time.UTC)},
 		Filename:    "foobar.txt",
 		Duration:    4294967295,
+		Stderr:      "foobar.txt: not found",
 	}, payload)
 }
@@ -0,0 +1,68 @@
+package amclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+const validateBasePath = "api/v2beta/validate"
+
+const mediaTypeCSV = "text/csv; charset=utf-8"
+
+// Validators supported by ValidateService.Validate.
+const (
+	ValidatorAvalon = "avalon"
+	ValidatorRights = "rights"
+)
+
+// ValidateService is an interface for interfacing with the Validate endpoint
+// of the Dashboard API.
+type ValidateService interface {
+	Validate(context.Context, string, io.Reader) (*ValidateResponse, *Response, error)
+}
+
+// ValidateServiceOp handles communication with the Validate related methods
+// of the Archivematica API.
+type ValidateServiceOp struct {
+	client *Client
+}
+
+var _ ValidateService = &ValidateServiceOp{}
+
+// ValidateResponse represents the outcome of a validation.
+type ValidateResponse struct {
+	Valid  bool   `json:"valid"`
+	Reason string `json:"reason"`
+}
+
+// Validate validates a CSV document with one of the validators of the
+// pipeline, e.g. ValidatorRights. Documents that are not valid are not
+// reported as an error: the reason is found in the response.
+func (s *ValidateServiceOp) Validate(ctx context.Context, validator string, r io.Reader) (*ValidateResponse, *Response, error) {
+	path := fmt.Sprintf("%s/%s/", validateBasePath, validator)
+
+	req, err := s.client.newRequest(ctx, "POST", path, mediaTypeCSV, r, func(req *http.Request) {
+		req.Header.Set("Accept", mediaTypeJSON)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payload := &ValidateResponse{}
+	resp, err := s.client.Do(ctx, req, payload)
+
+	// The document is rejected with "400 Bad Request".
+	var errResp *ErrorResponse
+	if errors.As(err, &errResp) && errResp.Response.StatusCode == http.StatusBadRequest {
+		if jerr := json.Unmarshal(errResp.Body, payload); jerr == nil && !payload.Valid && payload.Reason != "" {
+			return payload, resp, nil
+		}
+	}
+
+	return payload, resp, err
+}
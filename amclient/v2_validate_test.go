@@ -0,0 +1,53 @@
+package amclient
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate_Validate(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/v2beta/validate/rights/", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		assert.Equal(t, mediaTypeCSV, r.Header.Get("Content-Type"))
+		blob, _ := ioutil.ReadAll(r.Body)
+		if strings.Contains(string(blob), "copyright") {
+			fmt.Fprint(w, `{"valid": true}`)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"valid": false, "reason": "Missing required column: basis."}`)
+	})
+
+	payload, _, err := client.Validate.Validate(ctx, ValidatorRights, strings.NewReader("file,basis\nobjects/bird.mp3,copyright\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, &ValidateResponse{Valid: true}, payload)
+
+	payload, _, err = client.Validate.Validate(ctx, ValidatorRights, strings.NewReader("file\nobjects/bird.mp3\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, &ValidateResponse{Valid: false, Reason: "Missing required column: basis."}, payload)
+}
+
+func TestValidate_Validate_unknownValidator(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/v2beta/validate/foobar/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error": "Unknown validator. Accepted values: avalon,rights"}`)
+	})
+
+	_, _, err := client.Validate.Validate(ctx, "foobar", strings.NewReader(""))
+
+	var errResp *ErrorResponse
+	assert.True(t, errors.As(err, &errResp))
+	assert.Equal(t, "Unknown validator. Accepted values: avalon,rights", errResp.Message)
+}
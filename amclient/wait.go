@@ -2,86 +2,108 @@ package amclient
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
-
-	"github.com/cenkalti/backoff/v3"
-	"github.com/pkg/errors"
+	"unicode/utf8"
 )
 
-const (
-	// maxWait determines for how long is our retry strategy willing to wait
-	// for the underlying operation to complete.
-	maxWait = time.Hour * 8
-
-	// workflowLinkStoreAIPID is the workflow link ID for "Store the AIP".
-	// There's some obvious API leaking here. On the bright side, link IDs are
-	// unlikely to change as opposed to link labels which may change more
-	// frequently.
-	workflowLinkStoreAIPID = "20515483-25ed-4133-b23e-5bb14cab8e22"
-)
+// maxWait determines for how long are we willing to wait for a transfer to be
+// stored.
+const maxWait = time.Hour * 8
 
 // WaitUntilStored blocks until the AIP generated after a transfer is confirmed
-// to be stored. The implementation is based on TransferService.Status and
-// JobsService.List.
-//
-// The retry gives up as soon as one of the following events occur:
-// * The caller cancels the context.
-// * The total retry period exceeds maxWait.
-//
-// TODO: we may want to give up earlier in case of specific errors, e.g. if
-// TransferService.Status returns errors repeatedly?
+// to be stored. It uses a Watcher dedicated to the transfer, see Watcher.Wait
+// for more details. Callers waiting for many transfers of the same pipeline
+// should share a Watcher instead.
 func WaitUntilStored(ctx context.Context, c *Client, transferID string) (SIPID string, err error) {
-	expBackoff := backoff.NewExponentialBackOff()
-	expBackoff.MaxElapsedTime = maxWait
-	ctxBackoff := backoff.WithContext(expBackoff, ctx)
+	return NewWatcher(c).Wait(ctx, transferID)
+}
 
-	err = backoff.Retry(func() error {
+func failedJob(jobs []Job) *Job {
+	for _, job := range jobs {
+		if job.Status == JobStatusFailed {
+			return &job
+		}
+	}
+	return nil
+}
 
-		ctx, cancel := context.WithTimeout(ctx, time.Duration(time.Second*1))
-		defer cancel()
+const (
+	// maxFailedTasks is the maximum number of failed tasks described by
+	// IngestFailedError.
+	maxFailedTasks = 5
 
-		// Retrieve SIPID.
-		if SIPID == "" {
-			resp, _, err := c.Transfer.Status(ctx, transferID)
-			if err != nil {
-				return errors.Wrap(err, "TransferService.Status request failed")
-			}
-			sid, ok := resp.SIP()
-			if !ok {
-				return errors.New("SIP not created yet")
-			}
-			SIPID = sid
-		}
+	// maxTaskOutput is the maximum length of the output of a task described
+	// by IngestFailedError.
+	maxTaskOutput = 1024
+)
 
-		// Retrieve status.
-		jobs, _, err := c.Jobs.List(ctx, SIPID, &JobsListRequest{
-			LinkID: workflowLinkStoreAIPID,
-		})
-		if err != nil {
-			return errors.Wrap(err, "JobsService.List request failed")
-		}
-		var match *Job
-		for _, job := range jobs {
-			job := job
-			if job.LinkID == workflowLinkStoreAIPID {
-				match = &job
-				break
-			}
+// IngestFailedError is returned by WaitUntilStored when a job of the transfer
+// or the SIP fails.
+type IngestFailedError struct {
+	TransferID   string
+	SIPID        string
+	Microservice string
+	JobID        string
+	JobName      string
+
+	// Tasks are the failed tasks of the job. Their output may be truncated.
+	Tasks []TaskDetailed
+}
+
+func newIngestFailedError(ctx context.Context, c *Client, transferID, SIPID string, job *Job) *IngestFailedError {
+	err := &IngestFailedError{
+		TransferID:   transferID,
+		SIPID:        SIPID,
+		Microservice: job.Microservice,
+		JobID:        job.ID,
+		JobName:      job.Name,
+	}
+	for _, task := range job.Tasks {
+		if task.ExitCode == 0 {
+			continue
 		}
-		var notStoredYetErr = errors.New("AIP not stored yet")
-		if match == nil {
-			return notStoredYetErr
+		if len(err.Tasks) == maxFailedTasks {
+			break
 		}
-		switch match.Status {
-		case JobStatusFailed:
-			return backoff.Permanent(errors.New("AIP store operation failed"))
-		case JobStatusComplete:
-			return nil
-		default:
-			return notStoredYetErr
+		detailed, _, rerr := c.Task.Read(ctx, task.ID)
+		if rerr != nil {
+			detailed = &TaskDetailed{ID: task.ID, ExitCode: task.ExitCode}
 		}
+		detailed.Stdout = truncate(detailed.Stdout, maxTaskOutput)
+		detailed.Stderr = truncate(detailed.Stderr, maxTaskOutput)
+		err.Tasks = append(err.Tasks, *detailed)
+	}
+	return err
+}
 
-	}, ctxBackoff)
+func (e *IngestFailedError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "ingest failed at microservice %q, job %q (%s) of transfer %s", e.Microservice, e.JobName, e.JobID, e.TransferID)
+	if e.SIPID != "" {
+		fmt.Fprintf(&b, " and SIP %s", e.SIPID)
+	}
+	for _, task := range e.Tasks {
+		fmt.Fprintf(&b, "; task %s", task.ID)
+		if task.Filename != "" {
+			fmt.Fprintf(&b, " (%s)", task.Filename)
+		}
+		fmt.Fprintf(&b, " exited with code %d", task.ExitCode)
+		if output := strings.TrimSpace(task.Stderr); output != "" {
+			fmt.Fprintf(&b, ": %s", output)
+		}
+	}
+	return b.String()
+}
 
-	return SIPID, err
+// truncate shortens s to at most n bytes without splitting a UTF-8 character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
 }
@@ -2,12 +2,17 @@ package amclient_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/http/httptest"
+	"testing"
 	"time"
 
 	"github.com/JiscSD/rdss-archivematica-channel-adapter/amclient"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func ExampleWaitUntilStored() {
@@ -35,3 +40,83 @@ func ExampleWaitUntilStored() {
 
 	fmt.Printf("Transfer stored successfully! AIP %s", SIPID)
 }
+
+func TestWaitUntilStored(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/transfer/status/e99afef7-90c5-4fd9-bf8f-bed13b3bd4ba/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status": "COMPLETE", "sip_uuid": "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0"}`)
+	})
+	mux.HandleFunc("/api/ingest/status/2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status": "COMPLETE", "type": "SIP", "uuid": "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := amclient.NewClient(nil, server.URL, "", "")
+	SIPID, err := amclient.WaitUntilStored(context.Background(), client, "e99afef7-90c5-4fd9-bf8f-bed13b3bd4ba")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0", SIPID)
+}
+
+func TestWaitUntilStored_failed(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       string
+		ingestStatus string
+		unitID       string
+		wantErr      string
+	}{
+		{
+			name:   "transfer",
+			status: `{"status": "FAILED", "sip_uuid": ""}`,
+			unitID: "e99afef7-90c5-4fd9-bf8f-bed13b3bd4ba",
+			wantErr: `ingest failed at microservice "Normalize", job "Normalize for preservation" ` +
+				`(624581dc-ec01-4195-9da3-db0ab0ad1cc3) of transfer e99afef7-90c5-4fd9-bf8f-bed13b3bd4ba; ` +
+				`task 96acb0a1-525c-456a-9060-51bb84f5f708 (foobar.txt) exited with code 1: foobar.txt: not found`,
+		},
+		{
+			name:         "SIP",
+			status:       `{"status": "COMPLETE", "sip_uuid": "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0"}`,
+			ingestStatus: `{"status": "FAILED", "type": "SIP", "uuid": "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0"}`,
+			unitID:       "2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0",
+			wantErr: `ingest failed at microservice "Normalize", job "Normalize for preservation" ` +
+				`(624581dc-ec01-4195-9da3-db0ab0ad1cc3) of transfer e99afef7-90c5-4fd9-bf8f-bed13b3bd4ba ` +
+				`and SIP 2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0; ` +
+				`task 96acb0a1-525c-456a-9060-51bb84f5f708 (foobar.txt) exited with code 1: foobar.txt: not found`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/transfer/status/e99afef7-90c5-4fd9-bf8f-bed13b3bd4ba/", func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, tt.status)
+			})
+			mux.HandleFunc("/api/ingest/status/2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0/", func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, tt.ingestStatus)
+			})
+			mux.HandleFunc("/api/v2beta/jobs/"+tt.unitID+"/", func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `[
+	{"uuid": "624581dc-ec01-4195-9da3-db0ab0ad1cc3", "name": "Normalize for preservation", "status": "FAILED", "microservice": "Normalize", "tasks": [
+		{"uuid": "491aebbd-457b-4a6e-adf6-87a3a9ee951a", "exit_code": 0},
+		{"uuid": "96acb0a1-525c-456a-9060-51bb84f5f708", "exit_code": 1}
+	]}
+]`)
+			})
+			mux.HandleFunc("/api/v2beta/task/96acb0a1-525c-456a-9060-51bb84f5f708/", func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"uuid": "96acb0a1-525c-456a-9060-51bb84f5f708", "exit_code": 1, "file_name": "foobar.txt", "time_created": "2019-06-18T00:00:00", "time_started": "2019-06-18T00:00:00", "time_ended": "2019-06-18T00:00:00", "stdout": "", "stderr": "foobar.txt: not found\n"}`)
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			client := amclient.NewClient(nil, server.URL, "", "")
+			_, err := amclient.WaitUntilStored(context.Background(), client, "e99afef7-90c5-4fd9-bf8f-bed13b3bd4ba")
+
+			var failedErr *amclient.IngestFailedError
+			assert.True(t, errors.As(err, &failedErr))
+			assert.EqualError(t, err, tt.wantErr)
+			assert.Len(t, failedErr.Tasks, 1)
+			assert.Equal(t, "Normalize", failedErr.Microservice)
+		})
+	}
+}
@@ -0,0 +1,354 @@
+package amclient
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultWatchInterval is the default interval between status checks.
+	defaultWatchInterval = time.Second * 10
+
+	// defaultWatchRequestTimeout is the default timeout of the status
+	// requests sent by the watcher.
+	defaultWatchRequestTimeout = time.Second * 30
+)
+
+// Watcher waits for the completion of the transfers of a pipeline. All the
+// in-flight transfers are checked in a single loop that only runs while there
+// are callers waiting. The status of a transfer is obtained with
+// TransferService.Status until its SIP is known, and with IngestService.Status
+// afterwards.
+//
+// Checks happen every Interval but they can be brought forward with Notify,
+// e.g. when Archivematica reports that an AIP has been stored.
+type Watcher struct {
+	// Interval between status checks.
+	Interval time.Duration
+
+	// RequestTimeout limits the duration of each status request.
+	RequestTimeout time.Duration
+
+	// MaxWait determines for how long a transfer is waited for.
+	MaxWait time.Duration
+
+	mu      sync.Mutex
+	client  *Client
+	watches map[string]*watch // Indexed by transfer identifier.
+	running bool
+	wake    chan struct{}
+
+	// Jobs being processed, counted by the last check.
+	activeJobs    int
+	activeJobsErr error
+}
+
+// watch is a transfer being waited for.
+type watch struct {
+	transferID string
+	SIPID      string
+	deadline   time.Time
+	refs       int   // Number of callers waiting.
+	lastErr    error // Last error seen checking the status.
+	err        error
+	done       chan struct{}
+}
+
+// NewWatcher returns a new Watcher for the pipeline of the client.
+func NewWatcher(c *Client) *Watcher {
+	return &Watcher{
+		Interval:       defaultWatchInterval,
+		RequestTimeout: defaultWatchRequestTimeout,
+		MaxWait:        maxWait,
+		client:         c,
+		watches:        map[string]*watch{},
+		wake:           make(chan struct{}, 1),
+	}
+}
+
+// SetClient replaces the client used in the following checks, e.g. after the
+// credentials of the pipeline have changed.
+func (w *Watcher) SetClient(c *Client) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.client = c
+}
+
+// Wait blocks until the AIP generated after a transfer is confirmed to be
+// stored and returns its identifier. It gives up as soon as one of the
+// following events occur:
+// * The caller cancels the context.
+// * The transfer has been waited for longer than MaxWait.
+// * The transfer or the SIP fail, in which case the error returned is an
+// *IngestFailedError describing the failed tasks when they can be found.
+// * The API rejects the credentials, in which case the error wraps the
+// *ErrorResponse. Other API errors are retried.
+func (w *Watcher) Wait(ctx context.Context, transferID string) (SIPID string, err error) {
+	w.mu.Lock()
+	wt, ok := w.watches[transferID]
+	if !ok {
+		wt = &watch{
+			transferID: transferID,
+			deadline:   time.Now().Add(w.MaxWait),
+			done:       make(chan struct{}),
+		}
+		w.watches[transferID] = wt
+	}
+	wt.refs++
+	if !w.running {
+		w.running = true
+		go w.run()
+	}
+	w.mu.Unlock()
+	w.signal()
+
+	select {
+	case <-wt.done:
+		return wt.SIPID, wt.err
+	case <-ctx.Done():
+		w.release(wt)
+		return "", ctx.Err()
+	}
+}
+
+// Notify brings the next check forward. It reports whether the identifier
+// given matches a transfer or a SIP being waited for.
+func (w *Watcher) Notify(ID string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.watches) == 0 {
+		return false
+	}
+	w.signal()
+	for _, wt := range w.watches {
+		if wt.transferID == ID || wt.SIPID == ID {
+			return true
+		}
+	}
+	return false
+}
+
+// Len returns the number of transfers being waited for.
+func (w *Watcher) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.watches)
+}
+
+// ActiveJobs returns the number of jobs being processed for the transfers
+// waited for, which gives an idea of how busy the pipeline is. Jobs of other
+// transfers, e.g. started by users of the Dashboard, are not counted. The
+// jobs are counted in each check rather than on demand, the error returned
+// is the one found counting them, if any.
+func (w *Watcher) ActiveJobs() (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.activeJobs, w.activeJobsErr
+}
+
+// countActiveJobs counts the jobs being processed for the transfers given.
+// Each transfer is represented by its SIP once it is known.
+func (w *Watcher) countActiveJobs(c *Client, watches []*watch) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), w.RequestTimeout)
+	defer cancel()
+
+	var active int
+	for _, wt := range watches {
+		w.mu.Lock()
+		ID := wt.transferID
+		if wt.SIPID != "" {
+			ID = wt.SIPID
+		}
+		w.mu.Unlock()
+		jobs, _, err := c.Jobs.List(ctx, ID, &JobsListRequest{})
+		if err != nil {
+			return 0, errors.Wrapf(err, "jobs of unit %s cannot be listed", ID)
+		}
+		for _, job := range jobs {
+			if job.Status == JobStatusProcessing {
+				active++
+			}
+		}
+	}
+	return active, nil
+}
+
+func (w *Watcher) signal() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// release forgets about a transfer when nobody is waiting for it.
+func (w *Watcher) release(wt *watch) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	wt.refs--
+	if wt.refs == 0 && w.watches[wt.transferID] == wt {
+		delete(w.watches, wt.transferID)
+	}
+}
+
+// finish wakes up the callers waiting for a transfer.
+func (w *Watcher) finish(wt *watch, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.watches[wt.transferID] == wt {
+		delete(w.watches, wt.transferID)
+	}
+	wt.err = err
+	close(wt.done)
+}
+
+func (w *Watcher) run() {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.wake:
+		}
+		if !w.poll() {
+			return
+		}
+	}
+}
+
+// poll checks the status of all the transfers. It returns false, stopping the
+// loop, when there are no transfers left.
+func (w *Watcher) poll() bool {
+	w.mu.Lock()
+	if len(w.watches) == 0 {
+		w.running = false
+		w.activeJobs, w.activeJobsErr = 0, nil
+		w.mu.Unlock()
+		return false
+	}
+	c := w.client
+	pending := make([]*watch, 0, len(w.watches))
+	for _, wt := range w.watches {
+		pending = append(pending, wt)
+	}
+	w.mu.Unlock()
+
+	waiting := make([]*watch, 0, len(pending))
+	for _, wt := range pending {
+		if done, err := w.check(c, wt); done {
+			w.finish(wt, err)
+			continue
+		}
+		waiting = append(waiting, wt)
+	}
+
+	active, err := w.countActiveJobs(c, waiting)
+	w.mu.Lock()
+	w.activeJobs, w.activeJobsErr = active, err
+	w.mu.Unlock()
+	return true
+}
+
+// check checks the status of a transfer. It reports whether the wait is over.
+func (w *Watcher) check(c *Client, wt *watch) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), w.RequestTimeout)
+	defer cancel()
+
+	w.mu.Lock()
+	SIPID, lastErr := wt.SIPID, wt.lastErr
+	w.mu.Unlock()
+
+	if time.Now().After(wt.deadline) {
+		err := errors.Errorf("transfer %s not stored after %s", wt.transferID, w.MaxWait)
+		if lastErr != nil {
+			err = errors.Wrap(lastErr, err.Error())
+		}
+		return true, err
+	}
+
+	status, err := w.status(ctx, c, wt.transferID, SIPID)
+	if permanent(err) {
+		return true, errors.Wrapf(err, "transfer %s cannot be watched", wt.transferID)
+	}
+	if err != nil {
+		w.mu.Lock()
+		wt.lastErr = err
+		w.mu.Unlock()
+		return false, nil
+	}
+	switch {
+	case status.failed():
+		return true, unitFailedError(ctx, c, wt.transferID, status.SIPID, status.status)
+	case status.SIPID != SIPID:
+		w.mu.Lock()
+		wt.SIPID = status.SIPID
+		w.mu.Unlock()
+	}
+	return status.stored, nil
+}
+
+type unitStatus struct {
+	SIPID  string
+	status string
+	stored bool
+}
+
+func (s unitStatus) failed() bool {
+	return s.status == UnitStatusFailed || s.status == UnitStatusRejected
+}
+
+// status obtains the status of the SIP, or the status of the transfer when the
+// SIP is not known yet.
+func (w *Watcher) status(ctx context.Context, c *Client, transferID, SIPID string) (unitStatus, error) {
+	if SIPID == "" {
+		resp, _, err := c.Transfer.Status(ctx, transferID)
+		if err != nil {
+			return unitStatus{}, errors.Wrap(err, "TransferService.Status request failed")
+		}
+		sid, ok := resp.SIP()
+		if !ok {
+			return unitStatus{status: resp.Status}, nil
+		}
+		SIPID = sid
+	}
+	resp, _, err := c.Ingest.Status(ctx, SIPID)
+	if permanent(err) {
+		return unitStatus{}, errors.Wrap(err, "IngestService.Status request failed")
+	}
+	if err != nil {
+		// The SIP may not be known by the ingest endpoint yet.
+		return unitStatus{SIPID: SIPID}, nil
+	}
+	return unitStatus{
+		SIPID:  SIPID,
+		status: resp.Status,
+		stored: resp.Status == UnitStatusComplete,
+	}, nil
+}
+
+// permanent reports whether the error is an API error that checking the status
+// again will not solve, i.e. the credentials are rejected. Other errors, e.g.
+// units that are not known yet, are retried until MaxWait.
+func permanent(err error) bool {
+	var errResp *ErrorResponse
+	return errors.As(err, &errResp) && errResp.Kind == ErrorKindAuth
+}
+
+// unitFailedError describes the failure of the transfer, or the SIP when it is
+// known, looking for the failed job in the job log.
+func unitFailedError(ctx context.Context, c *Client, transferID, SIPID, status string) error {
+	unitID, unitType := transferID, "transfer"
+	if SIPID != "" {
+		unitID, unitType = SIPID, "SIP"
+	}
+	jobs, _, err := c.Jobs.List(ctx, unitID, &JobsListRequest{})
+	if err == nil {
+		if job := failedJob(jobs); job != nil {
+			return newIngestFailedError(ctx, c, transferID, SIPID, job)
+		}
+	}
+	return errors.Errorf("%s %s %s", unitType, unitID, strings.ToLower(status))
+}
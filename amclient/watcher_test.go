@@ -0,0 +1,154 @@
+package amclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatcher_Wait(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var stored int32
+	for i, SIPID := range []string{"2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0", "41699e73-ec9e-4240-b153-71f4155e7da4"} {
+		SIPID := SIPID
+		mux.HandleFunc(fmt.Sprintf("/api/transfer/status/transfer-%d/", i), func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"status": "COMPLETE", "sip_uuid": "%s"}`, SIPID)
+		})
+		mux.HandleFunc(fmt.Sprintf("/api/ingest/status/%s/", SIPID), func(w http.ResponseWriter, r *http.Request) {
+			status := UnitStatusProcessing
+			if atomic.LoadInt32(&stored) == 1 {
+				status = UnitStatusComplete
+			}
+			fmt.Fprintf(w, `{"status": "%s", "type": "SIP", "uuid": "%s"}`, status, SIPID)
+		})
+	}
+
+	w := NewWatcher(client)
+	w.Interval = time.Hour // Only notifications can move the checks forward.
+
+	var wg sync.WaitGroup
+	results := make([]string, 2)
+	for i := range results {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			SIPID, err := w.Wait(ctx, fmt.Sprintf("transfer-%d", i))
+			assert.NoError(t, err)
+			results[i] = SIPID
+		}()
+	}
+
+	assert.Eventually(t, func() bool {
+		return w.Len() == 2 && !w.Notify("unknown") && w.Notify("41699e73-ec9e-4240-b153-71f4155e7da4")
+	}, time.Second, time.Millisecond*10)
+
+	atomic.StoreInt32(&stored, 1)
+	w.Notify("41699e73-ec9e-4240-b153-71f4155e7da4")
+	wg.Wait()
+
+	assert.Equal(t, []string{"2a4ec2be-c4f4-4a4e-bb46-e69cd3d6e0c0", "41699e73-ec9e-4240-b153-71f4155e7da4"}, results)
+	assert.Equal(t, 0, w.Len())
+	assert.Eventually(t, func() bool {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return !w.running
+	}, time.Second, time.Millisecond*10)
+}
+
+func TestWatcher_Wait_canceled(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/transfer/status/transfer/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status": "PROCESSING"}`)
+	})
+
+	w := NewWatcher(client)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	_, err := w.Wait(ctx, "transfer")
+
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 0, w.Len())
+}
+
+func TestWatcher_Wait_maxWait(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/transfer/status/transfer/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	w := NewWatcher(client)
+	w.Interval = time.Millisecond * 10
+	w.MaxWait = time.Millisecond * 50
+
+	_, err := w.Wait(ctx, "transfer")
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "transfer transfer not stored after 50ms: TransferService.Status request failed")
+}
+
+func TestWatcher_Wait_unauthorized(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/transfer/status/transfer/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+
+	w := NewWatcher(client)
+	w.Interval = time.Millisecond * 10
+
+	_, err := w.Wait(ctx, "transfer")
+
+	var errResp *ErrorResponse
+	assert.True(t, errors.As(err, &errResp))
+	assert.Equal(t, ErrorKindAuth, errResp.Kind)
+	assert.Equal(t, 0, w.Len())
+}
+
+func TestWatcher_ActiveJobs(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/api/v2beta/jobs/transfer/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"uuid": "1", "status": "COMPLETE"}, {"uuid": "2", "status": "PROCESSING"}]`)
+	})
+	mux.HandleFunc("/api/v2beta/jobs/sip/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"uuid": "3", "status": "PROCESSING"}, {"uuid": "4", "status": "PROCESSING"}, {"uuid": "5", "status": "USER_INPUT"}]`)
+	})
+
+	mux.HandleFunc("/api/transfer/status/transfer/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status": "PROCESSING"}`)
+	})
+	mux.HandleFunc("/api/ingest/status/sip/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status": "PROCESSING"}`)
+	})
+
+	w := NewWatcher(client)
+	w.watches["transfer"] = &watch{transferID: "transfer", deadline: time.Now().Add(time.Hour)}
+	w.watches["ingested"] = &watch{transferID: "ingested", SIPID: "sip", deadline: time.Now().Add(time.Hour)}
+
+	// The jobs are counted by the checks.
+	active, err := w.ActiveJobs()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, active)
+
+	w.poll()
+	active, err = w.ActiveJobs()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, active)
+}
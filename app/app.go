@@ -49,6 +49,7 @@ func RootCommand(out, stderr io.Writer) *cobra.Command {
 	cmd.AddCommand(NewCmdConfig(out, config))
 	cmd.AddCommand(NewCmdVersion(out))
 	cmd.AddCommand(NewCmdServer(logrus.WithField("cmd", "server"), config))
+	cmd.AddCommand(NewCmdProcessingConfig(out, logrus.WithField("cmd", "processing-config"), config))
 
 	cmd.PersistentFlags().StringVarP(&verbosityLevel, "verbosity", "v", "", "Log level (debug, info, warn, error, fatal, panic)")
 	cmd.PersistentFlags().StringVarP(&configFile, "config", "c", "", "Configuration file")
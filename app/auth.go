@@ -0,0 +1,43 @@
+package app
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+const authRealm = "rdss-archivematica-channel-adapter"
+
+// httpAuth rejects the requests that do not carry valid credentials: the user
+// and the password sent with basic authentication, or the bearer token. Empty
+// credentials are never valid, so e.g. basic authentication is not accepted
+// when the user is empty.
+func httpAuth(user, password, token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); ok && user != "" && secureEqual(u, user) && secureEqual(p, password) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		const prefix = "Bearer "
+		if auth := r.Header.Get("Authorization"); token != "" && strings.HasPrefix(auth, prefix) && secureEqual(strings.TrimPrefix(auth, prefix), token) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if user != "" {
+			w.Header().Add("WWW-Authenticate", `Basic realm="`+authRealm+`"`)
+		}
+		if token != "" {
+			w.Header().Add("WWW-Authenticate", `Bearer realm="`+authRealm+`"`)
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// bearerAuth rejects the requests that do not carry the given bearer token.
+func bearerAuth(token string, next http.Handler) http.Handler {
+	return httpAuth("", "", token, next)
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
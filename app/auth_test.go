@@ -0,0 +1,48 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPAuth(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	tests := []struct {
+		name                  string
+		user, password, token string
+		header                string
+		want                  int
+	}{
+		{"no credentials", "", "", "s3cr3t", "", http.StatusUnauthorized},
+		{"no scheme", "", "", "s3cr3t", "s3cr3t", http.StatusUnauthorized},
+		{"empty token", "", "", "s3cr3t", "Bearer ", http.StatusUnauthorized},
+		{"short token", "", "", "s3cr3t", "Bearer s3cr3", http.StatusUnauthorized},
+		{"long token", "", "", "s3cr3t", "Bearer s3cr3tt", http.StatusUnauthorized},
+		{"token", "", "", "s3cr3t", "Bearer s3cr3t", http.StatusNoContent},
+		{"basic without user", "", "", "s3cr3t", "Basic Og==", http.StatusUnauthorized}, // ":"
+		{"basic", "user", "pass", "", "Basic dXNlcjpwYXNz", http.StatusNoContent},       // "user:pass"
+		{"basic wrong password", "user", "pass", "", "Basic dXNlcjpwYXN0", http.StatusUnauthorized},
+		{"bearer without token", "user", "pass", "", "Bearer ", http.StatusUnauthorized},
+		{"either basic", "user", "pass", "s3cr3t", "Basic dXNlcjpwYXNz", http.StatusNoContent},
+		{"either bearer", "user", "pass", "s3cr3t", "Bearer s3cr3t", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			httpAuth(tt.user, tt.password, tt.token, next).ServeHTTP(rec, req)
+			if have := rec.Code; have != tt.want {
+				t.Errorf("httpAuth(); want %d, have %d", tt.want, have)
+			}
+			if rec.Code == http.StatusUnauthorized && len(rec.Header()["Www-Authenticate"]) == 0 {
+				t.Errorf("httpAuth(); challenge missing")
+			}
+		})
+	}
+}
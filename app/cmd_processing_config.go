@@ -0,0 +1,179 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/adapter"
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/amclient"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func NewCmdProcessingConfig(out io.Writer, logger logrus.FieldLogger, config *Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "processing-config",
+		Short: "Manage the processing configurations of the pipelines",
+	}
+
+	var (
+		name   string
+		dryRun bool
+	)
+	sync := &cobra.Command{
+		Use:   "sync FILE",
+		Short: "Install a processing configuration in the pipelines of all the tenants",
+		Long: `Install a processing configuration in the pipelines of all the tenants.
+
+The configuration is compared with the one of each pipeline and the decision
+points that differ are reported. The Dashboard API cannot update processing
+configurations, so the file is written as <name>ProcessingMCP.xml in the
+processingConfigDir of the pipelines that drifted, i.e. the directory
+sharedMicroserviceTasksConfigs/processingMCPConfigs of their shared directory.
+The command fails if any pipeline drifted and could not be updated.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return doProcessingConfigSync(out, logger, config, args[0], name, dryRun)
+		},
+	}
+	sync.Flags().StringVar(&name, "name", "automated", "Name of the processing configuration")
+	sync.Flags().BoolVar(&dryRun, "dry-run", false, "Only report the pipelines that drifted")
+	cmd.AddCommand(sync)
+
+	return cmd
+}
+
+func doProcessingConfigSync(out io.Writer, logger logrus.FieldLogger, config *Config, path, name string, dryRun bool) error {
+	doc, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if _, err := amclient.ParseProcessingConfig(bytes.NewReader(doc)); err != nil {
+		return errors.Wrapf(err, "processing configuration %s cannot be parsed", path)
+	}
+
+	sess, err := awsSession(logger, config.AWS.DynamoDBProfile, config.AWS.DynamoDBEndpoint)
+	if err != nil {
+		return err
+	}
+	secrets, err := config.SecretResolver(logger)
+	if err != nil {
+		return err
+	}
+	registry, err := adapter.NewRegistryFromSource(logger, config.RegistrySource(dynamodb.New(sess)),
+		adapter.WithPipelinePolicy(config.PipelinePolicy()),
+		adapter.WithSecretResolver(secrets))
+	if err != nil {
+		return err
+	}
+	defer registry.Stop()
+
+	return syncProcessingConfig(context.Background(), out, registry.Pipelines(), name, doc, dryRun)
+}
+
+// syncProcessingConfig compares the processing configuration of the pipelines
+// with the document given, reporting each pipeline. The document is installed
+// in the pipelines that drifted unless dryRun is set or their processing
+// configuration directory is not known.
+func syncProcessingConfig(ctx context.Context, out io.Writer, pipelines map[uint64][]adapter.Pipeline, name string, doc []byte, dryRun bool) error {
+	want, err := amclient.ParseProcessingConfig(bytes.NewReader(doc))
+	if err != nil {
+		return err
+	}
+	tenantIDs := make([]uint64, 0, len(pipelines))
+	for tenantID := range pipelines {
+		tenantIDs = append(tenantIDs, tenantID)
+	}
+	sort.Slice(tenantIDs, func(i, j int) bool { return tenantIDs[i] < tenantIDs[j] })
+
+	var drifted, failed int
+	for _, tenantID := range tenantIDs {
+		for _, p := range pipelines[tenantID] {
+			c := p.Client
+			fmt.Fprintf(out, "tenant %d, pipeline %s (%s): ", tenantID, p.ID, c.BaseURL)
+
+			var diff []amclient.ProcessingConfigDifference
+			current, _, err := c.ProcessingConfig.Get(ctx, name)
+			var errResp *amclient.ErrorResponse
+			switch {
+			case err == nil:
+				got, err := current.Decode()
+				if err != nil {
+					failed++
+					fmt.Fprintf(out, "error: %v\n", err)
+					continue
+				}
+				diff = got.Diff(want)
+			case errors.As(err, &errResp) && errResp.Kind == amclient.ErrorKindNotFound:
+				diff = (&amclient.ProcessingMCP{}).Diff(want)
+			default:
+				failed++
+				fmt.Fprintf(out, "error: %v\n", err)
+				continue
+			}
+
+			if len(diff) == 0 {
+				fmt.Fprintln(out, "in sync")
+				continue
+			}
+			fmt.Fprintf(out, "%d choices differ", len(diff))
+			switch {
+			case dryRun:
+				drifted++
+				fmt.Fprintln(out)
+			case p.ProcessingConfigDir == "":
+				drifted++
+				fmt.Fprintln(out, ", processingConfigDir not set")
+			default:
+				if err := installProcessingConfig(p.ProcessingConfigDir, name, doc); err != nil {
+					failed++
+					fmt.Fprintf(out, ", error: %v\n", err)
+				} else {
+					fmt.Fprintln(out, ", updated")
+				}
+			}
+			for _, d := range diff {
+				fmt.Fprintf(out, "    %s: want %q, got %q\n", d.AppliesTo, d.Want, d.Got)
+			}
+		}
+	}
+
+	switch {
+	case failed > 0:
+		return errors.Errorf("%d pipelines could not be synchronized", failed)
+	case drifted > 0:
+		return errors.Errorf("%d pipelines drifted, install %sProcessingMCP.xml in their shared directory", drifted, name)
+	}
+	return nil
+}
+
+// installProcessingConfig writes the processing configuration document in the
+// directory where the pipeline reads them. The file is replaced atomically so
+// the pipeline never reads a partial document.
+func installProcessingConfig(dir, name string, doc []byte) error {
+	f, err := ioutil.TempFile(dir, "."+name+"ProcessingMCP.xml.*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(doc); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(dir, name+"ProcessingMCP.xml"))
+}
@@ -0,0 +1,98 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/adapter"
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/amclient"
+)
+
+func TestSyncProcessingConfig(t *testing.T) {
+	const current = `<processingMCP>
+  <preconfiguredChoices>
+    <preconfiguredChoice>
+      <appliesTo>56eebd45-5600-4768-a8c2-ec0114555a3d</appliesTo>
+      <goToChain>e9eaef1e-c2e0-4e3b-b942-bfb537162795</goToChain>
+    </preconfiguredChoice>
+  </preconfiguredChoices>
+</processingMCP>`
+	drifted := strings.Replace(current, "e9eaef1e", "00000000", 1)
+
+	pipeline := func(doc string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method != "GET":
+				t.Errorf("unexpected %s request", r.Method)
+			case doc == "":
+				w.WriteHeader(http.StatusNotFound)
+			default:
+				fmt.Fprint(w, doc)
+			}
+		}))
+	}
+	inSync, missing := pipeline(current), pipeline("")
+	defer inSync.Close()
+	defer missing.Close()
+	dir, err := ioutil.TempDir("", "processingMCPConfigs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pipelines := map[uint64][]adapter.Pipeline{
+		1: {{ID: "default", Client: amclient.NewClient(nil, inSync.URL, "", ""), ProcessingConfigDir: dir}},
+		2: {{ID: "default", Client: amclient.NewClient(nil, missing.URL, "", "")}},
+	}
+
+	out := &bytes.Buffer{}
+	err = syncProcessingConfig(context.Background(), out, pipelines, "automated", []byte(drifted), true)
+	if err == nil || err.Error() != "2 pipelines drifted, install automatedProcessingMCP.xml in their shared directory" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	wantOut := fmt.Sprintf(`tenant 1, pipeline default (%s): 1 choices differ
+    56eebd45-5600-4768-a8c2-ec0114555a3d: want "00000000-c2e0-4e3b-b942-bfb537162795", got "e9eaef1e-c2e0-4e3b-b942-bfb537162795"
+tenant 2, pipeline default (%s): 1 choices differ
+    56eebd45-5600-4768-a8c2-ec0114555a3d: want "00000000-c2e0-4e3b-b942-bfb537162795", got ""
+`, inSync.URL, missing.URL)
+	if out.String() != wantOut {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", out, wantOut)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "automatedProcessingMCP.xml")); !os.IsNotExist(err) {
+		t.Errorf("processing configuration installed in a dry run: %v", err)
+	}
+
+	// The pipeline that knows its processing configuration directory is
+	// updated, the other one can only be reported.
+	out.Reset()
+	err = syncProcessingConfig(context.Background(), out, pipelines, "automated", []byte(drifted), false)
+	if err == nil || err.Error() != "1 pipelines drifted, install automatedProcessingMCP.xml in their shared directory" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(out.String(), fmt.Sprintf("tenant 1, pipeline default (%s): 1 choices differ, updated\n", inSync.URL)) ||
+		!strings.Contains(out.String(), fmt.Sprintf("tenant 2, pipeline default (%s): 1 choices differ, processingConfigDir not set\n", missing.URL)) {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	if blob, err := ioutil.ReadFile(filepath.Join(dir, "automatedProcessingMCP.xml")); err != nil || string(blob) != drifted {
+		t.Errorf("unexpected processing configuration installed: %q (%v)", blob, err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("temporary files left behind: %d files", len(files))
+	}
+
+	out.Reset()
+	err = syncProcessingConfig(context.Background(), out, pipelines, "automated", []byte(current), false)
+	if err == nil || err.Error() != "1 pipelines drifted, install automatedProcessingMCP.xml in their shared directory" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(out.String(), fmt.Sprintf("tenant 1, pipeline default (%s): in sync\n", inSync.URL)) {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
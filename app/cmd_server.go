@@ -1,16 +1,17 @@
 package app
 
 import (
+	"context"
 	"fmt"
-	"net"
 	"net/http"
-	"net/http/pprof"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/JiscSD/rdss-archivematica-channel-adapter/adapter"
 	"github.com/JiscSD/rdss-archivematica-channel-adapter/broker"
 	"github.com/JiscSD/rdss-archivematica-channel-adapter/broker/message"
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/health"
 	"github.com/JiscSD/rdss-archivematica-channel-adapter/s3"
 	"github.com/JiscSD/rdss-archivematica-channel-adapter/version"
 
@@ -37,14 +38,19 @@ func NewCmdServer(logger logrus.FieldLogger, config *Config) *cobra.Command {
 }
 
 func doServer(logger logrus.FieldLogger, config *Config) error {
-	var registry *adapter.Registry
-	var g run.Group
+	var (
+		a        *adapter.Adapter
+		registry *adapter.Registry
+		monitor  *health.Monitor
+		g        run.Group
+	)
+	creds, err := resolveHTTPCredentials(logger, config)
+	if err != nil {
+		return err
+	}
 	{
-		var (
-			a   *adapter.Adapter
-			err error
-		)
-		a, registry, err = server(logger, config)
+		var err error
+		a, registry, monitor, err = server(logger, config)
 		if err != nil {
 			return err
 		}
@@ -57,40 +63,82 @@ func doServer(logger logrus.FieldLogger, config *Config) error {
 		})
 	}
 	{
-		ln, err := net.Listen("tcp", ":6060")
+		g.Add(func() error {
+			monitor.Run()
+			return nil
+		}, func(error) {
+			monitor.Stop()
+		})
+	}
+	{
+		ln, err := listenHTTP(config.HTTP.ListenAddr, config)
 		if err != nil {
 			return err
 		}
-		logger.WithField("addr", ln.Addr().String()).Info("HTTP server listening")
+		logger.WithFields(logrus.Fields{
+			"addr": ln.Addr().String(),
+			"tls":  config.HTTP.TLSCertFile != "",
+		}).Info("HTTP server listening")
 
 		g.Add(func() error {
 			mux := http.NewServeMux()
 
-			// Health check.
-			mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-				w.WriteHeader(http.StatusOK)
+			// Health checks: liveness, readiness and the status of each
+			// component. The probes are not authenticated. /health always
+			// responds 200 as it did before the readiness checks existed, it
+			// mentions the readiness along with the state of the breakers.
+			mux.Handle("/health/live", monitor.LiveHandler())
+			mux.Handle("/health/ready", monitor.ReadyHandler())
+			mux.Handle("/status", creds.protect(monitor.StatusHandler()))
+			mux.Handle("/health", creds.protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				fmt.Fprintln(w, "OK")
-			})
+				if !monitor.Status().Ready {
+					fmt.Fprintln(w, "NOT READY, see /health/ready")
+				}
+				for _, h := range registry.Health() {
+					fmt.Fprintf(w, "tenant %d, pipeline %s (%s): breaker %s", h.TenantJiscID, h.PipelineID, h.URL, h.Breaker)
+					if h.StorageServiceURL != "" {
+						fmt.Fprintf(w, ", storage service (%s): breaker %s", h.StorageServiceURL, h.StorageServiceBreaker)
+					}
+					fmt.Fprintln(w)
+				}
+			})))
 
 			// Prometheus metrics.
-			mux.Handle("/metrics", promhttp.Handler())
-
-			// Profiling data.
-			mux.HandleFunc("/debug/pprof/", pprof.Index)
-			mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
-			mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
-			mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
-			mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
-			mux.Handle("/debug/pprof/block", pprof.Handler("block"))
-			mux.Handle("/debug/pprof/goroutine", pprof.Handler("goroutine"))
-			mux.Handle("/debug/pprof/heap", pprof.Handler("heap"))
-			mux.Handle("/debug/pprof/threadcreate", pprof.Handler("threadcreate"))
+			mux.Handle("/metrics", creds.protect(promhttp.Handler()))
+
+			// Post-store callbacks of the Archivematica Storage Service.
+			if config.Adapter.CompletionWebhook {
+				mux.Handle("/webhooks/aip-stored/", creds.protect(a.CompletionWebhook()))
+			}
+
+			// Admin API, authenticated with the admin token.
+			if creds.admin != "" {
+				mux.Handle("/admin/", http.StripPrefix("/admin", bearerAuth(creds.admin, a.AdminAPI())))
+			}
 
 			return http.Serve(ln, mux)
 		}, func(error) {
 			ln.Close()
 		})
 	}
+	if addr := config.HTTP.DebugListenAddr; addr != "" {
+		ln, err := listenHTTP(addr, config)
+		if err != nil {
+			return err
+		}
+		logger.WithFields(logrus.Fields{
+			"addr": ln.Addr().String(),
+			"tls":  config.HTTP.TLSCertFile != "",
+		}).Info("HTTP debug server listening")
+
+		// Profiling data.
+		g.Add(func() error {
+			return http.Serve(ln, creds.protect(debugHandler()))
+		}, func(error) {
+			ln.Close()
+		})
+	}
 	{
 		cancel := make(chan struct{})
 
@@ -106,7 +154,7 @@ func doServer(logger logrus.FieldLogger, config *Config) error {
 	return g.Run()
 }
 
-func server(logger logrus.FieldLogger, config *Config) (*adapter.Adapter, *adapter.Registry, error) {
+func server(logger logrus.FieldLogger, config *Config) (*adapter.Adapter, *adapter.Registry, *health.Monitor, error) {
 	incomingMessages := prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace: "rdss_archivematica_channel_adapter",
 		Name:      "incoming_messages_total",
@@ -118,35 +166,41 @@ func server(logger logrus.FieldLogger, config *Config) (*adapter.Adapter, *adapt
 	{
 		sess, err := awsSession(logger, config.AWS.DynamoDBProfile, config.AWS.DynamoDBEndpoint)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
 		dynamodbClient = dynamodb.New(sess)
 	}
 
-	var brClient *broker.Broker
+	var (
+		brClient  *broker.Broker
+		sqsClient *sqs.SQS
+		snsClient *sns.SNS
+		valCheck  health.Check
+	)
 	{
 		sess, err := awsSession(logger, config.AWS.SQSProfile, config.AWS.SQSEndpoint)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
-		sqsClient := sqs.New(sess)
+		sqsClient = sqs.New(sess)
 
 		sess, err = awsSession(logger, config.AWS.SNSProfile, config.AWS.SNSEndpoint)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
-		snsClient := sns.New(sess)
+		snsClient = sns.New(sess)
 
 		var valsvc message.Validator = &message.NoOpValidatorImpl{}
 		if config.Adapter.ValidationServiceAddr != "" {
-			valsvc, err = message.NewJiscValidator(
+			jisc, err := message.NewJiscValidator(
 				config.Adapter.ValidationServiceAddr,
 				version.AppVersion(),
 				message.Version,
 			)
 			if err != nil {
-				return nil, nil, err
+				return nil, nil, nil, err
 			}
+			valsvc, valCheck = jisc, jisc.Ping
 		}
 
 		brClient = broker.New(
@@ -161,7 +215,7 @@ func server(logger logrus.FieldLogger, config *Config) (*adapter.Adapter, *adapt
 	{
 		sess, err := awsSession(logger, config.AWS.S3Profile, config.AWS.S3Endpoint)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
 		s3Client = s3.New(sess)
 	}
@@ -175,13 +229,37 @@ func server(logger logrus.FieldLogger, config *Config) (*adapter.Adapter, *adapt
 	{
 		var err error
 		logger := logger.WithField("component", "registry")
-		registry, err = adapter.NewRegistry(logger, dynamodbClient, config.Adapter.RegistryTable)
+		secrets, err := config.SecretResolver(logger)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		registry, err = adapter.NewRegistryFromSource(logger, config.RegistrySource(dynamodbClient),
+			adapter.WithPipelinePolicy(config.PipelinePolicy()),
+			adapter.WithSecretResolver(secrets))
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		registry.ValidateProcessingConfigs(ctx)
+		prometheus.MustRegister(registry)
 	}
 
-	return adapter.New(logger, brClient, s3Client, storage, registry), registry, nil
+	a := adapter.New(logger, brClient, s3Client, storage, registry).
+		WithFixityAudit(config.Adapter.FixityCheckInterval).
+		WithCompletionInterval(config.Adapter.CompletionInterval).
+		WithCleanup(config.Adapter.CleanupCompleted).
+		WithJanitor(config.Adapter.JanitorInterval, config.Adapter.JanitorMaxAge)
+
+	monitor := healthMonitor(logger.WithField("component", "health"), config, healthChecks{
+		registry:  registry,
+		dynamodb:  dynamodbClient,
+		sqs:       sqsClient,
+		sns:       snsClient,
+		validator: valCheck,
+	})
+
+	return a, registry, monitor, nil
 }
 
 type logrusProxy struct {
@@ -3,8 +3,14 @@ package app
 import (
 	"io/ioutil"
 	"strings"
+	"time"
 
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/adapter"
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/amclient"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
@@ -45,6 +51,21 @@ repository_table = "rdss_archivematica_adapter_local_data_repository"
 #
 registry_table = "rdss_archivematica_adapter_registry"
 
+#
+# Local file used to store the Archivematica registry instead of the DynamoDB
+# table, e.g. "/etc/archivematica/registry.toml". TOML, YAML and JSON files are
+# supported. The file is reloaded when it changes.
+#
+registry_file = ""
+
+#
+# How long the keys of the pipelines are cached, e.g. "5m", when the registry
+# holds references to them instead of the keys: "env:NAME" (environment
+# variable), "file:/path" (file contents) or the ARN of a Secrets Manager
+# secret or a SSM parameter.
+#
+secret_refresh_interval = "5m"
+
 #
 # AWS SQS queue URL, e.g. "https://queue.amazonaws.com/80398EXAMPLE/MyQueue".
 #
@@ -70,6 +91,138 @@ queue_send_invalid_addr = ""
 #
 validation_service_addr = ""
 
+#
+# Frequency of the fixity audits of the AIPs stored, e.g. "24h". The adapter
+# asks the Storage Service of each tenant to check the fixity of their AIPs and
+# publishes the results as preservation events. Disabled when zero.
+#
+fixity_check_interval = "0"
+
+#
+# Interval between the checks of the transfers in progress in each pipeline,
+# e.g. "30s". The default interval (10s) is used when zero.
+#
+completion_check_interval = "0"
+
+#
+# Receive the post-store callbacks of the Archivematica Storage Service in the
+# HTTP server, i.e. "/webhooks/aip-stored/<package_uuid>", which speed up the
+# detection of the AIPs stored.
+#
+completion_webhook = false
+
+#
+# Remove the transfers and the SIPs from the Archivematica Dashboard once their
+# AIPs are stored, and delete the transfer source directories.
+#
+cleanup_completed = false
+
+#
+# Frequency of the sweeps of the transfer directories, e.g. "1h". The
+# directories of the transfer sessions that have not been modified for longer
+# than janitor_max_age are removed, e.g. left behind when the adapter crashed.
+# The maximum age should be longer than any transfer takes to be stored.
+# Disabled when zero.
+#
+janitor_interval = "0"
+janitor_max_age = "72h"
+
+#
+# Token of the admin API served under "/admin/" by the HTTP server, sent by the
+# clients as "Authorization: Bearer <token>". References to the token are
+# accepted as in secret_refresh_interval, e.g. "env:ADMIN_TOKEN". The API is
+# disabled when empty.
+#
+admin_token = ""
+
+################################## ARCHIVEMATICA ##############################
+
+[archivematica]
+
+#
+# Time to wait for the response headers of the pipelines, e.g. "1m". Disabled
+# when zero.
+#
+response_timeout = "1m"
+
+#
+# Retries of the idempotent requests that fail because a pipeline is not
+# available, i.e. network errors, timeouts and server errors. The wait between
+# retries starts at retry_interval and grows up to retry_max_interval.
+# Disabled when max_retries is zero.
+#
+max_retries = 3
+retry_interval = "1s"
+retry_max_interval = "30s"
+
+#
+# Maximum number of requests per second sent to each pipeline and the size of
+# the bursts allowed. Disabled when zero.
+#
+rate_limit = 0.0
+rate_limit_burst = 10
+
+#
+# Number of consecutive failures after which the requests to a pipeline are
+# rejected, and for how long. Disabled when zero.
+#
+breaker_threshold = 5
+breaker_cooldown = "30s"
+
+################################## HTTP #######################################
+
+[http]
+
+#
+# Address of the HTTP server that serves the health checks, the metrics, the
+# webhooks and the admin API.
+#
+listen_addr = ":6060"
+
+#
+# Certificate and private key files (PEM) used to serve HTTPS instead of HTTP.
+# Both must be set, HTTP is used when empty.
+#
+tls_cert_file = ""
+tls_key_file = ""
+
+#
+# Credentials required by the HTTP server: a user and password sent with basic
+# authentication, or a bearer token. Either is accepted when both are set. The
+# password and the token can be references as in
+# adapter.secret_refresh_interval, e.g. "env:HTTP_TOKEN". The health probes
+# ("/health/live" and "/health/ready") are not authenticated and the admin API
+# uses adapter.admin_token. Disabled when empty.
+#
+auth_user = ""
+auth_password = ""
+auth_token = ""
+
+#
+# Address of the HTTP server that serves the runtime profiling data under
+# "/debug/pprof/", e.g. "127.0.0.1:6061". It uses the same TLS settings and
+# credentials. Disabled when empty.
+#
+debug_listen_addr = ""
+
+################################## HEALTH #####################################
+
+[health]
+
+#
+# Interval between the checks of the services and resources used by the
+# adapter, e.g. "30s", and the time given to each check. The results are
+# reported by the HTTP server, see "/health/ready" and "/status".
+#
+check_interval = "30s"
+check_timeout = "10s"
+
+#
+# Free space in bytes required in the transfer directories, e.g. 10737418240
+# (10 GiB). Disabled when zero.
+#
+min_free_space = 0
+
 ################################## AWS ########################################
 
 [aws]
@@ -85,6 +238,10 @@ sqs_endpoint = ""
 
 sns_profile = ""
 sns_endpoint = ""
+
+# Used by Secrets Manager and SSM, see adapter.secret_refresh_interval.
+secrets_profile = ""
+secrets_endpoint = ""
 `
 
 type Config struct {
@@ -96,16 +253,52 @@ type Config struct {
 	} `mapstructure:"logging"`
 
 	Adapter struct {
-		RepositoryTable       string `mapstructure:"repository_table"`
-		ProcessingTable       string `mapstructure:"processing_table"`
-		RegistryTable         string `mapstructure:"registry_table"`
-		QueueRecvMainAddr     string `mapstructure:"queue_recv_main_addr"`
-		QueueSendMainAddr     string `mapstructure:"queue_send_main_addr"`
-		QueueSendErrorAddr    string `mapstructure:"queue_send_error_addr"`
-		QueueSendInvalidAddr  string `mapstructure:"queue_send_invalid_addr"`
-		ValidationServiceAddr string `mapstructure:"validation_service_addr"`
+		RepositoryTable       string        `mapstructure:"repository_table"`
+		ProcessingTable       string        `mapstructure:"processing_table"`
+		RegistryTable         string        `mapstructure:"registry_table"`
+		RegistryFile          string        `mapstructure:"registry_file"`
+		SecretRefreshInterval time.Duration `mapstructure:"secret_refresh_interval"`
+		QueueRecvMainAddr     string        `mapstructure:"queue_recv_main_addr"`
+		QueueSendMainAddr     string        `mapstructure:"queue_send_main_addr"`
+		QueueSendErrorAddr    string        `mapstructure:"queue_send_error_addr"`
+		QueueSendInvalidAddr  string        `mapstructure:"queue_send_invalid_addr"`
+		ValidationServiceAddr string        `mapstructure:"validation_service_addr"`
+		FixityCheckInterval   time.Duration `mapstructure:"fixity_check_interval"`
+		CompletionInterval    time.Duration `mapstructure:"completion_check_interval"`
+		CompletionWebhook     bool          `mapstructure:"completion_webhook"`
+		CleanupCompleted      bool          `mapstructure:"cleanup_completed"`
+		JanitorInterval       time.Duration `mapstructure:"janitor_interval"`
+		JanitorMaxAge         time.Duration `mapstructure:"janitor_max_age"`
+		AdminToken            string        `mapstructure:"admin_token"`
 	} `mapstructure:"adapter"`
 
+	Archivematica struct {
+		ResponseTimeout  time.Duration `mapstructure:"response_timeout"`
+		MaxRetries       int           `mapstructure:"max_retries"`
+		RetryInterval    time.Duration `mapstructure:"retry_interval"`
+		RetryMaxInterval time.Duration `mapstructure:"retry_max_interval"`
+		RateLimit        float64       `mapstructure:"rate_limit"`
+		RateLimitBurst   int           `mapstructure:"rate_limit_burst"`
+		BreakerThreshold int           `mapstructure:"breaker_threshold"`
+		BreakerCooldown  time.Duration `mapstructure:"breaker_cooldown"`
+	} `mapstructure:"archivematica"`
+
+	HTTP struct {
+		ListenAddr      string `mapstructure:"listen_addr"`
+		TLSCertFile     string `mapstructure:"tls_cert_file"`
+		TLSKeyFile      string `mapstructure:"tls_key_file"`
+		AuthUser        string `mapstructure:"auth_user"`
+		AuthPassword    string `mapstructure:"auth_password"`
+		AuthToken       string `mapstructure:"auth_token"`
+		DebugListenAddr string `mapstructure:"debug_listen_addr"`
+	} `mapstructure:"http"`
+
+	Health struct {
+		CheckInterval time.Duration `mapstructure:"check_interval"`
+		CheckTimeout  time.Duration `mapstructure:"check_timeout"`
+		MinFreeSpace  uint64        `mapstructure:"min_free_space"`
+	} `mapstructure:"health"`
+
 	AWS struct {
 		S3Profile        string `mapstructure:"s3_profile"`
 		S3Endpoint       string `mapstructure:"s3_endpoint"`
@@ -115,11 +308,59 @@ type Config struct {
 		SQSEndpoint      string `mapstructure:"sqs_endpoint"`
 		SNSProfile       string `mapstructure:"sns_profile"`
 		SNSEndpoint      string `mapstructure:"sns_endpoint"`
+		SecretsProfile   string `mapstructure:"secrets_profile"`
+		SecretsEndpoint  string `mapstructure:"secrets_endpoint"`
 	} `mapstructure:"aws"`
 }
 
+// PipelinePolicy returns the configuration of the clients of the pipelines.
+func (c Config) PipelinePolicy() adapter.PipelinePolicy {
+	return adapter.PipelinePolicy{
+		ResponseTimeout: c.Archivematica.ResponseTimeout,
+		Retry: amclient.RetryPolicy{
+			MaxRetries:      c.Archivematica.MaxRetries,
+			InitialInterval: c.Archivematica.RetryInterval,
+			MaxInterval:     c.Archivematica.RetryMaxInterval,
+		},
+		RateLimit:        c.Archivematica.RateLimit,
+		RateLimitBurst:   c.Archivematica.RateLimitBurst,
+		BreakerThreshold: c.Archivematica.BreakerThreshold,
+		BreakerCooldown:  c.Archivematica.BreakerCooldown,
+	}
+}
+
+// RegistrySource returns the source of the registry: the local file when it is
+// configured, the DynamoDB table otherwise.
+func (c Config) RegistrySource(dynamodbClient dynamodbiface.DynamoDBAPI) adapter.RegistrySource {
+	if c.Adapter.RegistryFile != "" {
+		return adapter.NewFileRegistrySource(c.Adapter.RegistryFile)
+	}
+	return adapter.NewDynamoDBRegistrySource(dynamodbClient, c.Adapter.RegistryTable)
+}
+
+// SecretResolver returns the resolver of the keys of the pipelines.
+func (c Config) SecretResolver(logger logrus.FieldLogger) (*adapter.SecretResolver, error) {
+	sess, err := awsSession(logger, c.AWS.SecretsProfile, c.AWS.SecretsEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	return adapter.NewSecretResolver(logger, sess, c.Adapter.SecretRefreshInterval), nil
+}
+
 func (c Config) Validate() error {
-	return nil // TODO
+	if c.HTTP.ListenAddr == "" {
+		return errors.New("http.listen_addr is empty")
+	}
+	if c.HTTP.ListenAddr == c.HTTP.DebugListenAddr {
+		return errors.New("http.debug_listen_addr must be different from http.listen_addr")
+	}
+	if (c.HTTP.TLSCertFile == "") != (c.HTTP.TLSKeyFile == "") {
+		return errors.New("http.tls_cert_file and http.tls_key_file must be set together")
+	}
+	if (c.HTTP.AuthUser == "") != (c.HTTP.AuthPassword == "") {
+		return errors.New("http.auth_user and http.auth_password must be set together")
+	}
+	return nil
 }
 
 func (c Config) String() string {
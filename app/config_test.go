@@ -0,0 +1,30 @@
+package app
+
+import (
+	"testing"
+)
+
+func TestConfigValidate(t *testing.T) {
+	valid := func() *Config {
+		c := &Config{}
+		c.HTTP.ListenAddr = ":6060"
+		return c
+	}
+	if err := valid().Validate(); err != nil {
+		t.Fatalf("Validate(): %v", err)
+	}
+	for name, fn := range map[string]func(*Config){
+		"no listen address":     func(c *Config) { c.HTTP.ListenAddr = "" },
+		"same debug address":    func(c *Config) { c.HTTP.DebugListenAddr = ":6060" },
+		"certificate only":      func(c *Config) { c.HTTP.TLSCertFile = "cert.pem" },
+		"key only":              func(c *Config) { c.HTTP.TLSKeyFile = "key.pem" },
+		"user without password": func(c *Config) { c.HTTP.AuthUser = "user" },
+		"password without user": func(c *Config) { c.HTTP.AuthPassword = "pass" },
+	} {
+		c := valid()
+		fn(c)
+		if err := c.Validate(); err == nil {
+			t.Errorf("Validate() with %s; error expected", name)
+		}
+	}
+}
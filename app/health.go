@@ -0,0 +1,93 @@
+package app
+
+import (
+	"context"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/adapter"
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/health"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/sirupsen/logrus"
+)
+
+// healthChecks holds the clients of the services checked by the monitor.
+type healthChecks struct {
+	registry  *adapter.Registry
+	dynamodb  dynamodbiface.DynamoDBAPI
+	sqs       sqsiface.SQSAPI
+	sns       snsiface.SNSAPI
+	validator health.Check // Nil when the validation service is not used.
+}
+
+// healthMonitor returns the monitor of the services and the resources used by
+// the server. All of them are critical: the pipelines and the transfer
+// directories are checked as groups, which are up as long as one of their
+// members is.
+func healthMonitor(logger logrus.FieldLogger, config *Config, c healthChecks) *health.Monitor {
+	m := health.NewMonitor(logger, config.Health.CheckInterval, config.Health.CheckTimeout)
+	m.AddGroup("pipelines", true, c.registry.CheckPipelines)
+	m.AddGroup("transfer directories", true, func(ctx context.Context) map[string]error {
+		results := map[string]error{}
+		for _, dir := range c.registry.TransferDirs() {
+			results[dir] = health.CheckDir(dir, config.Health.MinFreeSpace)
+		}
+		return results
+	})
+	tables := []string{config.Adapter.ProcessingTable, config.Adapter.RepositoryTable}
+	if config.Adapter.RegistryFile == "" {
+		tables = append(tables, config.Adapter.RegistryTable)
+	}
+	for _, table := range tables {
+		m.Add("dynamodb:"+table, true, dynamoDBTableCheck(c.dynamodb, table))
+	}
+	if queue := config.Adapter.QueueRecvMainAddr; queue != "" {
+		m.Add("sqs:"+queue, true, sqsQueueCheck(c.sqs, queue))
+	}
+	for _, topic := range []string{
+		config.Adapter.QueueSendMainAddr,
+		config.Adapter.QueueSendErrorAddr,
+		config.Adapter.QueueSendInvalidAddr,
+	} {
+		if topic != "" {
+			m.Add("sns:"+topic, true, snsTopicCheck(c.sns, topic))
+		}
+	}
+	if c.validator != nil {
+		m.Add("validation service", true, c.validator)
+	}
+	return m
+}
+
+func dynamoDBTableCheck(client dynamodbiface.DynamoDBAPI, table string) health.Check {
+	return func(ctx context.Context) error {
+		_, err := client.DescribeTableWithContext(ctx, &dynamodb.DescribeTableInput{
+			TableName: aws.String(table),
+		})
+		return err
+	}
+}
+
+func sqsQueueCheck(client sqsiface.SQSAPI, queueURL string) health.Check {
+	return func(ctx context.Context) error {
+		_, err := client.GetQueueAttributesWithContext(ctx, &sqs.GetQueueAttributesInput{
+			QueueUrl:       aws.String(queueURL),
+			AttributeNames: aws.StringSlice([]string{sqs.QueueAttributeNameQueueArn}),
+		})
+		return err
+	}
+}
+
+func snsTopicCheck(client snsiface.SNSAPI, topicARN string) health.Check {
+	return func(ctx context.Context) error {
+		_, err := client.GetTopicAttributesWithContext(ctx, &sns.GetTopicAttributesInput{
+			TopicArn: aws.String(topicARN),
+		})
+		return err
+	}
+}
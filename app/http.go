@@ -0,0 +1,107 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/JiscSD/rdss-archivematica-channel-adapter/adapter"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// httpCredentials are the credentials of the HTTP servers, resolved when they
+// are secret references.
+type httpCredentials struct {
+	user     string
+	password string
+	token    string
+	admin    string // Admin API.
+}
+
+// resolveHTTPCredentials resolves the credentials configured. The secret
+// resolver is only created when there is something to resolve.
+func resolveHTTPCredentials(logger logrus.FieldLogger, config *Config) (httpCredentials, error) {
+	creds := httpCredentials{user: config.HTTP.AuthUser}
+	refs := []struct {
+		name  string
+		ref   string
+		value *string
+	}{
+		{"http.auth_password", config.HTTP.AuthPassword, &creds.password},
+		{"http.auth_token", config.HTTP.AuthToken, &creds.token},
+		{"adapter.admin_token", config.Adapter.AdminToken, &creds.admin},
+	}
+	var secrets *adapter.SecretResolver
+	for _, item := range refs {
+		if item.ref == "" {
+			continue
+		}
+		var err error
+		if secrets == nil {
+			if secrets, err = config.SecretResolver(logger); err != nil {
+				return creds, err
+			}
+		}
+		*item.value, err = secrets.Resolve(context.Background(), item.ref)
+		if err != nil {
+			return creds, errors.Wrapf(err, "%s cannot be resolved", item.name)
+		}
+		if *item.value == "" {
+			return creds, errors.Errorf("%s is empty", item.name)
+		}
+	}
+	return creds, nil
+}
+
+// protect requires the credentials to access the handler, unless none are
+// configured.
+func (c httpCredentials) protect(h http.Handler) http.Handler {
+	if c.user == "" && c.token == "" {
+		return h
+	}
+	return httpAuth(c.user, c.password, c.token, h)
+}
+
+// listenHTTP listens on the given address, with TLS when the certificate is
+// configured. The certificate is loaded right away so errors are reported on
+// start-up.
+func listenHTTP(addr string, config *Config) (net.Listener, error) {
+	var tlsConfig *tls.Config
+	if config.HTTP.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.HTTP.TLSCertFile, config.HTTP.TLSKeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "TLS certificate cannot be loaded")
+		}
+		tlsConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	return ln, nil
+}
+
+// debugHandler serves the runtime profiling data.
+func debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/pprof/block", pprof.Handler("block"))
+	mux.Handle("/debug/pprof/goroutine", pprof.Handler("goroutine"))
+	mux.Handle("/debug/pprof/heap", pprof.Handler("heap"))
+	mux.Handle("/debug/pprof/threadcreate", pprof.Handler("threadcreate"))
+	return mux
+}
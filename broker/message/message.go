@@ -17,6 +17,9 @@ type Message struct {
 
 	// MessageBody carries the message payload.
 	MessageBody interface{}
+
+	// raw is the JSON document that the message was decoded from.
+	raw json.RawMessage
 }
 
 // New returns a pointer to a new message with a new ID.
@@ -58,6 +61,15 @@ func (m *Message) ID() string {
 	return m.MessageHeader.ID.String()
 }
 
+// Raw returns the JSON document that the message was decoded from. The
+// message is encoded when it has not been decoded before.
+func (m *Message) Raw() ([]byte, error) {
+	if len(m.raw) > 0 {
+		return m.raw, nil
+	}
+	return m.MarshalJSON()
+}
+
 func (m *Message) TagError(err error) {
 	if err == nil {
 		return
@@ -98,7 +110,11 @@ func (m *Message) UnmarshalJSON(data []byte) error {
 		return err
 	}
 	m.MessageBody = typedBody(m.MessageHeader.MessageType, m.MessageHeader.CorrelationID)
-	return json.Unmarshal(msg.MessageBody, m.MessageBody)
+	if err := json.Unmarshal(msg.MessageBody, m.MessageBody); err != nil {
+		return err
+	}
+	m.raw = append(json.RawMessage(nil), data...)
+	return nil
 }
 
 // typedBody returns an interface{} type where the type of the underlying value
@@ -235,6 +235,29 @@ func TestMessage_ID(t *testing.T) {
 	}
 }
 
+func TestMessage_Raw(t *testing.T) {
+	m := New(MessageTypeEnum_MetadataDelete, MessageClassEnum_Command)
+	encoded, err := m.Raw()
+	if err != nil {
+		t.Fatalf("Raw() returned an error: %v", err)
+	}
+
+	// Decoded messages return the original document, e.g. unknown properties
+	// and whitespace are preserved.
+	original := append(encoded[:len(encoded)-1:len(encoded)-1], []byte(`, "unknown": true}`)...)
+	m = &Message{}
+	if err := json.Unmarshal(original, m); err != nil {
+		t.Fatalf("Unmarshal() returned an error: %v", err)
+	}
+	have, err := m.Raw()
+	if err != nil {
+		t.Fatalf("Raw() returned an error: %v", err)
+	}
+	if !bytes.Equal(have, original) {
+		t.Errorf("Raw() unexpected document; have %s, want %s", have, original)
+	}
+}
+
 func TestMessage_TagError(t *testing.T) {
 	m := New(MessageTypeEnum_MetadataCreate, MessageClassEnum_Command)
 	if m.TagError(nil); m.MessageHeader.ErrorCode != "" || m.MessageHeader.ErrorDescription != "" {
@@ -122,6 +122,25 @@ func (v *jiscValidatorImpl) Validate(ctx context.Context, stream []byte) ([]byte
 	return stream, nil
 }
 
+// Ping checks that the service is reachable. The root of the service is not
+// part of its API, so any response other than a server error is accepted.
+func (v *jiscValidatorImpl) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", v.baseURL.String(), nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Add("User-Agent", v.userAgent)
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+	return nil
+}
+
 // request encodes and delivers the HTTP request with exponential backoff.
 func (v *jiscValidatorImpl) request(ctx context.Context, method, urlStr string, requestPayload interface{}) (*http.Response, error) {
 	buf := new(bytes.Buffer)
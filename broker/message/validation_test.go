@@ -343,3 +343,21 @@ func genMessageReqResp(version, messageType, correlationId string) []byte {
 
 	return []byte(message)
 }
+
+func TestValidatorPing(t *testing.T) {
+	t.Parallel()
+
+	status := http.StatusNotFound
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, userAgent, r.Header.Get("User-Agent"))
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	svc, err := message.NewJiscValidator(ts.URL, userAgent, "4.0.0")
+	require.NoError(t, err)
+	assert.NoError(t, svc.Ping(context.Background()))
+
+	status = http.StatusBadGateway
+	assert.EqualError(t, svc.Ping(context.Background()), "unexpected response status 502")
+}
@@ -5,12 +5,12 @@ go 1.15
 require (
 	github.com/aws/aws-sdk-go v1.33.19
 	github.com/cenkalti/backoff/v3 v3.2.2
-	github.com/fsnotify/fsnotify v1.4.9 // indirect
+	github.com/fsnotify/fsnotify v1.4.9
 	github.com/google/uuid v1.1.1
 	github.com/gorilla/schema v1.1.0
-	github.com/mitchellh/mapstructure v1.3.3 // indirect
+	github.com/mitchellh/mapstructure v1.3.3
 	github.com/oklog/run v1.1.0
-	github.com/pelletier/go-toml v1.8.0 // indirect
+	github.com/pelletier/go-toml v1.8.0
 	github.com/pkg/errors v0.9.1
 	github.com/prometheus/client_golang v1.7.1
 	github.com/prometheus/common v0.11.1 // indirect
@@ -23,9 +23,10 @@ require (
 	github.com/spf13/viper v1.7.1
 	github.com/stretchr/objx v0.2.0 // indirect
 	github.com/stretchr/testify v1.5.1
-	golang.org/x/sys v0.0.0-20200805065543-0cf7623e9dbd // indirect
+	golang.org/x/sys v0.0.0-20200805065543-0cf7623e9dbd
 	golang.org/x/text v0.3.3 // indirect
 	golang.org/x/tools v0.0.0-20200804234916-fec4f28ebb08
 	google.golang.org/protobuf v1.25.0 // indirect
 	gopkg.in/ini.v1 v1.57.0 // indirect
+	gopkg.in/yaml.v2 v2.3.0
 )
@@ -0,0 +1,33 @@
+package health
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// CheckDir checks that files can be written in a directory and, unless
+// minFree is zero, that the filesystem has at least minFree bytes available.
+func CheckDir(path string, minFree uint64) error {
+	f, err := ioutil.TempFile(path, ".health-")
+	if err != nil {
+		return errors.Wrap(err, "directory is not writable")
+	}
+	name := f.Name()
+	f.Close()
+	if err := os.Remove(name); err != nil {
+		return errors.Wrap(err, "directory is not writable")
+	}
+	if minFree == 0 {
+		return nil
+	}
+	free, err := freeSpace(path)
+	if err != nil {
+		return errors.Wrap(err, "free space cannot be determined")
+	}
+	if free < minFree {
+		return errors.Errorf("free space is low: %d bytes available, %d required", free, minFree)
+	}
+	return nil
+}
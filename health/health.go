@@ -0,0 +1,291 @@
+// Package health checks the services and the resources used by the adapter.
+//
+// Checks are run periodically by a Monitor, which keeps their latest results
+// and serves them over HTTP: liveness and readiness endpoints meant for
+// orchestrators and a JSON status document describing each component.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Check reports whether a component works. It returns nil when it does.
+type Check func(ctx context.Context) error
+
+// CheckGroup checks a set of components that may change over time, e.g. the
+// pipelines of the tenants. The results are indexed by component name.
+type CheckGroup func(ctx context.Context) map[string]error
+
+// States of the components.
+const (
+	StateUnknown = "unknown" // Not checked yet.
+	StateUp      = "up"
+	StateDown    = "down"
+)
+
+// Component is the result of the latest check of a component.
+type Component struct {
+	Name     string      `json:"name"`
+	State    string      `json:"state"`
+	Error    string      `json:"error,omitempty"`
+	Critical bool        `json:"critical,omitempty"`
+	Checked  *time.Time  `json:"checked,omitempty"`
+	Duration string      `json:"duration,omitempty"`
+	Members  []Component `json:"members,omitempty"` // Only in groups.
+}
+
+// Status describes the components of the adapter.
+type Status struct {
+	Ready      bool        `json:"ready"`
+	Components []Component `json:"components"`
+}
+
+// check is a check or a group registered in the monitor.
+type check struct {
+	name     string
+	critical bool
+	check    Check
+	group    CheckGroup
+}
+
+// Monitor runs the checks periodically and keeps their latest results.
+//
+// The adapter is ready when all the critical components are up. A group is up
+// when at least one of its members is up or when it has no members, so e.g. a
+// tenant whose pipeline is down does not stop the adapter from serving the
+// other tenants.
+type Monitor struct {
+	logger   logrus.FieldLogger
+	interval time.Duration
+	timeout  time.Duration
+	checks   []check
+	results  map[string]Component
+	lastRun  time.Time // When the checks were last completed.
+	ctx      context.Context
+	cancel   context.CancelFunc
+	sync.RWMutex
+}
+
+// Defaults used when the interval or the timeout given to NewMonitor are not
+// positive.
+const (
+	defaultInterval = 30 * time.Second
+	defaultTimeout  = 10 * time.Second
+)
+
+// NewMonitor returns a monitor that runs the checks every interval, giving
+// each of them up to timeout to complete.
+func NewMonitor(logger logrus.FieldLogger, interval, timeout time.Duration) *Monitor {
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	m := &Monitor{
+		logger:   logger,
+		interval: interval,
+		timeout:  timeout,
+		results:  make(map[string]Component),
+	}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	return m
+}
+
+// Add registers a check. Critical components must be up for the adapter to
+// be ready.
+func (m *Monitor) Add(name string, critical bool, c Check) *Monitor {
+	m.checks = append(m.checks, check{name: name, critical: critical, check: c})
+	return m
+}
+
+// AddGroup registers a group of checks, see Monitor for how the state of the
+// group is determined.
+func (m *Monitor) AddGroup(name string, critical bool, g CheckGroup) *Monitor {
+	m.checks = append(m.checks, check{name: name, critical: critical, group: g})
+	return m
+}
+
+// Run runs the checks every interval until Stop is called.
+func (m *Monitor) Run() {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		m.CheckAll()
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop stops the monitor.
+func (m *Monitor) Stop() {
+	m.cancel()
+}
+
+// CheckAll runs all the checks concurrently and records their results. The
+// changes of state are logged.
+func (m *Monitor) CheckAll() {
+	var wg sync.WaitGroup
+	for _, c := range m.checks {
+		wg.Add(1)
+		go func(c check) {
+			defer wg.Done()
+			result := m.run(c)
+			m.Lock()
+			prev, ok := m.results[c.name]
+			m.results[c.name] = result
+			m.Unlock()
+			if !ok || prev.State != result.State {
+				m.logChange(result)
+			}
+		}(c)
+	}
+	wg.Wait()
+	m.Lock()
+	m.lastRun = time.Now()
+	m.Unlock()
+}
+
+// run runs a check or a group of checks.
+func (m *Monitor) run(c check) Component {
+	ctx, cancel := context.WithTimeout(m.ctx, m.timeout)
+	defer cancel()
+	start := time.Now()
+	result := Component{Name: c.name, Critical: c.critical, Checked: &start}
+	if c.check != nil {
+		result.setError(c.check(ctx))
+	} else {
+		result.State = StateUp
+		errs := c.group(ctx)
+		names := make([]string, 0, len(errs))
+		for name := range errs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		up := len(names) == 0
+		for _, name := range names {
+			member := Component{Name: name}
+			member.setError(errs[name])
+			up = up || member.State == StateUp
+			result.Members = append(result.Members, member)
+		}
+		if !up {
+			result.State = StateDown
+			result.Error = "all the members are down"
+		}
+	}
+	result.Duration = time.Since(start).Round(time.Millisecond).String()
+	return result
+}
+
+func (c *Component) setError(err error) {
+	if err != nil {
+		c.State = StateDown
+		c.Error = err.Error()
+		return
+	}
+	c.State = StateUp
+}
+
+func (m *Monitor) logChange(c Component) {
+	logger := m.logger.WithField("component", c.Name)
+	for _, member := range c.Members {
+		if member.State == StateDown {
+			logger = logger.WithField(member.Name, member.Error)
+		}
+	}
+	if c.State == StateUp {
+		logger.Info("Component is up")
+		return
+	}
+	logger.WithField("error", c.Error).Warn("Component is down")
+}
+
+// Status returns the latest results of the checks in the order they were
+// registered.
+func (m *Monitor) Status() Status {
+	m.RLock()
+	defer m.RUnlock()
+	status := Status{Ready: true, Components: make([]Component, 0, len(m.checks))}
+	for _, c := range m.checks {
+		result, ok := m.results[c.name]
+		if !ok {
+			result = Component{Name: c.name, State: StateUnknown, Critical: c.critical}
+		}
+		if c.critical && result.State != StateUp {
+			status.Ready = false
+		}
+		status.Components = append(status.Components, result)
+	}
+	return status
+}
+
+// Live reports whether the checks are still being run. They may not have run
+// yet, but they must not be overdue.
+func (m *Monitor) Live() bool {
+	m.RLock()
+	defer m.RUnlock()
+	if m.lastRun.IsZero() {
+		return true
+	}
+	return time.Since(m.lastRun) < 3*m.interval+m.timeout
+}
+
+// LiveHandler responds 200 while the adapter is alive, 503 otherwise.
+func (m *Monitor) LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !m.Live() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, "checks overdue")
+			return
+		}
+		fmt.Fprintln(w, "OK")
+	})
+}
+
+// ReadyHandler responds 200 when the adapter is ready, 503 otherwise along
+// with the critical components that are not up.
+func (m *Monitor) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := m.Status()
+		if status.Ready {
+			fmt.Fprintln(w, "OK")
+			return
+		}
+		var names []string
+		for _, c := range status.Components {
+			if c.Critical && c.State != StateUp {
+				names = append(names, fmt.Sprintf("%s (%s)", c.Name, c.State))
+			}
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "not ready: %s\n", strings.Join(names, ", "))
+	})
+}
+
+// StatusHandler responds with the status of the components encoded as JSON.
+// The response code is the same used by ReadyHandler.
+func (m *Monitor) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := m.Status()
+		w.Header().Set("Content-Type", "application/json")
+		if !status.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(status)
+	})
+}
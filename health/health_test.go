@@ -0,0 +1,135 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonitor(t *testing.T) {
+	var (
+		dbErr   error
+		members = map[string]error{}
+	)
+	m := NewMonitor(logrus.StandardLogger(), time.Hour, time.Second).
+		Add("database", true, func(ctx context.Context) error { return dbErr }).
+		Add("optional", false, func(ctx context.Context) error { return errors.New("unreachable") }).
+		AddGroup("pipelines", true, func(ctx context.Context) map[string]error { return members })
+
+	// Nothing has been checked yet.
+	status := m.Status()
+	assert.False(t, status.Ready)
+	assert.Equal(t, StateUnknown, status.Components[0].State)
+	assert.True(t, m.Live())
+
+	// Empty groups are up, non-critical components are ignored.
+	m.CheckAll()
+	status = m.Status()
+	assert.True(t, status.Ready)
+	assert.Equal(t, []string{StateUp, StateDown, StateUp}, states(status))
+	assert.Equal(t, "unreachable", status.Components[1].Error)
+
+	// Groups are up while one of their members is.
+	members = map[string]error{"a": errors.New("timeout"), "b": nil}
+	m.CheckAll()
+	status = m.Status()
+	assert.True(t, status.Ready)
+	require.Len(t, status.Components[2].Members, 2)
+	assert.Equal(t, Component{Name: "a", State: StateDown, Error: "timeout"}, status.Components[2].Members[0])
+
+	members = map[string]error{"a": errors.New("timeout"), "b": errors.New("forbidden")}
+	dbErr = errors.New("table not found")
+	m.CheckAll()
+	status = m.Status()
+	assert.False(t, status.Ready)
+	assert.Equal(t, []string{StateDown, StateDown, StateDown}, states(status))
+}
+
+func states(status Status) []string {
+	states := make([]string, 0, len(status.Components))
+	for _, c := range status.Components {
+		states = append(states, c.State)
+	}
+	return states
+}
+
+func TestMonitor_handlers(t *testing.T) {
+	var dbErr error
+	m := NewMonitor(logrus.StandardLogger(), time.Hour, time.Second).
+		Add("database", true, func(ctx context.Context) error { return dbErr })
+	m.CheckAll()
+
+	get := func(h http.Handler) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, get(m.LiveHandler()).Code)
+	assert.Equal(t, http.StatusOK, get(m.ReadyHandler()).Code)
+
+	dbErr = errors.New("table not found")
+	m.CheckAll()
+	assert.Equal(t, http.StatusOK, get(m.LiveHandler()).Code)
+	w := get(m.ReadyHandler())
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "not ready: database (down)\n", w.Body.String())
+
+	w = get(m.StatusHandler())
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	status := Status{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&status))
+	assert.False(t, status.Ready)
+	assert.Equal(t, "table not found", status.Components[0].Error)
+
+	// The checks are overdue.
+	m.lastRun = time.Now().Add(-4 * time.Hour)
+	assert.Equal(t, http.StatusServiceUnavailable, get(m.LiveHandler()).Code)
+}
+
+func TestMonitor_Run(t *testing.T) {
+	m := NewMonitor(logrus.StandardLogger(), time.Millisecond, time.Second).
+		Add("database", true, func(ctx context.Context) error { return nil })
+	done := make(chan struct{})
+	go func() {
+		m.Run()
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return m.Status().Ready }, time.Second, time.Millisecond)
+	m.Stop()
+	<-done
+}
+
+func TestCheckDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "health")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, CheckDir(dir, 0))
+	assert.NoError(t, CheckDir(dir, 1))
+	files, _ := ioutil.ReadDir(dir)
+	assert.Empty(t, files)
+
+	err = CheckDir(dir, 1<<62)
+	if assert.Error(t, err) {
+		assert.True(t, strings.HasPrefix(err.Error(), "free space is low"))
+	}
+
+	err = CheckDir(filepath.Join(dir, "missing"), 0)
+	if assert.Error(t, err) {
+		assert.True(t, strings.HasPrefix(err.Error(), "directory is not writable"))
+	}
+}
@@ -16,12 +16,14 @@ import (
 // ObjectStorage is a S3-compatible storage interface.
 type ObjectStorage interface {
 	Download(ctx context.Context, w io.WriterAt, URI string) (int64, error)
+	Upload(ctx context.Context, r io.Reader, URI string) error
 }
 
 // ObjectStorageImpl is our implementation of the ObjectStorage interface.
 type ObjectStorageImpl struct {
 	client     s3iface.S3API
 	downloader *s3manager.Downloader
+	uploader   *s3manager.Uploader
 }
 
 // New returns a pointer to a new ObjectStorageImpl.
@@ -30,6 +32,7 @@ func New(sess *session.Session) *ObjectStorageImpl {
 	return &ObjectStorageImpl{
 		client:     client,
 		downloader: s3manager.NewDownloaderWithClient(client),
+		uploader:   s3manager.NewUploaderWithClient(client),
 	}
 }
 
@@ -46,6 +49,21 @@ func (s *ObjectStorageImpl) Download(ctx context.Context, w io.WriterAt, URI str
 	return s.downloader.DownloadWithContext(ctx, w, req)
 }
 
+// Upload writes the contents of the given reader into a remote file.
+func (s *ObjectStorageImpl) Upload(ctx context.Context, r io.Reader, URI string) error {
+	bucket, key, err := getBucketAndKey(URI)
+	if err != nil {
+		return err
+	}
+	req := &s3manager.UploadInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   r,
+	}
+	_, err = s.uploader.UploadWithContext(ctx, req)
+	return err
+}
+
 func getBucketAndKey(URI string) (bucket string, key string, err error) {
 	u, err := url.Parse(URI)
 	if err != nil {
@@ -4,10 +4,15 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
@@ -78,6 +83,40 @@ func TestObjectStorageImpl_Download(t *testing.T) {
 	}
 }
 
+func TestObjectStorageImpl_Upload(t *testing.T) {
+	const want = "Hello world!"
+
+	var method, path, have string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		data, _ := ioutil.ReadAll(r.Body)
+		have = string(data)
+	}))
+	defer server.Close()
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("eu-west-2"),
+		S3ForcePathStyle: aws.Bool(true),
+	}))
+	client := New(sess)
+
+	if err := client.Upload(context.TODO(), strings.NewReader(want), "[invalid-url]:12345"); err == nil {
+		t.Error("Upload() should have returned an error but didn't")
+	}
+
+	if err := client.Upload(context.TODO(), strings.NewReader(want), "s3://foo/transfers/bar"); err != nil {
+		t.Fatal(err)
+	}
+	if method != "PUT" || path != "/foo/transfers/bar" {
+		t.Errorf("unexpected request: %s %s", method, path)
+	}
+	if want != have {
+		t.Errorf("want %s, got %s", want, have)
+	}
+}
+
 func Test_getBucketAndKey(t *testing.T) {
 	testCases := []struct {
 		url     string